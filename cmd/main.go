@@ -12,6 +12,7 @@ import (
 	"rca.agent/test/internal/config"
 	"rca.agent/test/internal/handler"
 	"rca.agent/test/internal/service"
+	"rca.agent/test/internal/tracing"
 )
 
 func main() {
@@ -26,6 +27,12 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	shutdownTracing, err := tracing.Setup(ctx, cfg)
+	if err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+
 	// Create service
 	svc, err := service.NewAnalysisService(ctx, cfg)
 	if err != nil {
@@ -67,6 +74,9 @@ func main() {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		slog.Error("Shutdown error", "error", err)
 	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Tracing shutdown error", "error", err)
+	}
 }
 
 func setupLogging(level string) {
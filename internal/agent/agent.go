@@ -5,12 +5,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"slices"
+	"sync"
+	"time"
 
 	"charm.land/fantasy"
 
 	"rca.agent/test/internal/auth"
 	"rca.agent/test/internal/config"
 	"rca.agent/test/internal/mcp"
+	"rca.agent/test/internal/metrics"
 	"rca.agent/test/internal/tools"
 )
 
@@ -19,83 +23,288 @@ type Options struct {
 	SystemPrompt string
 	OutputSchema any // If set, enables structured output with this schema
 	MaxSteps     int // Maximum number of agent steps
+
+	// PastAnalyses, if set, enables the search_past_analyses tool over its reports;
+	// Embedder additionally ranks them by semantic similarity.
+	PastAnalyses tools.ReportSearcher
+	Embedder     tools.Embedder
+}
+
+// Request is a single analysis request.
+type Request struct {
+	ID     string `json:"-"` // Analysis ID; generated if empty
+	Prompt string `json:"prompt"`
+	Caller string `json:"caller,omitempty"` // Team or client the analysis is attributed to
+
+	// Profile selects a prompt published by an MCP server ("server/name", or just the
+	// name if it is unique) whose messages precede the prompt; see Agent.Profiles.
+	Profile     string            `json:"profile,omitempty"`
+	ProfileArgs map[string]string `json:"profile_args,omitempty"`
+	GenerationParams
+	Budget
+
+	// OnProgress receives progress updates from long-running MCP tool calls, for
+	// callers that stream the analysis. Progress is logged either way.
+	OnProgress mcp.ProgressFunc `json:"-"`
+
+	// OnElicit receives questions MCP servers ask mid-analysis and returns the human's
+	// answer. Without it, servers' questions are declined.
+	OnElicit mcp.ElicitFunc `json:"-"`
+
+	// OnPendingElicitation is told of each question posted for a human to answer
+	// through the elicitations API, for callers that stream the analysis.
+	OnPendingElicitation func(PendingElicitation) `json:"-"`
+
+	// OnTrajectory receives the analysis' trajectory when it finishes, whether or not
+	// it succeeded.
+	OnTrajectory func(*Trajectory) `json:"-"`
+
+	// OnUsage receives the usage of each model step as it finishes, so that spend is
+	// accounted for even if the analysis later fails or is cancelled.
+	OnUsage func(Usage) `json:"-"`
+}
+
+// PendingElicitation is a question an MCP server asked during an analysis that is
+// waiting for a human to answer it.
+type PendingElicitation struct {
+	mcp.Elicitation
+	Caller  string    `json:"caller,omitempty"`
+	AskedAt time.Time `json:"asked_at"`
+}
+
+// Validate checks the request's generation parameters and budget.
+func (r Request) Validate() error {
+	if err := r.GenerationParams.Validate(); err != nil {
+		return err
+	}
+	return r.Budget.Validate()
 }
 
 // AnalysisResult is the result of an analysis.
 type AnalysisResult struct {
-	Output     any    `json:"output,omitempty"` // Structured output (if OutputSchema was set)
-	Text       string `json:"text,omitempty"`   // Raw text output
-	TotalSteps int    `json:"total_steps"`
-	Usage      Usage  `json:"usage"`
+	ID         string     `json:"id"`
+	Output     any        `json:"output,omitempty"` // Structured output (if OutputSchema was set)
+	Text       string     `json:"text,omitempty"`   // Raw text output
+	TotalSteps int        `json:"total_steps"`
+	Steps      []StepInfo `json:"steps,omitempty"` // Per-step details, in order
+	Usage      Usage      `json:"usage"`
+	Caller     string     `json:"caller,omitempty"`
+
+	// BudgetExceeded is set when the analysis was stopped early by its token/cost budget
+	BudgetExceeded bool `json:"budget_exceeded,omitempty"`
+
+	// Tool calls made and failed tool calls by error code, so that an analysis that
+	// could not reach its data sources can be told apart from one that found nothing
+	ToolCalls    int                   `json:"tool_calls"`
+	ToolFailures map[mcp.ErrorCode]int `json:"tool_failures,omitempty"`
+
+	// Tool calls answered from the MCP result cache or shared with an identical call
+	CachedToolCalls int `json:"cached_tool_calls,omitempty"`
+
+	// Entities named in the arguments of the analysis' tool calls
+	Entities Entities `json:"entities"`
 }
 
-// Usage represents token usage information.
+// StepInfo describes a single agent step.
+type StepInfo struct {
+	Step  int    `json:"step"`
+	Model string `json:"model"` // Model that served the step ("provider:model")
+	Usage Usage  `json:"usage"`
+
+	// Estimated prompt size sent for the step and the number of compacted tool results in it
+	ContextTokens    int64 `json:"context_tokens"`
+	CompactedResults int   `json:"compacted_results,omitempty"`
+}
+
+// Usage represents token usage and cost information.
 type Usage struct {
-	InputTokens  int64 `json:"input_tokens"`
-	OutputTokens int64 `json:"output_tokens"`
-	TotalTokens  int64 `json:"total_tokens"`
+	InputTokens      int64   `json:"input_tokens"`
+	OutputTokens     int64   `json:"output_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	ReasoningTokens  int64   `json:"reasoning_tokens,omitempty"`
+	CacheReadTokens  int64   `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int64   `json:"cache_write_tokens,omitempty"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// add returns the sum of two usages.
+func (u Usage) add(o Usage) Usage {
+	return Usage{
+		InputTokens:      u.InputTokens + o.InputTokens,
+		OutputTokens:     u.OutputTokens + o.OutputTokens,
+		TotalTokens:      u.TotalTokens + o.TotalTokens,
+		ReasoningTokens:  u.ReasoningTokens + o.ReasoningTokens,
+		CacheReadTokens:  u.CacheReadTokens + o.CacheReadTokens,
+		CacheWriteTokens: u.CacheWriteTokens + o.CacheWriteTokens,
+		CostUSD:          u.CostUSD + o.CostUSD,
+	}
 }
 
 // Agent holds the fantasy agent and its dependencies.
 type Agent struct {
-	agent        fantasy.Agent
-	mcpManager   *mcp.Manager
-	outputSchema any
+	agent          fantasy.Agent
+	model          fantasy.LanguageModel
+	mcpManager     *mcp.Manager
+	tools          *toolSet
+	systemPrompt   string
+	outputSchema   any
+	stopConditions []fantasy.StopCondition
+	generation     GenerationParams // Default generation parameters
+	budget         Budget           // Default per-analysis budget
+	pricing        pricingTable
+	compaction     CompactionOptions
+
+	maxParallelToolCalls int // Per-analysis cap on concurrent MCP tool calls
 }
 
 // New creates a new Agent with MCP tools.
 func New(ctx context.Context, cfg *config.Config, opts Options) (*Agent, error) {
-	// Initialize language model
-	modelName := cfg.RCAModelName
-
-	model, err := initLanguageModel(ctx, modelName, cfg)
+	// Initialize language model with its fallback chain
+	model, err := initModelChain(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
-	slog.Info("Initialized model", "model", modelName)
 
-	// Initialize MCP manager
-	mcpManager := mcp.NewManager()
-	mcpConfigs := buildMCPConfigs(ctx, cfg)
-	mcpManager.Initialize(ctx, mcpConfigs)
-
-	// Get and filter MCP tools
-	mcpTools := filterMCPTools(mcpManager.GetAllTools(ctx))
-	slog.Info("MCP tools filtered", "allowed", len(mcpTools))
+	generation := generationParamsFromConfig(cfg)
+	if err := generation.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid generation defaults: %w", err)
+	}
 
-	// Add native tools
-	allTools := append(mcpTools, tools.NewTodosTool())
+	pricingOverrides, err := cfg.GetModelPricing()
+	if err != nil {
+		return nil, err
+	}
 
 	// Build stop conditions
 	stopConditions := []fantasy.StopCondition{fantasy.StepCountIs(opts.MaxSteps)}
 
+	// Native tools; MCP tools are added once the servers are connected
+	nativeTools := []fantasy.AgentTool{tools.NewTodosTool(), tools.NewRecallToolResultTool()}
+	if opts.PastAnalyses != nil {
+		nativeTools = append(nativeTools, tools.NewSearchPastAnalysesTool(opts.PastAnalyses, opts.Embedder))
+	}
+
 	// Add structured output tool if schema provided (workaround until json mode is supported)
 	if opts.OutputSchema != nil {
-		allTools = append(allTools, tools.NewStructuredOutputTool(opts.OutputSchema))
+		nativeTools = append(nativeTools, tools.NewStructuredOutputTool(opts.OutputSchema))
 		stopConditions = append(stopConditions, fantasy.HasToolCall(tools.StructuredOutputToolName))
 	}
+	toolSet := newToolSet(nativeTools...)
+
+	// Initialize MCP manager
+	mcpOpts, err := buildMCPOptions(cfg, model)
+	if err != nil {
+		return nil, err
+	}
+	mcpOpts.OnToolsChanged = toolSet.refresh
+	mcpManager := mcp.NewManager(mcpOpts)
+	toolSet.manager = mcpManager
+	toolSet.readResource = mcp.NewReadResourceTool(mcpManager)
+	mcpConfigs := buildMCPConfigs(ctx, cfg)
+	mcpManager.Initialize(ctx, mcpConfigs)
+
+	// Get and filter MCP tools
+	toolSet.refresh(ctx)
+	slog.Info("MCP tools filtered", "allowed", len(toolSet.tools())-len(toolSet.native))
 
 	agentOpts := []fantasy.AgentOption{
 		fantasy.WithSystemPrompt(opts.SystemPrompt),
-		fantasy.WithTools(allTools...),
+		fantasy.WithTools(toolSet.tools()...),
 		fantasy.WithStopConditions(stopConditions...),
+		// Retries are handled per model by the fallback chain
+		fantasy.WithMaxRetries(0),
 	}
 
 	agent := fantasy.NewAgent(model, agentOpts...)
+	metrics.MaxConcurrentAnalyses.Set(float64(cfg.MaxConcurrentAnalyses))
 
 	return &Agent{
-		agent:        agent,
-		mcpManager:   mcpManager,
-		outputSchema: opts.OutputSchema,
+		agent:          agent,
+		model:          model,
+		mcpManager:     mcpManager,
+		tools:          toolSet,
+		systemPrompt:   opts.SystemPrompt,
+		outputSchema:   opts.OutputSchema,
+		stopConditions: stopConditions,
+		generation:     generation,
+		budget: Budget{
+			MaxTokens:  cfg.AnalysisTokenBudget,
+			MaxCostUSD: cfg.AnalysisCostBudgetUSD,
+		},
+		pricing:    newPricingTable(pricingOverrides),
+		compaction: compactionOptionsFromConfig(cfg),
+
+		maxParallelToolCalls: cfg.MaxParallelToolCalls,
 	}, nil
 }
 
 // Analyze runs the analysis and returns a structured result.
-func (a *Agent) Analyze(ctx context.Context, prompt string) (*AnalysisResult, error) {
-	slog.Info("Starting analysis", "prompt", truncate(prompt, 100))
+func (a *Agent) Analyze(ctx context.Context, req Request) (*AnalysisResult, error) {
+	if req.ID == "" {
+		req.ID = NewAnalysisID()
+	}
+	slog.Info("Starting analysis", "id", req.ID, "prompt", truncate(req.Prompt, 100), "caller", req.Caller, "profile", req.Profile)
+
+	profileMessages, err := a.profileMessages(ctx, req.Profile, req.ProfileArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	metrics.ActiveAnalyses.Inc()
+	defer metrics.ActiveAnalyses.Dec()
+
+	generation := a.generation.withOverrides(req.GenerationParams)
+	budget := newBudgetGuard(a.budget.Tighten(req.Budget), a.systemPrompt, a.outputSchema != nil)
+	stopConditions := append(slices.Clone(a.stopConditions), budget.stopCondition())
+
+	store := tools.NewToolResultStore()
+	ctx = tools.WithToolResultStore(ctx, store)
+	// Summaries and servers' sampling requests are charged to the step they happen in
+	extraUsage := &pendingUsage{price: a.usage}
+	contextManager := newContextManager(a.compaction, a.model, store, extraUsage.add)
+
+	ctx, recorder := withStepRecorder(ctx)
+	var steps []StepInfo
+	ctx = mcp.WithCallLimit(ctx, a.maxParallelToolCalls)
+	ctx = mcp.WithRequestCache(ctx)
+	if req.OnProgress != nil {
+		ctx = mcp.WithProgressFunc(ctx, req.OnProgress)
+	}
+	if req.OnElicit != nil {
+		ctx = mcp.WithElicitFunc(ctx, req.OnElicit)
+	}
+	ctx = mcp.WithUsageFunc(ctx, extraUsage.add)
+
+	stepTracer := newStepTracer(ctx)
+	trajectory := newTrajectoryRecorder(a.mcpManager, &Trajectory{
+		ID:           req.ID,
+		Caller:       req.Caller,
+		Profile:      req.Profile,
+		SystemPrompt: a.systemPrompt,
+		Messages:     trajectoryMessages(profileMessages),
+		Prompt:       req.Prompt,
+		StartedAt:    start,
+	})
+	if req.OnTrajectory != nil {
+		ctx = mcp.WithRawResultFunc(ctx, trajectory.rawResult)
+	}
+
+	// Tool results are reported concurrently when tool calls run in parallel
+	var toolMu sync.Mutex
+	var toolCalls, cachedToolCalls int
+	var entities Entities
+	toolFailures := make(map[mcp.ErrorCode]int)
 
 	result, err := a.agent.Stream(ctx, fantasy.AgentStreamCall{
-		Prompt: prompt,
+		Prompt:          req.Prompt,
+		Messages:        profileMessages,
+		Temperature:     generation.Temperature,
+		TopP:            generation.TopP,
+		MaxOutputTokens: generation.MaxOutputTokens,
+		ProviderOptions: generation.providerOptions(),
+		StopWhen:        stopConditions,
+		PrepareStep:     chainPrepareSteps(stepTracer.prepareStep(), a.tools.prepareStep(), orderToolResults(), contextManager.prepareStep(), budget.prepareStep()),
 		OnAgentStart: func() {
 			slog.Debug("Agent started")
 		},
@@ -107,60 +316,153 @@ func (a *Agent) Analyze(ctx context.Context, prompt string) (*AnalysisResult, er
 			slog.Debug("Model step", "step", step)
 			return nil
 		},
+		OnStepFinish: func(step fantasy.StepResult) error {
+			orderStepToolResults(step)
+			model := recorder.lastServed()
+			info := StepInfo{
+				Step:             len(steps),
+				Model:            model,
+				Usage:            a.usage(model, step.Usage).add(extraUsage.take()),
+				ContextTokens:    contextManager.estimatedTokens,
+				CompactedResults: contextManager.compacted,
+			}
+			steps = append(steps, info)
+			if req.OnUsage != nil {
+				req.OnUsage(info.Usage)
+			}
+			budget.observe(info)
+			stepTracer.finish(info, step)
+			observeStep(info)
+			trajectory.step(info, step)
+			return nil
+		},
 		OnToolCall: func(toolCall fantasy.ToolCallContent) error {
+			toolMu.Lock()
+			entities.add(toolCall.Input)
+			toolMu.Unlock()
+
 			var input any
 			if err := json.Unmarshal([]byte(toolCall.Input), &input); err == nil {
 				slog.Debug("Tool call",
-					"tool", toolCall.ToolName,
+					"tool", a.mcpManager.ToolLabel(toolCall.ToolName),
 					"id", toolCall.ToolCallID,
 					"input", input)
 			} else {
-				slog.Debug("Tool call", "tool", toolCall.ToolName, "input", toolCall.Input)
+				slog.Debug("Tool call", "tool", a.mcpManager.ToolLabel(toolCall.ToolName), "input", toolCall.Input)
 			}
 			return nil
 		},
 		OnToolResult: func(result fantasy.ToolResultContent) error {
-			var text string
-			if textResult, ok := fantasy.AsToolResultOutputType[fantasy.ToolResultOutputContentText](result.Result); ok {
-				text = textResult.Text
-			} else if errResult, ok := fantasy.AsToolResultOutputType[fantasy.ToolResultOutputContentError](result.Result); ok {
-				text = errResult.Error.Error()
-			} else {
-				text = fmt.Sprintf("%v", result.Result)
+			toolMu.Lock()
+			toolCalls++
+			code, failed := toolErrorCode(result)
+			if failed {
+				toolFailures[code]++
+			} else if fromCache(result) {
+				cachedToolCalls++
+			}
+			toolMu.Unlock()
+			if failed {
+				slog.Warn("Tool call failed", "tool", a.mcpManager.ToolLabel(result.ToolName), "id", result.ToolCallID, "code", code)
 			}
 
+			text := toolResultText(result)
 			var output any
 			if err := json.Unmarshal([]byte(text), &output); err == nil {
 				slog.Debug("Tool result",
-					"tool", result.ToolName,
+					"tool", a.mcpManager.ToolLabel(result.ToolName),
 					"id", result.ToolCallID,
 					"result", output)
 			} else {
 				if len(text) > 500 {
 					text = text[:500] + "...[truncated]"
 				}
-				slog.Debug("Tool result", "tool", result.ToolName, "result", text)
+				slog.Debug("Tool result", "tool", a.mcpManager.ToolLabel(result.ToolName), "result", text)
 			}
 			return nil
 		},
 	})
 
 	if err != nil {
-		slog.Error("Analysis error", "error", err)
+		// Summaries and sampling for a step that then failed are charged all the same
+		if usage := extraUsage.take(); req.OnUsage != nil && usage != (Usage{}) {
+			req.OnUsage(usage)
+		}
+		stepTracer.fail(err)
+		observeAnalysis(failureOutcome(err), time.Since(start), len(steps))
+		slog.Error("Analysis error", "id", req.ID, "error", err)
+		if req.OnTrajectory != nil {
+			req.OnTrajectory(trajectory.finish(nil, err))
+		}
 		return nil, err
 	}
 
-	return a.buildResult(result), nil
+	analysisResult := a.buildResult(result, steps)
+	analysisResult.ID = req.ID
+	analysisResult.Caller = req.Caller
+	analysisResult.ToolCalls = toolCalls
+	analysisResult.CachedToolCalls = cachedToolCalls
+	analysisResult.Entities = entities
+	if len(toolFailures) > 0 {
+		analysisResult.ToolFailures = toolFailures
+	}
+	analysisResult.BudgetExceeded = budget.exceeded()
+	outcome := outcomeCompleted
+	if analysisResult.BudgetExceeded {
+		outcome = outcomeBudgetExceeded
+		slog.Warn("Analysis stopped by budget", "caller", req.Caller,
+			"tokens", analysisResult.Usage.TotalTokens, "cost_usd", analysisResult.Usage.CostUSD)
+	}
+	observeAnalysis(outcome, time.Since(start), analysisResult.TotalSteps)
+	if req.OnTrajectory != nil {
+		req.OnTrajectory(trajectory.finish(analysisResult, nil))
+	}
+	return analysisResult, nil
+}
+
+// toolErrorCode reports whether a tool call failed and how. MCP tools attach their
+// error code as metadata; other failed tool calls count as tool errors.
+func toolErrorCode(result fantasy.ToolResultContent) (mcp.ErrorCode, bool) {
+	if _, ok := fantasy.AsToolResultOutputType[fantasy.ToolResultOutputContentError](result.Result); !ok {
+		return "", false
+	}
+
+	var meta mcp.ErrorMetadata
+	if err := json.Unmarshal([]byte(result.ClientMetadata), &meta); err == nil && meta.ErrorCode != "" {
+		return meta.ErrorCode, true
+	}
+	return mcp.CodeToolError, true
+}
+
+// fromCache reports whether a successful MCP tool result was served without calling the tool.
+func fromCache(result fantasy.ToolResultContent) bool {
+	var meta mcp.ResultMetadata
+	if err := json.Unmarshal([]byte(result.ClientMetadata), &meta); err != nil {
+		return false
+	}
+	return meta.Cache == mcp.CacheHit || meta.Cache == mcp.CacheShared
 }
 
-func (a *Agent) buildResult(result *fantasy.AgentResult) *AnalysisResult {
+// usage converts fantasy usage into Usage, pricing it for the given model.
+func (a *Agent) usage(model string, u fantasy.Usage) Usage {
+	return Usage{
+		InputTokens:      u.InputTokens,
+		OutputTokens:     u.OutputTokens,
+		TotalTokens:      u.TotalTokens,
+		ReasoningTokens:  u.ReasoningTokens,
+		CacheReadTokens:  u.CacheReadTokens,
+		CacheWriteTokens: u.CacheCreationTokens,
+		CostUSD:          a.pricing.cost(model, u),
+	}
+}
+
+func (a *Agent) buildResult(result *fantasy.AgentResult, steps []StepInfo) *AnalysisResult {
 	analysisResult := &AnalysisResult{
 		TotalSteps: len(result.Steps),
-		Usage: Usage{
-			InputTokens:  result.TotalUsage.InputTokens,
-			OutputTokens: result.TotalUsage.OutputTokens,
-			TotalTokens:  result.TotalUsage.TotalTokens,
-		},
+		Steps:      steps,
+	}
+	for _, step := range steps {
+		analysisResult.Usage = analysisResult.Usage.add(step.Usage)
 	}
 
 	// Extract structured output if schema was provided
@@ -187,11 +489,113 @@ func (a *Agent) buildResult(result *fantasy.AgentResult) *AnalysisResult {
 	return analysisResult
 }
 
+// initModelChain initializes the primary model followed by the configured fallbacks.
+// Fallback models without an API key or that fail to initialize are skipped; the
+// primary model must succeed.
+func initModelChain(ctx context.Context, cfg *config.Config) (fantasy.LanguageModel, error) {
+	if err := checkAPIKey(cfg.RCAModelName, cfg); err != nil {
+		return nil, err
+	}
+
+	primary, err := initLanguageModel(ctx, cfg.RCAModelName, cfg)
+	if err != nil {
+		return nil, err
+	}
+	models := []fantasy.LanguageModel{primary}
+	slog.Info("Initialized model", "model", cfg.RCAModelName)
+
+	for _, name := range cfg.GetModelFallbacks() {
+		if err := checkAPIKey(name, cfg); err != nil {
+			slog.Warn("Skipping fallback model", "model", name, "error", err)
+			continue
+		}
+		m, err := initLanguageModel(ctx, name, cfg)
+		if err != nil {
+			slog.Warn("Skipping fallback model", "model", name, "error", err)
+			continue
+		}
+		models = append(models, m)
+		slog.Info("Initialized fallback model", "model", name)
+	}
+
+	chain := newFallbackModel(models, RetryPolicy{
+		MaxRetries:   cfg.ModelMaxRetries,
+		InitialDelay: cfg.ModelRetryInitialDelay,
+		MaxDelay:     cfg.ModelRetryMaxDelay,
+	})
+	chain.compatReasoningModels = cfg.GetOpenAICompatReasoningModels()
+	return chain, nil
+}
+
+// MCPHealth returns the connection health of the MCP servers.
+func (a *Agent) MCPHealth() []mcp.ServerHealth {
+	return a.mcpManager.Health()
+}
+
 // Close cleans up resources.
 func (a *Agent) Close() error {
 	return a.mcpManager.Close()
 }
 
+func buildMCPOptions(cfg *config.Config, model fantasy.LanguageModel) (mcp.ManagerOptions, error) {
+	toolLimits, err := cfg.GetToolResultLimits()
+	if err != nil {
+		return mcp.ManagerOptions{}, err
+	}
+	serverTimeouts, toolTimeouts, err := cfg.GetMCPCallTimeouts()
+	if err != nil {
+		return mcp.ManagerOptions{}, err
+	}
+	cacheTTLs, err := cfg.GetMCPCacheTTLs()
+	if err != nil {
+		return mcp.ManagerOptions{}, err
+	}
+	toolAliases, err := cfg.GetMCPToolAliases()
+	if err != nil {
+		return mcp.ManagerOptions{}, err
+	}
+
+	opts := mcp.ManagerOptions{
+		ResultLimit: mcp.ResultLimit{
+			MaxBytes:  cfg.ToolResultMaxBytes,
+			MaxTokens: cfg.ToolResultMaxTokens,
+		},
+		ToolResultLimits:      make(map[string]mcp.ResultLimit, len(toolLimits)),
+		MediaResults:          supportsMediaToolResults(model),
+		SchemaDialect:         toolSchemaDialect(model),
+		ToolRefreshInterval:   cfg.MCPToolRefreshInterval,
+		ReconnectInitialDelay: cfg.MCPReconnectInitialDelay,
+		ReconnectMaxDelay:     cfg.MCPReconnectMaxDelay,
+		BreakerThreshold:      cfg.MCPBreakerThreshold,
+		BreakerOpenDuration:   cfg.MCPBreakerOpenDuration,
+		IdlePingAfter:         cfg.MCPIdlePingAfter,
+		MaxConcurrentCalls:    cfg.MCPMaxConcurrentCalls,
+		CallTimeout:           cfg.MCPCallTimeout,
+		ServerTimeouts:        serverTimeouts,
+		ToolTimeouts:          toolTimeouts,
+		CacheTTLs:             cacheTTLs,
+		SamplingPolicy: mcp.SamplingPolicy{
+			MaxTokens:      cfg.MCPSamplingMaxTokens,
+			MaxInputTokens: cfg.MCPSamplingMaxInputTokens,
+			TokensPerHour:  cfg.MCPSamplingTokensPerHour,
+		},
+		ElicitationTimeout: cfg.MCPElicitationTimeout,
+		ToolAliases:        toolAliases,
+		AllowedTools:       allowedMCPTools,
+	}
+	if cfg.MCPSamplingMaxTokens > 0 {
+		opts.SamplingModel = model
+	}
+	for name, limit := range toolLimits {
+		opts.ToolResultLimits[name] = mcp.ResultLimit{
+			MaxBytes:  limit.MaxBytes,
+			MaxTokens: limit.MaxTokens,
+		}
+	}
+
+	return opts, nil
+}
+
 func buildMCPConfigs(ctx context.Context, cfg *config.Config) []mcp.Config {
 	var configs []mcp.Config
 
@@ -224,6 +628,45 @@ func buildMCPConfigs(ctx context.Context, cfg *config.Config) []mcp.Config {
 	return configs
 }
 
+// chainPrepareSteps runs several step preparation functions in order. Each one
+// sees the messages produced by the previous ones; later non-empty fields win.
+func chainPrepareSteps(fns ...fantasy.PrepareStepFunction) fantasy.PrepareStepFunction {
+	return func(ctx context.Context, opts fantasy.PrepareStepFunctionOptions) (context.Context, fantasy.PrepareStepResult, error) {
+		var merged fantasy.PrepareStepResult
+		for _, fn := range fns {
+			var prepared fantasy.PrepareStepResult
+			var err error
+			ctx, prepared, err = fn(ctx, opts)
+			if err != nil {
+				return ctx, merged, err
+			}
+
+			if prepared.Messages != nil {
+				merged.Messages = prepared.Messages
+				opts.Messages = prepared.Messages
+			}
+			if prepared.Model != nil {
+				merged.Model = prepared.Model
+				opts.Model = prepared.Model
+			}
+			if prepared.System != nil {
+				merged.System = prepared.System
+			}
+			if prepared.ToolChoice != nil {
+				merged.ToolChoice = prepared.ToolChoice
+			}
+			if len(prepared.ActiveTools) > 0 {
+				merged.ActiveTools = prepared.ActiveTools
+			}
+			if prepared.Tools != nil {
+				merged.Tools = prepared.Tools
+			}
+			merged.DisableAllTools = merged.DisableAllTools || prepared.DisableAllTools
+		}
+		return ctx, merged, nil
+	}
+}
+
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
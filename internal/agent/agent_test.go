@@ -0,0 +1,230 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"rca.agent/test/internal/mcp"
+	"rca.agent/test/internal/metrics"
+)
+
+// scriptedModel calls a tool in its first step and answers in the next.
+type scriptedModel struct {
+	fantasy.LanguageModel
+	tool  string
+	steps int
+}
+
+func (m *scriptedModel) Provider() string { return "fake" }
+func (m *scriptedModel) Model() string    { return "scripted" }
+
+func (m *scriptedModel) Stream(context.Context, fantasy.Call) (fantasy.StreamResponse, error) {
+	m.steps++
+	first := m.steps == 1
+	return func(yield func(fantasy.StreamPart) bool) {
+		if first {
+			if !yield(fantasy.StreamPart{Type: fantasy.StreamPartTypeToolCall, ID: "call-1", ToolCallName: m.tool, ToolCallInput: "{}"}) {
+				return
+			}
+			yield(fantasy.StreamPart{Type: fantasy.StreamPartTypeFinish, FinishReason: fantasy.FinishReasonToolCalls, Usage: fantasy.Usage{InputTokens: 8, OutputTokens: 2, TotalTokens: 10}})
+			return
+		}
+		for _, part := range []fantasy.StreamPart{
+			{Type: fantasy.StreamPartTypeTextStart, ID: "text"},
+			{Type: fantasy.StreamPartTypeTextDelta, ID: "text", Delta: "payments is out of memory"},
+			{Type: fantasy.StreamPartTypeTextEnd, ID: "text"},
+			{Type: fantasy.StreamPartTypeFinish, FinishReason: fantasy.FinishReasonStop, Usage: fantasy.Usage{InputTokens: 15, OutputTokens: 5, TotalTokens: 20}},
+		} {
+			if !yield(part) {
+				return
+			}
+		}
+	}, nil
+}
+
+// newTestAgent returns an agent on the model whose tools come from an MCP server
+// with the given tools.
+func newTestAgent(t *testing.T, m fantasy.LanguageModel, register func(*gomcp.Server)) *Agent {
+	t.Helper()
+
+	server := gomcp.NewServer(&gomcp.Implementation{Name: "test", Version: "1.0.0"}, nil)
+	register(server)
+	httpServer := httptest.NewServer(gomcp.NewStreamableHTTPHandler(func(*http.Request) *gomcp.Server { return server }, nil))
+	t.Cleanup(httpServer.Close)
+
+	manager := mcp.NewManager(mcp.ManagerOptions{})
+	manager.Initialize(context.Background(), []mcp.Config{{Name: "test", URL: httpServer.URL}})
+	t.Cleanup(func() { manager.Close() })
+
+	toolSet := newToolSet()
+	toolSet.manager = manager
+	toolSet.refresh(context.Background())
+
+	model := newFallbackModel([]fantasy.LanguageModel{m}, testPolicy)
+	stopConditions := []fantasy.StopCondition{fantasy.StepCountIs(5)}
+	return &Agent{
+		agent:          fantasy.NewAgent(model, fantasy.WithTools(toolSet.tools()...), fantasy.WithStopConditions(stopConditions...), fantasy.WithMaxRetries(0)),
+		model:          model,
+		mcpManager:     manager,
+		tools:          toolSet,
+		stopConditions: stopConditions,
+		pricing:        newPricingTable(nil),
+	}
+}
+
+func TestAnalyzeReportsToolProgress(t *testing.T) {
+	model := &scriptedModel{}
+	a := newTestAgent(t, model, func(s *gomcp.Server) {
+		s.AddTool(&gomcp.Tool{Name: "get_project_logs", InputSchema: map[string]any{"type": "object"}}, func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			req.Session.NotifyProgress(ctx, &gomcp.ProgressNotificationParams{
+				ProgressToken: req.Params.GetProgressToken(),
+				Progress:      1,
+				Total:         2,
+				Message:       "scanning logs",
+			})
+			// Notifications are dispatched asynchronously; give it time to arrive before the result
+			time.Sleep(50 * time.Millisecond)
+			return &gomcp.CallToolResult{Content: []gomcp.Content{&gomcp.TextContent{Text: "OOMKilled"}}}, nil
+		})
+	})
+
+	model.tool = a.tools.tools()[0].Info().Name
+
+	var mu sync.Mutex
+	var progress []mcp.Progress
+	var usage Usage
+	result, err := a.Analyze(context.Background(), Request{
+		Prompt: "why is payments failing?",
+		OnProgress: func(p mcp.Progress) {
+			mu.Lock()
+			defer mu.Unlock()
+			progress = append(progress, p)
+		},
+		OnUsage: func(u Usage) { usage = usage.add(u) },
+	})
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+	if result.Text != "payments is out of memory" || result.ToolCalls != 1 {
+		t.Errorf("result = %+v", result)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(progress) != 1 {
+		t.Fatalf("progress = %+v, want one update", progress)
+	}
+	if p := progress[0]; p.ToolCallID != "call-1" || p.Tool != "get_project_logs" || p.Message != "scanning logs" || p.Total != 2 {
+		t.Errorf("progress = %+v", p)
+	}
+	if usage.TotalTokens != 30 || usage != result.Usage {
+		t.Errorf("reported usage = %+v, want the result's %+v", usage, result.Usage)
+	}
+}
+
+// recordSpans installs a tracer provider that records spans, once: the package's
+// tracer keeps the first provider installed.
+var recordSpans = sync.OnceValue(func() *tracetest.SpanRecorder {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	return spans
+})
+
+func TestAnalyzeTracesStepsAndToolCalls(t *testing.T) {
+	spans := recordSpans()
+	model := &scriptedModel{}
+	a := newTestAgent(t, model, func(s *gomcp.Server) {
+		s.AddTool(&gomcp.Tool{Name: "get_project_logs", InputSchema: map[string]any{"type": "object"}}, func(context.Context, *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			return &gomcp.CallToolResult{Content: []gomcp.Content{&gomcp.TextContent{Text: "OOMKilled"}}}, nil
+		})
+	})
+	model.tool = a.tools.tools()[0].Info().Name
+
+	ctx, analysis := otel.Tracer("test").Start(context.Background(), "analyze")
+	if _, err := a.Analyze(ctx, Request{Prompt: "why is payments failing?"}); err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+	analysis.End()
+
+	var steps []sdktrace.ReadOnlySpan
+	var toolCall sdktrace.ReadOnlySpan
+	for _, span := range spans.Ended() {
+		if span.SpanContext().TraceID() != analysis.SpanContext().TraceID() {
+			continue
+		}
+		switch span.Name() {
+		case "agent.step":
+			steps = append(steps, span)
+		case "mcp.tool_call":
+			toolCall = span
+		}
+	}
+	if len(steps) != 2 {
+		t.Fatalf("step spans = %d, want 2", len(steps))
+	}
+	for _, step := range steps {
+		if step.Parent().SpanID() != analysis.SpanContext().SpanID() {
+			t.Errorf("step %s is not a child of the analysis span", step.SpanContext().SpanID())
+		}
+	}
+	if toolCall == nil || toolCall.Parent().SpanID() != steps[0].SpanContext().SpanID() {
+		t.Fatalf("tool call span = %v, want a child of the first step", toolCall)
+	}
+
+	attrs := attribute.NewSet(steps[0].Attributes()...)
+	if v, _ := attrs.Value("gen_ai.response.finish_reason"); v.AsString() != string(fantasy.FinishReasonToolCalls) {
+		t.Errorf("finish reason = %v", v)
+	}
+	if v, _ := attrs.Value("agent.tool_calls"); v.AsInt64() != 1 {
+		t.Errorf("tool calls = %v, want 1", v)
+	}
+}
+
+func TestAnalyzeRecordsMetrics(t *testing.T) {
+	model := &scriptedModel{}
+	a := newTestAgent(t, model, func(s *gomcp.Server) {
+		s.AddTool(&gomcp.Tool{Name: "get_project_logs", InputSchema: map[string]any{"type": "object"}}, func(context.Context, *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			return &gomcp.CallToolResult{Content: []gomcp.Content{&gomcp.TextContent{Text: "OOMKilled"}}}, nil
+		})
+	})
+	model.tool = a.tools.tools()[0].Info().Name
+
+	// Metrics are global, so other tests' analyses are subtracted out
+	counters := map[string]prometheus.Collector{
+		"completed analyses": metrics.Analyses.WithLabelValues(outcomeCompleted),
+		"input tokens":       metrics.ModelTokens.WithLabelValues("fake:scripted", "input"),
+		"output tokens":      metrics.ModelTokens.WithLabelValues("fake:scripted", "output"),
+		"tool calls":         metrics.ToolCalls.WithLabelValues("test", "get_project_logs", "ok"),
+	}
+	before := make(map[string]float64)
+	for name, c := range counters {
+		before[name] = testutil.ToFloat64(c)
+	}
+
+	if _, err := a.Analyze(context.Background(), Request{Prompt: "why is payments failing?"}); err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+
+	want := map[string]float64{"completed analyses": 1, "input tokens": 23, "output tokens": 7, "tool calls": 1}
+	for name, c := range counters {
+		if n := testutil.ToFloat64(c) - before[name]; n != want[name] {
+			t.Errorf("%s = %v, want %v", name, n, want[name])
+		}
+	}
+	if n := testutil.ToFloat64(metrics.ActiveAnalyses); n != 0 {
+		t.Errorf("active analyses = %v, want 0", n)
+	}
+}
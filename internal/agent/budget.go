@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"charm.land/fantasy"
+
+	"rca.agent/test/internal/tools"
+)
+
+// ErrBudgetExceeded is returned when an analysis cannot start because its budget is already spent.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// budgetWrapUpPrompt is appended to the system prompt for the final step once the budget is spent.
+const budgetWrapUpPrompt = `
+
+IMPORTANT: The token/cost budget for this analysis is exhausted. Do not call any more tools.
+Submit your findings so far with the structured_output tool now, noting in the summary that the analysis was cut short.`
+
+// Budget limits the tokens and cost an analysis may spend. Zero values mean unlimited.
+type Budget struct {
+	MaxTokens  int64   `json:"token_budget,omitempty"`
+	MaxCostUSD float64 `json:"cost_budget_usd,omitempty"`
+}
+
+// IsZero reports whether the budget is unlimited.
+func (b Budget) IsZero() bool {
+	return b.MaxTokens == 0 && b.MaxCostUSD == 0
+}
+
+// Tighten returns the stricter of b and o for each limit.
+func (b Budget) Tighten(o Budget) Budget {
+	return Budget{
+		MaxTokens:  minPositive(b.MaxTokens, o.MaxTokens),
+		MaxCostUSD: minPositive(b.MaxCostUSD, o.MaxCostUSD),
+	}
+}
+
+// Validate checks that the budget limits are not negative.
+func (b Budget) Validate() error {
+	if b.MaxTokens < 0 || b.MaxCostUSD < 0 {
+		return fmt.Errorf("budgets must not be negative")
+	}
+	return nil
+}
+
+// budgetGuard enforces a Budget across the steps of a single analysis. When the
+// budget is exceeded and structured output is enabled, one final step is allowed
+// in which the model is forced to submit its partial findings.
+type budgetGuard struct {
+	budget       Budget
+	systemPrompt string
+	canWrapUp    bool
+
+	tokens    int64
+	costUSD   float64
+	wrappedUp bool
+}
+
+func newBudgetGuard(budget Budget, systemPrompt string, canWrapUp bool) *budgetGuard {
+	return &budgetGuard{budget: budget, systemPrompt: systemPrompt, canWrapUp: canWrapUp}
+}
+
+// observe accounts for a finished step.
+func (g *budgetGuard) observe(step StepInfo) {
+	g.tokens += step.Usage.TotalTokens
+	g.costUSD += step.Usage.CostUSD
+}
+
+// exceeded reports whether the spend so far has reached either limit.
+func (g *budgetGuard) exceeded() bool {
+	return (g.budget.MaxTokens > 0 && g.tokens >= g.budget.MaxTokens) ||
+		(g.budget.MaxCostUSD > 0 && g.costUSD >= g.budget.MaxCostUSD)
+}
+
+// stopCondition stops the agent once the budget is exceeded and the wrap-up step, if any, has run.
+func (g *budgetGuard) stopCondition() fantasy.StopCondition {
+	return func(_ []fantasy.StepResult) bool {
+		return g.exceeded() && (!g.canWrapUp || g.wrappedUp)
+	}
+}
+
+// prepareStep forces the structured output tool on the step after the budget is exceeded.
+func (g *budgetGuard) prepareStep() fantasy.PrepareStepFunction {
+	return func(ctx context.Context, _ fantasy.PrepareStepFunctionOptions) (context.Context, fantasy.PrepareStepResult, error) {
+		if !g.exceeded() || !g.canWrapUp || g.wrappedUp {
+			return ctx, fantasy.PrepareStepResult{}, nil
+		}
+
+		g.wrappedUp = true
+		system := g.systemPrompt + budgetWrapUpPrompt
+		toolChoice := fantasy.SpecificToolChoice(tools.StructuredOutputToolName)
+		return ctx, fantasy.PrepareStepResult{
+			System:      &system,
+			ToolChoice:  &toolChoice,
+			ActiveTools: []string{tools.StructuredOutputToolName},
+		}, nil
+	}
+}
+
+// minPositive returns the smaller of a and b, treating zero as unlimited.
+func minPositive[T int64 | float64](a, b T) T {
+	switch {
+	case a <= 0:
+		return b
+	case b <= 0:
+		return a
+	default:
+		return min(a, b)
+	}
+}
+
+// pendingUsage collects the usage of model calls made outside the analysis' steps,
+// such as LLM summaries of tool results and MCP servers' sampling requests, until
+// it is charged to a step. It is safe for concurrent use.
+type pendingUsage struct {
+	price func(model string, u fantasy.Usage) Usage
+
+	mu    sync.Mutex
+	usage Usage
+}
+
+// add prices the usage of a call to the given "provider:model" and adds it.
+func (p *pendingUsage) add(model string, u fantasy.Usage) {
+	usage := p.price(model, u)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.usage = p.usage.add(usage)
+}
+
+// take returns the usage added since it was last called.
+func (p *pendingUsage) take() Usage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	usage := p.usage
+	p.usage = Usage{}
+	return usage
+}
@@ -0,0 +1,294 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"charm.land/fantasy"
+
+	"rca.agent/test/internal/config"
+	"rca.agent/test/internal/tools"
+)
+
+const (
+	// minCompactChars is the size below which tool results are never compacted.
+	minCompactChars = 2000
+	// charsPerToken is the rough ratio used to estimate prompt size from text length.
+	charsPerToken = 4
+	// maxSummarizeChars caps the tool output sent to the LLM summarizer.
+	maxSummarizeChars = 200000
+)
+
+const summarizePrompt = `You compress tool outputs for an SRE root cause analysis agent.
+Summarize the following output of the %s tool in at most 300 words. Preserve error messages,
+status codes, timestamps, component/project names, trace IDs, counts and anything anomalous.
+Omit routine, repetitive entries.
+
+%s`
+
+// CompactionOptions configures context window management for an analysis.
+type CompactionOptions struct {
+	ThresholdTokens int64  // Estimated prompt size above which old tool results are compacted (0 disables)
+	KeepRecent      int    // Number of most recent tool results that are never compacted
+	Summarizer      string // "heuristic" or "llm"
+}
+
+// compactionOptionsFromConfig returns the configured compaction options.
+func compactionOptionsFromConfig(cfg *config.Config) CompactionOptions {
+	return CompactionOptions{
+		ThresholdTokens: cfg.ContextCompactionThreshold,
+		KeepRecent:      cfg.ContextKeepRecentResults,
+		Summarizer:      cfg.ContextSummarizer,
+	}
+}
+
+// contextManager keeps the prompt of a single analysis within its context budget
+// by replacing older tool results with summaries. Originals are kept in the
+// tool result store and can be retrieved by the model with recall_tool_result.
+type contextManager struct {
+	opts   CompactionOptions
+	model  fantasy.LanguageModel
+	store  *tools.ToolResultStore
+	charge func(model string, u fantasy.Usage) // Receives the usage of LLM summaries
+
+	summaries map[string]string // Summaries by tool call ID, reused across steps
+
+	// Stats for the most recent step
+	estimatedTokens int64
+	compacted       int
+}
+
+// newContextManager creates a context manager; the usage of LLM summaries is passed
+// to charge, which may be nil.
+func newContextManager(opts CompactionOptions, model fantasy.LanguageModel, store *tools.ToolResultStore, charge func(model string, u fantasy.Usage)) *contextManager {
+	return &contextManager{
+		opts:      opts,
+		model:     model,
+		store:     store,
+		charge:    charge,
+		summaries: make(map[string]string),
+	}
+}
+
+// partKey locates a part within the step messages.
+type partKey struct {
+	msg, part int
+}
+
+// toolResultRef is a text tool result within the step messages.
+type toolResultRef struct {
+	partKey
+	toolCallID string
+	toolName   string
+	text       string
+}
+
+// prepareStep compacts tool results in the step's input messages. Fantasy passes
+// the full history to every step, so summaries from earlier steps are re-applied
+// before deciding whether more results need compacting.
+func (m *contextManager) prepareStep() fantasy.PrepareStepFunction {
+	return func(ctx context.Context, opts fantasy.PrepareStepFunctionOptions) (context.Context, fantasy.PrepareStepResult, error) {
+		estimate := estimateTokens(opts.Messages)
+		m.estimatedTokens, m.compacted = estimate, 0
+		if m.opts.ThresholdTokens <= 0 || (estimate < m.opts.ThresholdTokens && len(m.summaries) == 0) {
+			return ctx, fantasy.PrepareStepResult{}, nil
+		}
+
+		refs := toolResultRefs(opts.Messages)
+		candidates := refs[:max(len(refs)-m.opts.KeepRecent, 0)]
+		replacements := make(map[partKey]string)
+
+		// Re-apply summaries from earlier steps
+		for _, ref := range candidates {
+			if summary, ok := m.summaries[ref.toolCallID]; ok {
+				replacements[ref.partKey] = summary
+				estimate -= int64(len(ref.text)-len(summary)) / charsPerToken
+			}
+		}
+
+		// Compact more, oldest first, until under the threshold
+		for _, ref := range candidates {
+			if estimate < m.opts.ThresholdTokens {
+				break
+			}
+			chars := utf8.RuneCountInString(ref.text)
+			if _, done := replacements[ref.partKey]; done || chars < minCompactChars {
+				continue
+			}
+
+			m.store.Put(ref.toolCallID, tools.StoredToolResult{ToolName: ref.toolName, Text: ref.text})
+			summary := m.summarize(ctx, ref)
+			m.summaries[ref.toolCallID] = summary
+			replacements[ref.partKey] = summary
+			estimate -= int64(len(ref.text)-len(summary)) / charsPerToken
+
+			slog.Debug("Compacted tool result",
+				"tool", ref.toolName,
+				"id", ref.toolCallID,
+				"original_chars", chars,
+				"summary_chars", utf8.RuneCountInString(summary))
+		}
+
+		m.estimatedTokens, m.compacted = estimate, len(replacements)
+		if len(replacements) == 0 {
+			return ctx, fantasy.PrepareStepResult{}, nil
+		}
+
+		if estimate >= m.opts.ThresholdTokens {
+			slog.Warn("Context still above compaction threshold", "estimated_tokens", estimate, "threshold", m.opts.ThresholdTokens)
+		}
+
+		return ctx, fantasy.PrepareStepResult{
+			Messages: replaceToolResults(opts.Messages, replacements),
+		}, nil
+	}
+}
+
+// summarize produces the compacted form of a tool result.
+func (m *contextManager) summarize(ctx context.Context, ref toolResultRef) string {
+	header := fmt.Sprintf("[Compacted result of %s (tool_call_id: %s, %d characters). Call %s with this tool_call_id to read the full output.]",
+		ref.toolName, ref.toolCallID, utf8.RuneCountInString(ref.text), tools.RecallToolResultToolName)
+
+	if m.opts.Summarizer == "llm" && m.model != nil {
+		summary, err := m.summarizeWithLLM(ctx, ref)
+		if err == nil && summary != "" {
+			return header + "\n\nSummary:\n" + summary
+		}
+		slog.Warn("LLM summarization failed, using heuristic", "tool", ref.toolName, "error", err)
+	}
+
+	return header + "\n\n" + heuristicSummary(ref.text)
+}
+
+// summarizeWithLLM asks the model for a summary of the tool result, charging its
+// usage to the analysis.
+func (m *contextManager) summarizeWithLLM(ctx context.Context, ref toolResultRef) (string, error) {
+	text := ref.text
+	if len(text) > maxSummarizeChars {
+		text = text[:runeStart(text, maxSummarizeChars)] + "\n...[truncated]"
+	}
+
+	// Record the model serving the summary apart from the analysis' steps
+	ctx, recorder := withStepRecorder(ctx)
+	resp, err := m.model.Generate(ctx, fantasy.Call{
+		Prompt: fantasy.Prompt{fantasy.NewUserMessage(fmt.Sprintf(summarizePrompt, ref.toolName, text))},
+	})
+	if err != nil {
+		return "", err
+	}
+	model := recorder.lastServed()
+	if model == "" {
+		model = modelName(m.model)
+	}
+	if m.charge != nil {
+		m.charge(model, resp.Usage)
+	}
+	return strings.TrimSpace(resp.Content.Text()), nil
+}
+
+// heuristicSummary keeps the head and tail of a tool result along with its line count.
+func heuristicSummary(text string) string {
+	const headChars, tailChars = 1200, 400
+
+	lines := strings.Count(text, "\n") + 1
+	if len(text) <= headChars+tailChars {
+		return text
+	}
+
+	head := text[:runeStart(text, headChars)]
+	tail := text[runeStart(text, len(text)-tailChars):]
+	return fmt.Sprintf("Preview (%d lines total):\n%s\n...\n%s", lines, head, tail)
+}
+
+// runeStart returns the largest index up to i at which a rune of s starts, so that
+// s can be cut there without splitting a multi-byte character.
+func runeStart(s string, i int) int {
+	for i > 0 && i < len(s) && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
+
+// toolResultRefs returns all text tool results in message order.
+func toolResultRefs(messages []fantasy.Message) []toolResultRef {
+	toolNames := make(map[string]string)
+	var refs []toolResultRef
+
+	for i, msg := range messages {
+		for j, part := range msg.Content {
+			if call, ok := fantasy.AsMessagePart[fantasy.ToolCallPart](part); ok {
+				toolNames[call.ToolCallID] = call.ToolName
+				continue
+			}
+			result, ok := fantasy.AsMessagePart[fantasy.ToolResultPart](part)
+			if !ok {
+				continue
+			}
+			text, ok := fantasy.AsToolResultOutputType[fantasy.ToolResultOutputContentText](result.Output)
+			if !ok {
+				continue
+			}
+			refs = append(refs, toolResultRef{
+				partKey:    partKey{msg: i, part: j},
+				toolCallID: result.ToolCallID,
+				toolName:   toolNames[result.ToolCallID],
+				text:       text.Text,
+			})
+		}
+	}
+
+	return refs
+}
+
+// replaceToolResults returns a copy of messages with the referenced tool results
+// replaced. The input messages are shared with the agent and are not modified.
+func replaceToolResults(messages []fantasy.Message, replacements map[partKey]string) []fantasy.Message {
+	out := make([]fantasy.Message, len(messages))
+	copy(out, messages)
+
+	copied := make(map[int]bool)
+	for ref, text := range replacements {
+		if !copied[ref.msg] {
+			out[ref.msg].Content = append([]fantasy.MessagePart(nil), out[ref.msg].Content...)
+			copied[ref.msg] = true
+		}
+		result, _ := fantasy.AsMessagePart[fantasy.ToolResultPart](out[ref.msg].Content[ref.part])
+		result.Output = fantasy.ToolResultOutputContentText{Text: text}
+		out[ref.msg].Content[ref.part] = result
+	}
+
+	return out
+}
+
+// estimateTokens roughly estimates the prompt size of messages in tokens.
+func estimateTokens(messages []fantasy.Message) int64 {
+	var chars int
+	for _, msg := range messages {
+		for _, part := range msg.Content {
+			if p, ok := fantasy.AsMessagePart[fantasy.TextPart](part); ok {
+				chars += len(p.Text)
+			} else if p, ok := fantasy.AsMessagePart[fantasy.ReasoningPart](part); ok {
+				chars += len(p.Text)
+			} else if p, ok := fantasy.AsMessagePart[fantasy.ToolCallPart](part); ok {
+				chars += len(p.Input)
+			} else if p, ok := fantasy.AsMessagePart[fantasy.ToolResultPart](part); ok {
+				chars += toolResultChars(p.Output)
+			}
+		}
+	}
+	return int64(chars / charsPerToken)
+}
+
+// toolResultChars returns the text length of a tool result output.
+func toolResultChars(output fantasy.ToolResultOutputContent) int {
+	if text, ok := fantasy.AsToolResultOutputType[fantasy.ToolResultOutputContentText](output); ok {
+		return len(text.Text)
+	}
+	if errResult, ok := fantasy.AsToolResultOutputType[fantasy.ToolResultOutputContentError](output); ok && errResult.Error != nil {
+		return len(errResult.Error.Error())
+	}
+	return 0
+}
@@ -0,0 +1,146 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"charm.land/fantasy"
+
+	"rca.agent/test/internal/tools"
+)
+
+// toolRoundTrip returns the assistant tool call and tool result messages of one tool call.
+func toolRoundTrip(id, name, result string) []fantasy.Message {
+	return []fantasy.Message{
+		{
+			Role:    fantasy.MessageRoleAssistant,
+			Content: []fantasy.MessagePart{fantasy.ToolCallPart{ToolCallID: id, ToolName: name, Input: "{}"}},
+		},
+		{
+			Role: fantasy.MessageRoleTool,
+			Content: []fantasy.MessagePart{fantasy.ToolResultPart{
+				ToolCallID: id,
+				Output:     fantasy.ToolResultOutputContentText{Text: result},
+			}},
+		},
+	}
+}
+
+func TestContextManagerCompactsOldToolResults(t *testing.T) {
+	big := strings.Repeat("2026-10-18T10:00:00Z ERROR connection refused\n", 2000)
+
+	messages := []fantasy.Message{fantasy.NewUserMessage("why is payments failing?")}
+	messages = append(messages, toolRoundTrip("call-1", "get_project_logs", big)...)
+	messages = append(messages, toolRoundTrip("call-2", "get_traces", big)...)
+	messages = append(messages, toolRoundTrip("call-3", "get_component_logs", big)...)
+
+	store := tools.NewToolResultStore()
+	manager := newContextManager(CompactionOptions{ThresholdTokens: 30000, KeepRecent: 1}, nil, store, nil)
+	prepare := manager.prepareStep()
+
+	_, prepared, err := prepare(context.Background(), fantasy.PrepareStepFunctionOptions{Messages: messages})
+	if err != nil {
+		t.Fatalf("prepareStep() error = %v", err)
+	}
+	if prepared.Messages == nil {
+		t.Fatal("prepareStep() did not compact messages")
+	}
+
+	refs := toolResultRefs(prepared.Messages)
+	if len(refs) != 3 {
+		t.Fatalf("got %d tool results, want 3", len(refs))
+	}
+	if !strings.Contains(refs[0].text, "Compacted result of get_project_logs") {
+		t.Errorf("oldest result not compacted: %.80q", refs[0].text)
+	}
+	if refs[2].text != big {
+		t.Error("most recent result was compacted")
+	}
+	if manager.estimatedTokens >= 30000 {
+		t.Errorf("estimatedTokens = %d, want below threshold", manager.estimatedTokens)
+	}
+
+	// Originals are recallable and the input messages are left untouched
+	if stored, ok := store.Get("call-1"); !ok || stored.Text != big {
+		t.Error("original result of call-1 not stored")
+	}
+	if toolResultRefs(messages)[0].text != big {
+		t.Error("input messages were modified")
+	}
+
+	// Summaries are re-applied on later steps even below the threshold
+	_, prepared, _ = prepare(context.Background(), fantasy.PrepareStepFunctionOptions{Messages: messages})
+	if refs := toolResultRefs(prepared.Messages); !strings.HasPrefix(refs[0].text, "[Compacted") {
+		t.Error("summary not re-applied on the next step")
+	}
+}
+
+func TestContextManagerBelowThreshold(t *testing.T) {
+	messages := append([]fantasy.Message{fantasy.NewUserMessage("hi")}, toolRoundTrip("call-1", "list_projects", "[]")...)
+	manager := newContextManager(CompactionOptions{ThresholdTokens: 1000, KeepRecent: 0}, nil, tools.NewToolResultStore(), nil)
+
+	_, prepared, err := manager.prepareStep()(context.Background(), fantasy.PrepareStepFunctionOptions{Messages: messages})
+	if err != nil {
+		t.Fatalf("prepareStep() error = %v", err)
+	}
+	if prepared.Messages != nil {
+		t.Error("prepareStep() compacted messages below the threshold")
+	}
+}
+
+// summaryModel is a LanguageModel that answers every call with a fixed summary.
+type summaryModel struct {
+	fantasy.LanguageModel
+}
+
+func (m *summaryModel) Provider() string { return "fake" }
+func (m *summaryModel) Model() string    { return "summarizer" }
+
+func (m *summaryModel) Generate(context.Context, fantasy.Call) (*fantasy.Response, error) {
+	return &fantasy.Response{
+		Content: fantasy.ResponseContent{fantasy.TextContent{Text: "connection refused"}},
+		Usage:   fantasy.Usage{InputTokens: 900, OutputTokens: 100, TotalTokens: 1000},
+	}, nil
+}
+
+func TestContextManagerChargesLLMSummaries(t *testing.T) {
+	big := strings.Repeat("2026-10-18T10:00:00Z ERROR connection refused\n", 2000)
+	messages := append([]fantasy.Message{fantasy.NewUserMessage("why is payments failing?")}, toolRoundTrip("call-1", "get_project_logs", big)...)
+
+	usage := &pendingUsage{price: func(model string, u fantasy.Usage) Usage {
+		return Usage{TotalTokens: u.TotalTokens, CostUSD: map[string]float64{"fake:summarizer": 0.01}[model]}
+	}}
+	manager := newContextManager(CompactionOptions{ThresholdTokens: 1000, Summarizer: "llm"}, &summaryModel{}, tools.NewToolResultStore(), usage.add)
+
+	if _, _, err := manager.prepareStep()(context.Background(), fantasy.PrepareStepFunctionOptions{Messages: messages}); err != nil {
+		t.Fatalf("prepareStep() error = %v", err)
+	}
+	if got := usage.take(); got.TotalTokens != 1000 || got.CostUSD != 0.01 {
+		t.Errorf("charged usage = %+v, want the summary's usage priced for fake:summarizer", got)
+	}
+	if got := usage.take(); got != (Usage{}) {
+		t.Errorf("take() again = %+v, want zero", got)
+	}
+}
+
+func TestHeuristicSummaryKeepsRunesWhole(t *testing.T) {
+	text := "é" + strings.Repeat("日本", 1000)
+	summary := heuristicSummary(text)
+	if !utf8.ValidString(summary) {
+		t.Errorf("summary is not valid UTF-8: %q", summary[:20])
+	}
+	if !strings.HasPrefix(summary, "Preview (1 lines total):\né日本") || !strings.HasSuffix(summary, "日本") {
+		t.Errorf("summary = %.60q...", summary)
+	}
+}
+
+func TestSummarizeCountsCharacters(t *testing.T) {
+	text := strings.Repeat("日本", 1000)
+	manager := newContextManager(CompactionOptions{}, nil, tools.NewToolResultStore(), nil)
+	summary := manager.summarize(context.Background(), toolResultRef{toolName: "get_project_logs", toolCallID: "call-1", text: text})
+	if !strings.Contains(summary, "(tool_call_id: call-1, 2000 characters)") {
+		t.Errorf("summary header = %.100q", summary)
+	}
+}
@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// Entities are the organizations, projects and components an analysis looked at, as
+// named in the arguments of its tool calls.
+type Entities struct {
+	Organizations []string `json:"organizations,omitempty"`
+	Projects      []string `json:"projects,omitempty"`
+	Components    []string `json:"components,omitempty"`
+}
+
+// add records the entities named in a tool call's arguments. Argument names are
+// matched regardless of case and separators, e.g. componentName and component_name.
+func (e *Entities) add(input string) {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return
+	}
+	for key, value := range args {
+		name, ok := value.(string)
+		if !ok || name == "" {
+			continue
+		}
+		switch strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key)) {
+		case "org", "orgname", "organization", "organizationname":
+			e.Organizations = appendUnique(e.Organizations, name)
+		case "project", "projectname":
+			e.Projects = appendUnique(e.Projects, name)
+		case "component", "componentname":
+			e.Components = appendUnique(e.Components, name)
+		}
+	}
+}
+
+func appendUnique(list []string, s string) []string {
+	if slices.Contains(list, s) {
+		return list
+	}
+	return append(list, s)
+}
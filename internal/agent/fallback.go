@@ -0,0 +1,338 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"charm.land/fantasy"
+	"charm.land/fantasy/providers/anthropic"
+	"charm.land/fantasy/providers/google"
+
+	"rca.agent/test/internal/mcp"
+)
+
+// RetryPolicy configures retries of transient provider errors for each model in a fallback chain.
+type RetryPolicy struct {
+	MaxRetries   int           // Retries per model before moving to the next one
+	InitialDelay time.Duration // Base delay for exponential backoff
+	MaxDelay     time.Duration // Upper bound for a single backoff delay
+}
+
+// fallbackModel is a fantasy.LanguageModel that tries an ordered chain of models.
+// Transient errors (429, 5xx, overloaded) are retried with exponential backoff and
+// jitter, honoring Retry-After, before falling through to the next model in the chain.
+type fallbackModel struct {
+	models []fantasy.LanguageModel
+	policy RetryPolicy
+	// compatReasoningModels are the OpenAI-compatible models sent a reasoning effort
+	compatReasoningModels []string
+}
+
+// newFallbackModel wraps the given models, in order of preference, into a single model.
+func newFallbackModel(models []fantasy.LanguageModel, policy RetryPolicy) *fallbackModel {
+	return &fallbackModel{models: models, policy: policy}
+}
+
+func (f *fallbackModel) Provider() string {
+	return f.models[0].Provider()
+}
+
+func (f *fallbackModel) Model() string {
+	return f.models[0].Model()
+}
+
+func (f *fallbackModel) Generate(ctx context.Context, call fantasy.Call) (*fantasy.Response, error) {
+	return withFallback(ctx, f, func(m fantasy.LanguageModel) (*fantasy.Response, error) {
+		call := call
+		call.ProviderOptions = modelProviderOptions(m, call.ProviderOptions, f.compatReasoningModels)
+		return m.Generate(ctx, call)
+	})
+}
+
+// GenerateServed generates a response like Generate, and returns the model that
+// served it ("provider:model"), so that MCP sampling is charged to that model.
+func (f *fallbackModel) GenerateServed(ctx context.Context, call fantasy.Call) (*fantasy.Response, string, error) {
+	ctx, recorder := withStepRecorder(ctx)
+	resp, err := f.Generate(ctx, call)
+	return resp, recorder.lastServed(), err
+}
+
+func (f *fallbackModel) GenerateObject(ctx context.Context, call fantasy.ObjectCall) (*fantasy.ObjectResponse, error) {
+	return withFallback(ctx, f, func(m fantasy.LanguageModel) (*fantasy.ObjectResponse, error) {
+		call := call
+		call.ProviderOptions = modelProviderOptions(m, call.ProviderOptions, f.compatReasoningModels)
+		return m.GenerateObject(ctx, call)
+	})
+}
+
+func (f *fallbackModel) StreamObject(ctx context.Context, call fantasy.ObjectCall) (fantasy.ObjectStreamResponse, error) {
+	return withFallback(ctx, f, func(m fantasy.LanguageModel) (fantasy.ObjectStreamResponse, error) {
+		call := call
+		call.ProviderOptions = modelProviderOptions(m, call.ProviderOptions, f.compatReasoningModels)
+		return m.StreamObject(ctx, call)
+	})
+}
+
+// Stream opens a stream on the first model that responds. Providers usually report
+// request failures as a stream part rather than as an error from Stream, possibly
+// after parts such as warnings, so parts are held back until the first one with
+// content, and replayed to the caller once the stream is known to be good.
+func (f *fallbackModel) Stream(ctx context.Context, call fantasy.Call) (fantasy.StreamResponse, error) {
+	return withFallback(ctx, f, func(m fantasy.LanguageModel) (fantasy.StreamResponse, error) {
+		call := call
+		call.ProviderOptions = modelProviderOptions(m, call.ProviderOptions, f.compatReasoningModels)
+		stream, err := m.Stream(ctx, call)
+		if err != nil {
+			return nil, err
+		}
+
+		next, stop := iter.Pull(iter.Seq[fantasy.StreamPart](stream))
+		var held []fantasy.StreamPart
+		for {
+			part, ok := next()
+			if !ok {
+				break
+			}
+			if part.Type == fantasy.StreamPartTypeError {
+				stop()
+				return nil, part.Error
+			}
+			held = append(held, part)
+			if !isStreamPreamble(part) {
+				break
+			}
+		}
+
+		return func(yield func(fantasy.StreamPart) bool) {
+			defer stop()
+			for _, part := range held {
+				if !yield(part) {
+					return
+				}
+			}
+			for {
+				part, ok := next()
+				if !ok || !yield(part) {
+					return
+				}
+			}
+		}, nil
+	})
+}
+
+// isStreamPreamble reports whether a stream part may precede a request failure: it
+// carries no content the model generated yet.
+func isStreamPreamble(part fantasy.StreamPart) bool {
+	switch part.Type {
+	case fantasy.StreamPartTypeWarnings,
+		fantasy.StreamPartTypeSource,
+		fantasy.StreamPartTypeTextStart,
+		fantasy.StreamPartTypeReasoningStart,
+		fantasy.StreamPartTypeToolInputStart:
+		return true
+	}
+	return false
+}
+
+// withFallback runs fn against each model in the chain until one succeeds, retrying
+// transient errors per the retry policy. The model that served the call is recorded
+// on the context's step recorder, if any.
+func withFallback[T any](ctx context.Context, f *fallbackModel, fn func(fantasy.LanguageModel) (T, error)) (T, error) {
+	var zero T
+	var errs []error
+
+	for i, m := range f.models {
+		name := modelName(m)
+		delay := f.policy.InitialDelay
+
+		for attempt := 0; ; attempt++ {
+			result, err := fn(m)
+			if err == nil {
+				if attempt > 0 || i > 0 {
+					slog.Info("Model call succeeded", "model", name, "attempt", attempt+1)
+				}
+				recordServedModel(ctx, name)
+				return result, nil
+			}
+
+			if ctx.Err() != nil {
+				return zero, ctx.Err()
+			}
+
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			if !isTransientError(err) {
+				// A non-transient error (bad request, auth) will not go away by retrying the same model
+				slog.Warn("Model call failed", "model", name, "error", err)
+				break
+			}
+			if attempt >= f.policy.MaxRetries {
+				slog.Warn("Model retries exhausted", "model", name, "attempts", attempt+1, "error", err)
+				break
+			}
+
+			wait := backoffWithJitter(delay, f.policy.MaxDelay)
+			if retryAfter, ok := retryAfterDelay(err); ok {
+				if retryAfter > f.policy.MaxDelay && i < len(f.models)-1 {
+					// Don't sit out a long rate limit while another model is available
+					slog.Warn("Model rate limited", "model", name, "retry_after", retryAfter)
+					break
+				}
+				wait = min(retryAfter, f.policy.MaxDelay)
+			}
+
+			slog.Warn("Model call failed, retrying", "model", name, "attempt", attempt+1, "delay", wait, "error", err)
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return zero, ctx.Err()
+			}
+			delay *= 2
+		}
+	}
+
+	return zero, fmt.Errorf("all models failed: %w", errors.Join(errs...))
+}
+
+// isTransientError reports whether err is worth retrying or falling back on.
+// Provider errors are transient for timeouts, conflicts, rate limits, server errors
+// and overload; other errors (network failures) are treated as transient as well.
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var providerErr *fantasy.ProviderError
+	if !errors.As(err, &providerErr) {
+		return true
+	}
+
+	switch code := providerErr.StatusCode; {
+	case code == http.StatusRequestTimeout,
+		code == http.StatusConflict,
+		code == http.StatusTooManyRequests,
+		code >= http.StatusInternalServerError:
+		return true
+	case code == 0:
+		// Stream errors without a status code (e.g. Anthropic "overloaded_error" events)
+		return strings.Contains(strings.ToLower(providerErr.Error()), "overloaded")
+	default:
+		return false
+	}
+}
+
+// retryAfterDelay extracts the delay requested by the provider via the
+// retry-after-ms or Retry-After response headers.
+func retryAfterDelay(err error) (time.Duration, bool) {
+	var providerErr *fantasy.ProviderError
+	if !errors.As(err, &providerErr) {
+		return 0, false
+	}
+
+	// retry-after-ms is more precise than Retry-After and is preferred when present
+	for k, v := range providerErr.ResponseHeaders {
+		if strings.ToLower(k) != "retry-after-ms" {
+			continue
+		}
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms >= 0 {
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+	}
+
+	for k, v := range providerErr.ResponseHeaders {
+		if strings.ToLower(k) != "retry-after" {
+			continue
+		}
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil && seconds >= 0 {
+			return time.Duration(seconds * float64(time.Second)), true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return max(time.Until(t), 0), true
+		}
+	}
+
+	return 0, false
+}
+
+// backoffWithJitter returns a delay between half and all of base, capped at maxDelay.
+func backoffWithJitter(base, maxDelay time.Duration) time.Duration {
+	base = min(base, maxDelay)
+	if base <= 0 {
+		return 0
+	}
+	half := base / 2
+	return half + rand.N(half+1)
+}
+
+// supportsMediaToolResults reports whether every model that may serve a step accepts
+// images in tool results. Only the Anthropic provider forwards media tool results;
+// the others drop them, which would leave the tool call without a result.
+func supportsMediaToolResults(m fantasy.LanguageModel) bool {
+	models := []fantasy.LanguageModel{m}
+	if f, ok := m.(*fallbackModel); ok {
+		models = f.models
+	}
+	for _, m := range models {
+		if m.Provider() != anthropic.Name {
+			return false
+		}
+	}
+	return true
+}
+
+// toolSchemaDialect returns the tool schema dialect every model that may serve a step
+// understands: the Gemini subset if any of them is a Google model.
+func toolSchemaDialect(m fantasy.LanguageModel) mcp.SchemaDialect {
+	models := []fantasy.LanguageModel{m}
+	if f, ok := m.(*fallbackModel); ok {
+		models = f.models
+	}
+	for _, m := range models {
+		if m.Provider() == google.Name {
+			return mcp.SchemaDialectGemini
+		}
+	}
+	return mcp.SchemaDialectJSON
+}
+
+// modelName returns the "provider:model" identifier of a language model.
+func modelName(m fantasy.LanguageModel) string {
+	return m.Provider() + ":" + m.Model()
+}
+
+// stepRecorder tracks which model served each step of a single analysis.
+type stepRecorder struct {
+	mu     sync.Mutex
+	served string
+}
+
+type stepRecorderKey struct{}
+
+// withStepRecorder returns a context that records the models serving calls made with it.
+func withStepRecorder(ctx context.Context) (context.Context, *stepRecorder) {
+	rec := &stepRecorder{}
+	return context.WithValue(ctx, stepRecorderKey{}, rec), rec
+}
+
+func recordServedModel(ctx context.Context, name string) {
+	if rec, ok := ctx.Value(stepRecorderKey{}).(*stepRecorder); ok {
+		rec.mu.Lock()
+		rec.served = name
+		rec.mu.Unlock()
+	}
+}
+
+// lastServed returns the model that served the most recent call.
+func (r *stepRecorder) lastServed() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.served
+}
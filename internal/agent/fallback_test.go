@@ -0,0 +1,199 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+)
+
+// fakeModel is a LanguageModel that fails with the queued errors before succeeding.
+type fakeModel struct {
+	fantasy.LanguageModel
+	name     string
+	errs     []error
+	calls    int
+	warnings bool // Streams start with a warnings part, also when failing
+}
+
+func (m *fakeModel) Provider() string { return "fake" }
+func (m *fakeModel) Model() string    { return m.name }
+
+func (m *fakeModel) Generate(ctx context.Context, call fantasy.Call) (*fantasy.Response, error) {
+	m.calls++
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		return nil, err
+	}
+	return &fantasy.Response{}, nil
+}
+
+func (m *fakeModel) Stream(ctx context.Context, call fantasy.Call) (fantasy.StreamResponse, error) {
+	m.calls++
+	var err error
+	if len(m.errs) > 0 {
+		err = m.errs[0]
+		m.errs = m.errs[1:]
+	}
+	return func(yield func(fantasy.StreamPart) bool) {
+		if m.warnings && !yield(fantasy.StreamPart{Type: fantasy.StreamPartTypeWarnings, Warnings: []fantasy.CallWarning{{Message: "unsupported setting"}}}) {
+			return
+		}
+		if err != nil {
+			yield(fantasy.StreamPart{Type: fantasy.StreamPartTypeError, Error: err})
+			return
+		}
+		if !yield(fantasy.StreamPart{Type: fantasy.StreamPartTypeTextDelta, Delta: m.name}) {
+			return
+		}
+		yield(fantasy.StreamPart{Type: fantasy.StreamPartTypeFinish})
+	}, nil
+}
+
+func providerErr(status int, headers map[string]string) error {
+	return &fantasy.ProviderError{Message: http.StatusText(status), StatusCode: status, ResponseHeaders: headers}
+}
+
+var testPolicy = RetryPolicy{MaxRetries: 1, InitialDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+func TestFallbackModelRetriesThenFallsBack(t *testing.T) {
+	primary := &fakeModel{name: "primary", errs: []error{
+		providerErr(http.StatusTooManyRequests, nil),
+		providerErr(http.StatusServiceUnavailable, nil),
+	}}
+	secondary := &fakeModel{name: "secondary"}
+	model := newFallbackModel([]fantasy.LanguageModel{primary, secondary}, testPolicy)
+
+	ctx, rec := withStepRecorder(context.Background())
+	if _, err := model.Generate(ctx, fantasy.Call{}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if primary.calls != 2 {
+		t.Errorf("primary calls = %d, want 2", primary.calls)
+	}
+	if got := rec.lastServed(); got != "fake:secondary" {
+		t.Errorf("lastServed() = %q, want %q", got, "fake:secondary")
+	}
+}
+
+func TestFallbackModelNonTransientError(t *testing.T) {
+	primary := &fakeModel{name: "primary", errs: []error{providerErr(http.StatusBadRequest, nil)}}
+	secondary := &fakeModel{name: "secondary"}
+	model := newFallbackModel([]fantasy.LanguageModel{primary, secondary}, testPolicy)
+
+	if _, err := model.Generate(context.Background(), fantasy.Call{}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if primary.calls != 1 {
+		t.Errorf("primary calls = %d, want 1 (no retry on 400)", primary.calls)
+	}
+}
+
+func TestFallbackModelGenerateServed(t *testing.T) {
+	primary := &fakeModel{name: "primary", errs: []error{providerErr(http.StatusServiceUnavailable, nil), providerErr(http.StatusServiceUnavailable, nil)}}
+	model := newFallbackModel([]fantasy.LanguageModel{primary, &fakeModel{name: "secondary"}}, testPolicy)
+
+	// Sampling goes through GenerateServed, with no analysis' step recorder to read from
+	_, served, err := model.GenerateServed(context.Background(), fantasy.Call{})
+	if err != nil {
+		t.Fatalf("GenerateServed() error = %v", err)
+	}
+	if served != "fake:secondary" {
+		t.Errorf("served = %q, want %q", served, "fake:secondary")
+	}
+}
+
+func TestFallbackModelStreamPeeksFirstPart(t *testing.T) {
+	primary := &fakeModel{name: "primary", errs: []error{
+		providerErr(529, nil),
+		providerErr(529, nil),
+	}}
+	secondary := &fakeModel{name: "secondary"}
+	model := newFallbackModel([]fantasy.LanguageModel{primary, secondary}, testPolicy)
+
+	stream, err := model.Stream(context.Background(), fantasy.Call{})
+	if err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+
+	var text string
+	for part := range stream {
+		if part.Type == fantasy.StreamPartTypeError {
+			t.Fatalf("unexpected error part: %v", part.Error)
+		}
+		text += part.Delta
+	}
+	if text != "secondary" {
+		t.Errorf("streamed text = %q, want %q", text, "secondary")
+	}
+}
+
+func TestFallbackModelStreamErrorAfterWarnings(t *testing.T) {
+	primary := &fakeModel{name: "primary", warnings: true, errs: []error{
+		providerErr(http.StatusTooManyRequests, nil),
+		providerErr(http.StatusInternalServerError, nil),
+	}}
+	secondary := &fakeModel{name: "secondary", warnings: true}
+	model := newFallbackModel([]fantasy.LanguageModel{primary, secondary}, testPolicy)
+
+	stream, err := model.Stream(context.Background(), fantasy.Call{})
+	if err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+
+	var types []fantasy.StreamPartType
+	var text string
+	for part := range stream {
+		if part.Type == fantasy.StreamPartTypeError {
+			t.Fatalf("unexpected error part: %v", part.Error)
+		}
+		types = append(types, part.Type)
+		text += part.Delta
+	}
+	if primary.calls != 2 {
+		t.Errorf("primary calls = %d, want 2", primary.calls)
+	}
+	if text != "secondary" {
+		t.Errorf("streamed text = %q, want %q", text, "secondary")
+	}
+	// The serving model's warnings are replayed, the failed attempts' are not
+	if len(types) != 3 || types[0] != fantasy.StreamPartTypeWarnings {
+		t.Errorf("part types = %v", types)
+	}
+}
+
+func TestFallbackModelAllFail(t *testing.T) {
+	primary := &fakeModel{name: "primary", errs: []error{providerErr(http.StatusUnauthorized, nil)}}
+	model := newFallbackModel([]fantasy.LanguageModel{primary}, testPolicy)
+
+	if _, err := model.Generate(context.Background(), fantasy.Call{}); err == nil {
+		t.Fatal("Generate() error = nil, want error")
+	}
+}
+
+func TestRetryAfterDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    time.Duration
+		wantOK  bool
+	}{
+		{"seconds", map[string]string{"Retry-After": "3"}, 3 * time.Second, true},
+		{"lowercase", map[string]string{"retry-after": "1.5"}, 1500 * time.Millisecond, true},
+		{"milliseconds preferred", map[string]string{"retry-after-ms": "250", "retry-after": "9"}, 250 * time.Millisecond, true},
+		{"missing", map[string]string{"x-request-id": "abc"}, 0, false},
+		{"invalid", map[string]string{"Retry-After": "soon"}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := retryAfterDelay(providerErr(http.StatusTooManyRequests, tt.headers))
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("retryAfterDelay() = (%v, %v), want (%v, %v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
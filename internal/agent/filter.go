@@ -1,14 +1,8 @@
 package agent
 
-import (
-	"slices"
-
-	"charm.land/fantasy"
-
-	"rca.agent/test/internal/mcp"
-)
-
-// allowedMCPTools is the list of MCP tools allowed for the agent.
+// allowedMCPTools is the list of MCP tools allowed for the agent, as "server/tool" or
+// just the tool name. A bare name allows the tool on the first server (by name) that
+// exposes it.
 var allowedMCPTools = []string{
 	// Observability
 	"get_traces",
@@ -21,14 +15,3 @@ var allowedMCPTools = []string{
 	"list_projects",
 	"list_components",
 }
-
-// filterMCPTools returns only the allowed tools as AgentTools.
-func filterMCPTools(tools []*mcp.Tool) []fantasy.AgentTool {
-	filtered := make([]fantasy.AgentTool, 0, len(allowedMCPTools))
-	for _, t := range tools {
-		if slices.Contains(allowedMCPTools, t.Name()) {
-			filtered = append(filtered, t)
-		}
-	}
-	return filtered
-}
@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"charm.land/fantasy"
+	"charm.land/fantasy/providers/anthropic"
+	"charm.land/fantasy/providers/google"
+	"charm.land/fantasy/providers/openai"
+	"charm.land/fantasy/providers/openaicompat"
+
+	"rca.agent/test/internal/config"
+)
+
+// GenerationParams controls sampling and reasoning for the model.
+// Unset fields fall back to the configured defaults, then to the provider defaults.
+type GenerationParams struct {
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"top_p,omitempty"`
+	MaxOutputTokens *int64   `json:"max_output_tokens,omitempty"`
+	// ReasoningEffort is "minimal", "low", "medium" or "high". It maps to the OpenAI
+	// reasoning effort ("minimal" becoming "low" for the o-series) and, when
+	// ThinkingBudget is unset, to a Claude/Gemini thinking budget.
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+	// ThinkingBudget is the Claude extended thinking / Gemini thinking token budget.
+	ThinkingBudget *int64 `json:"thinking_budget,omitempty"`
+}
+
+// minThinkingBudget is the smallest thinking budget Anthropic accepts.
+const minThinkingBudget = 1024
+
+// thinkingBudgets maps reasoning effort levels to thinking token budgets
+// for providers that take a budget rather than an effort level.
+var thinkingBudgets = map[string]int64{
+	"minimal": minThinkingBudget,
+	"low":     2048,
+	"medium":  8192,
+	"high":    24576,
+}
+
+// generationParamsFromConfig returns the configured default generation parameters.
+func generationParamsFromConfig(cfg *config.Config) GenerationParams {
+	return GenerationParams{
+		Temperature:     cfg.ModelTemperature,
+		TopP:            cfg.ModelTopP,
+		MaxOutputTokens: cfg.ModelMaxOutputTokens,
+		ReasoningEffort: cfg.ModelReasoningEffort,
+		ThinkingBudget:  cfg.ModelThinkingBudget,
+	}
+}
+
+// Validate checks that the parameters are within the ranges accepted by providers.
+func (p GenerationParams) Validate() error {
+	if p.Temperature != nil && (*p.Temperature < 0 || *p.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if p.TopP != nil && (*p.TopP <= 0 || *p.TopP > 1) {
+		return fmt.Errorf("top_p must be in (0, 1]")
+	}
+	if p.MaxOutputTokens != nil && *p.MaxOutputTokens <= 0 {
+		return fmt.Errorf("max_output_tokens must be positive")
+	}
+	if p.ThinkingBudget != nil && (*p.ThinkingBudget < 0 || *p.ThinkingBudget > 0 && *p.ThinkingBudget < minThinkingBudget) {
+		return fmt.Errorf("thinking_budget must be 0 (no thinking) or at least %d tokens, got %d", minThinkingBudget, *p.ThinkingBudget)
+	}
+	if _, ok := thinkingBudgets[p.ReasoningEffort]; p.ReasoningEffort != "" && !ok {
+		return fmt.Errorf("invalid reasoning_effort %q", p.ReasoningEffort)
+	}
+	return nil
+}
+
+// withOverrides returns p with every field set in override replacing the default.
+func (p GenerationParams) withOverrides(override GenerationParams) GenerationParams {
+	if override.Temperature != nil {
+		p.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		p.TopP = override.TopP
+	}
+	if override.MaxOutputTokens != nil {
+		p.MaxOutputTokens = override.MaxOutputTokens
+	}
+	if override.ReasoningEffort != "" {
+		p.ReasoningEffort = override.ReasoningEffort
+	}
+	if override.ThinkingBudget != nil {
+		p.ThinkingBudget = override.ThinkingBudget
+	}
+	return p
+}
+
+// providerOptions maps reasoning settings to each provider's options. Options for
+// every provider are set at once so they apply to whichever model in the fallback
+// chain serves the step; each provider only reads its own entry, and
+// modelProviderOptions drops what a model does not accept.
+func (p GenerationParams) providerOptions() fantasy.ProviderOptions {
+	budget := p.ThinkingBudget
+	if budget == nil && p.ReasoningEffort != "" {
+		b := thinkingBudgets[p.ReasoningEffort]
+		budget = &b
+	}
+
+	opts := fantasy.ProviderOptions{}
+
+	if p.ReasoningEffort != "" {
+		effort := openai.ReasoningEffortOption(openai.ReasoningEffort(p.ReasoningEffort))
+		opts[openai.Name] = &openai.ProviderOptions{ReasoningEffort: effort}
+		opts[openaicompat.Name] = &openaicompat.ProviderOptions{ReasoningEffort: effort}
+	}
+
+	if budget != nil && *budget > 0 {
+		opts[anthropic.Name] = &anthropic.ProviderOptions{
+			Thinking: &anthropic.ThinkingProviderOption{BudgetTokens: *budget},
+		}
+		includeThoughts := true
+		opts[google.Name] = &google.ProviderOptions{
+			ThinkingConfig: &google.ThinkingConfig{
+				ThinkingBudget:  budget,
+				IncludeThoughts: &includeThoughts,
+			},
+		}
+	}
+
+	if len(opts) == 0 {
+		return nil
+	}
+	return opts
+}
+
+// modelProviderOptions returns the provider options of a call for one model of the
+// fallback chain. OpenAI rejects a reasoning effort for models that do not reason,
+// such as gpt-4o and gpt-4.1, so it is dropped for them, and "minimal" for the
+// o-series, which get "low" instead. OpenAI-compatible models are only sent a
+// reasoning effort if listed in compatReasoningModels.
+func modelProviderOptions(m fantasy.LanguageModel, opts fantasy.ProviderOptions, compatReasoningModels []string) fantasy.ProviderOptions {
+	switch m.Provider() {
+	case openai.Name:
+		o, ok := opts[openai.Name].(*openai.ProviderOptions)
+		if !ok || o.ReasoningEffort == nil {
+			return opts
+		}
+		switch {
+		case !isOpenAIReasoningModel(m.Model()):
+			withoutEffort := *o
+			withoutEffort.ReasoningEffort = nil
+			return withProviderOptions(opts, openai.Name, &withoutEffort)
+		case *o.ReasoningEffort == openai.ReasoningEffortMinimal && isOpenAIOSeriesModel(m.Model()):
+			low := *o
+			low.ReasoningEffort = openai.ReasoningEffortOption(openai.ReasoningEffortLow)
+			return withProviderOptions(opts, openai.Name, &low)
+		}
+
+	case openaicompat.Name:
+		o, ok := opts[openaicompat.Name].(*openaicompat.ProviderOptions)
+		if ok && o.ReasoningEffort != nil && !slices.Contains(compatReasoningModels, m.Model()) {
+			withoutEffort := *o
+			withoutEffort.ReasoningEffort = nil
+			return withProviderOptions(opts, openaicompat.Name, &withoutEffort)
+		}
+	}
+	return opts
+}
+
+// withProviderOptions returns a copy of opts with the options of one provider replaced.
+func withProviderOptions(opts fantasy.ProviderOptions, provider string, o fantasy.ProviderOptionsData) fantasy.ProviderOptions {
+	opts = maps.Clone(opts)
+	opts[provider] = o
+	return opts
+}
+
+// isOpenAIReasoningModel reports whether an OpenAI model takes a reasoning effort:
+// the o-series and gpt-5 models, except gpt-5-chat.
+func isOpenAIReasoningModel(id string) bool {
+	if isOpenAIOSeriesModel(id) {
+		return true
+	}
+	if strings.Contains(id, "gpt-5") {
+		return !strings.Contains(id, "gpt-5-chat")
+	}
+	return strings.Contains(id, "codex-")
+}
+
+// isOpenAIOSeriesModel reports whether an OpenAI model is of the o-series, which
+// takes a reasoning effort of low, medium or high only.
+func isOpenAIOSeriesModel(id string) bool {
+	for _, series := range []string{"o1", "o3", "o4"} {
+		if strings.HasPrefix(id, series) || strings.Contains(id, "-"+series) {
+			return true
+		}
+	}
+	return false
+}
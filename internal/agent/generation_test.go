@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"charm.land/fantasy"
+	"charm.land/fantasy/providers/anthropic"
+	"charm.land/fantasy/providers/google"
+	"charm.land/fantasy/providers/openai"
+	"charm.land/fantasy/providers/openaicompat"
+)
+
+func TestGenerationParamsWithOverrides(t *testing.T) {
+	temp, override := 0.7, 0.0
+	defaults := GenerationParams{Temperature: &temp, ReasoningEffort: "low"}
+
+	got := defaults.withOverrides(GenerationParams{Temperature: &override})
+	if got.Temperature == nil || *got.Temperature != 0 {
+		t.Errorf("Temperature = %v, want 0", got.Temperature)
+	}
+	if got.ReasoningEffort != "low" {
+		t.Errorf("ReasoningEffort = %q, want %q", got.ReasoningEffort, "low")
+	}
+}
+
+func TestGenerationParamsProviderOptions(t *testing.T) {
+	if opts := (GenerationParams{}).providerOptions(); opts != nil {
+		t.Errorf("providerOptions() = %v, want nil", opts)
+	}
+
+	opts := GenerationParams{ReasoningEffort: "high"}.providerOptions()
+
+	oai, ok := opts[openai.Name].(*openai.ProviderOptions)
+	if !ok || oai.ReasoningEffort == nil || *oai.ReasoningEffort != openai.ReasoningEffortHigh {
+		t.Errorf("openai options = %+v, want reasoning effort high", opts[openai.Name])
+	}
+	claude, ok := opts[anthropic.Name].(*anthropic.ProviderOptions)
+	if !ok || claude.Thinking == nil || claude.Thinking.BudgetTokens != thinkingBudgets["high"] {
+		t.Errorf("anthropic options = %+v, want thinking budget %d", opts[anthropic.Name], thinkingBudgets["high"])
+	}
+	gemini, ok := opts[google.Name].(*google.ProviderOptions)
+	if !ok || gemini.ThinkingConfig == nil || *gemini.ThinkingConfig.ThinkingBudget != thinkingBudgets["high"] {
+		t.Errorf("google options = %+v, want thinking budget %d", opts[google.Name], thinkingBudgets["high"])
+	}
+}
+
+// openAIModel is an OpenAI model that records the reasoning effort of its calls and
+// fails with the queued errors.
+type openAIModel struct {
+	fantasy.LanguageModel
+	id     string
+	errs   []error
+	effort *openai.ReasoningEffort
+}
+
+func (m *openAIModel) Provider() string { return openai.Name }
+func (m *openAIModel) Model() string    { return m.id }
+
+func (m *openAIModel) Generate(_ context.Context, call fantasy.Call) (*fantasy.Response, error) {
+	if o, ok := call.ProviderOptions[openai.Name].(*openai.ProviderOptions); ok {
+		m.effort = o.ReasoningEffort
+	}
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		return nil, err
+	}
+	return &fantasy.Response{}, nil
+}
+
+func TestModelProviderOptions(t *testing.T) {
+	opts := GenerationParams{ReasoningEffort: "high"}.providerOptions()
+	for _, tt := range []struct {
+		model      fantasy.LanguageModel
+		wantEffort bool
+	}{
+		{&openAIModel{id: "o3-mini"}, true},
+		{&openAIModel{id: "gpt-5-mini"}, true},
+		{&openAIModel{id: "gpt-5-chat-latest"}, false},
+		{&openAIModel{id: "gpt-4o"}, false},
+		{&openAIModel{id: "gpt-4.1-2025-04-14"}, false},
+	} {
+		got := modelProviderOptions(tt.model, opts, nil)[openai.Name].(*openai.ProviderOptions)
+		if (got.ReasoningEffort != nil) != tt.wantEffort {
+			t.Errorf("%s reasoning effort = %v, want set: %v", tt.model.Model(), got.ReasoningEffort, tt.wantEffort)
+		}
+	}
+	if opts[openai.Name].(*openai.ProviderOptions).ReasoningEffort == nil {
+		t.Error("modelProviderOptions() changed the call's options")
+	}
+	if got := modelProviderOptions(&fakeModel{name: "claude"}, opts, nil); got[anthropic.Name] != opts[anthropic.Name] {
+		t.Errorf("options of other providers = %v, want them as is", got)
+	}
+
+	// Each model of the fallback chain gets the options it accepts
+	primary := &openAIModel{id: "gpt-4.1", errs: []error{providerErr(http.StatusServiceUnavailable, nil), providerErr(http.StatusServiceUnavailable, nil)}}
+	secondary := &openAIModel{id: "o3"}
+	model := newFallbackModel([]fantasy.LanguageModel{primary, secondary}, testPolicy)
+	if _, err := model.Generate(context.Background(), fantasy.Call{ProviderOptions: opts}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if primary.effort != nil || secondary.effort == nil || *secondary.effort != openai.ReasoningEffortHigh {
+		t.Errorf("reasoning effort sent to gpt-4.1 = %v, to o3 = %v", primary.effort, secondary.effort)
+	}
+}
+
+// compatModel is an OpenAI-compatible model.
+type compatModel struct {
+	fantasy.LanguageModel
+	id string
+}
+
+func (m *compatModel) Provider() string { return openaicompat.Name }
+func (m *compatModel) Model() string    { return m.id }
+
+func TestModelProviderOptionsReasoningEffort(t *testing.T) {
+	opts := GenerationParams{ReasoningEffort: "minimal"}.providerOptions()
+	for _, tt := range []struct {
+		id   string
+		want openai.ReasoningEffort
+	}{
+		{"o3-mini", openai.ReasoningEffortLow},
+		{"o4-mini", openai.ReasoningEffortLow},
+		{"gpt-5-mini", openai.ReasoningEffortMinimal},
+	} {
+		got := modelProviderOptions(&openAIModel{id: tt.id}, opts, nil)[openai.Name].(*openai.ProviderOptions)
+		if got.ReasoningEffort == nil || *got.ReasoningEffort != tt.want {
+			t.Errorf("%s reasoning effort = %v, want %s", tt.id, got.ReasoningEffort, tt.want)
+		}
+	}
+
+	// OpenAI-compatible models are sent an effort only if configured to take one
+	reasoning := []string{"qwen3-32b"}
+	for id, want := range map[string]bool{"qwen3-32b": true, "llama-3.3-70b": false} {
+		got := modelProviderOptions(&compatModel{id: id}, opts, reasoning)[openaicompat.Name].(*openaicompat.ProviderOptions)
+		if (got.ReasoningEffort != nil) != want {
+			t.Errorf("%s reasoning effort = %v, want set: %v", id, got.ReasoningEffort, want)
+		}
+	}
+}
+
+func TestGenerationParamsValidate(t *testing.T) {
+	bad, good := 3.0, 0.0
+	if err := (GenerationParams{Temperature: &bad}).Validate(); err == nil {
+		t.Error("Validate() with temperature 3 = nil, want error")
+	}
+	if err := (GenerationParams{ReasoningEffort: "extreme"}).Validate(); err == nil {
+		t.Error("Validate() with reasoning_effort extreme = nil, want error")
+	}
+	for _, budget := range []int64{-1, 1, 1023} {
+		if err := (GenerationParams{ThinkingBudget: &budget}).Validate(); err == nil {
+			t.Errorf("Validate() with thinking_budget %d = nil, want error", budget)
+		}
+	}
+	for _, budget := range []int64{0, 1024} {
+		if err := (GenerationParams{ThinkingBudget: &budget}).Validate(); err != nil {
+			t.Errorf("Validate() with thinking_budget %d = %v", budget, err)
+		}
+	}
+	if err := (GenerationParams{Temperature: &good, ReasoningEffort: "medium"}).Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"rca.agent/test/internal/metrics"
+)
+
+// Outcomes of an analysis, as recorded in metrics.
+const (
+	outcomeCompleted      = "completed"
+	outcomeBudgetExceeded = "budget_exceeded"
+	outcomeTimeout        = "timeout"
+	outcomeCanceled       = "canceled"
+	outcomeError          = "error"
+)
+
+// observeStep records the usage of an agent step against the model that served it.
+func observeStep(info StepInfo) {
+	for typ, tokens := range map[string]int64{
+		"input":       info.Usage.InputTokens,
+		"output":      info.Usage.OutputTokens,
+		"reasoning":   info.Usage.ReasoningTokens,
+		"cache_read":  info.Usage.CacheReadTokens,
+		"cache_write": info.Usage.CacheWriteTokens,
+	} {
+		if tokens > 0 {
+			metrics.ModelTokens.WithLabelValues(info.Model, typ).Add(float64(tokens))
+		}
+	}
+	if info.Usage.CostUSD > 0 {
+		metrics.ModelCost.WithLabelValues(info.Model).Add(info.Usage.CostUSD)
+	}
+}
+
+// observeAnalysis records a finished analysis.
+func observeAnalysis(outcome string, duration time.Duration, steps int) {
+	metrics.Analyses.WithLabelValues(outcome).Inc()
+	metrics.AnalysisDuration.Observe(duration.Seconds())
+	metrics.AnalysisSteps.Observe(float64(steps))
+}
+
+// failureOutcome classifies an analysis that ended with an error.
+func failureOutcome(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return outcomeTimeout
+	case errors.Is(err, context.Canceled):
+		return outcomeCanceled
+	}
+	return outcomeError
+}
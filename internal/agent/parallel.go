@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"slices"
+
+	"charm.land/fantasy"
+)
+
+// orderToolResults returns a step preparation function that puts the tool results
+// of each step back in the order the model made the calls. Parallel tool calls
+// complete, and are recorded, in arbitrary order.
+func orderToolResults() fantasy.PrepareStepFunction {
+	return func(ctx context.Context, opts fantasy.PrepareStepFunctionOptions) (context.Context, fantasy.PrepareStepResult, error) {
+		var out []fantasy.Message
+		callOrder := make(map[string]int)
+
+		for i, msg := range opts.Messages {
+			switch msg.Role {
+			case fantasy.MessageRoleAssistant:
+				clear(callOrder)
+				for _, part := range msg.Content {
+					if call, ok := fantasy.AsMessagePart[fantasy.ToolCallPart](part); ok {
+						callOrder[call.ToolCallID] = len(callOrder)
+					}
+				}
+
+			case fantasy.MessageRoleTool:
+				content := slices.Clone(msg.Content)
+				if !sortToolResults(content, callOrder, messagePartToolCallID) {
+					continue
+				}
+
+				if out == nil {
+					out = slices.Clone(opts.Messages)
+				}
+				out[i].Content = content
+			}
+		}
+
+		return ctx, fantasy.PrepareStepResult{Messages: out}, nil
+	}
+}
+
+// orderStepToolResults puts the tool results of a finished step in the order the
+// model made the calls, in place, so that the step as recorded in the analysis
+// result, its trace and its trajectory does not depend on which call finished first.
+func orderStepToolResults(step fantasy.StepResult) {
+	callOrder := make(map[string]int)
+	for i, call := range step.Content.ToolCalls() {
+		callOrder[call.ToolCallID] = i
+	}
+	sortToolResults(step.Content, callOrder, contentToolCallID)
+	for _, msg := range step.Messages {
+		if msg.Role == fantasy.MessageRoleTool {
+			sortToolResults(msg.Content, callOrder, messagePartToolCallID)
+		}
+	}
+}
+
+// sortToolResults sorts the tool results among items in place by the position of
+// their calls in callOrder, leaving other items where they are. Results of unknown
+// calls go last. It reports whether any result moved.
+func sortToolResults[T any](items []T, callOrder map[string]int, toolCallID func(T) (string, bool)) bool {
+	var positions []int
+	var results []T
+	for i, item := range items {
+		if _, ok := toolCallID(item); ok {
+			positions = append(positions, i)
+			results = append(results, item)
+		}
+	}
+
+	position := func(item T) int {
+		id, _ := toolCallID(item)
+		if pos, ok := callOrder[id]; ok {
+			return pos
+		}
+		return len(callOrder)
+	}
+	compare := func(a, b T) int { return position(a) - position(b) }
+	if slices.IsSortedFunc(results, compare) {
+		return false
+	}
+
+	slices.SortStableFunc(results, compare)
+	for j, i := range positions {
+		items[i] = results[j]
+	}
+	return true
+}
+
+func messagePartToolCallID(part fantasy.MessagePart) (string, bool) {
+	result, ok := fantasy.AsMessagePart[fantasy.ToolResultPart](part)
+	return result.ToolCallID, ok
+}
+
+func contentToolCallID(content fantasy.Content) (string, bool) {
+	result, ok := fantasy.AsContentType[fantasy.ToolResultContent](content)
+	return result.ToolCallID, ok
+}
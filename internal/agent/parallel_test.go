@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"charm.land/fantasy"
+)
+
+func TestOrderToolResults(t *testing.T) {
+	call := func(id string) fantasy.MessagePart {
+		return fantasy.ToolCallPart{ToolCallID: id, ToolName: "get_component_logs", Input: "{}"}
+	}
+	result := func(id string) fantasy.MessagePart {
+		return fantasy.ToolResultPart{ToolCallID: id, Output: fantasy.ToolResultOutputContentText{Text: id}}
+	}
+
+	messages := []fantasy.Message{
+		fantasy.NewUserMessage("check all components"),
+		{Role: fantasy.MessageRoleAssistant, Content: []fantasy.MessagePart{call("a"), call("b"), call("c")}},
+		{Role: fantasy.MessageRoleTool, Content: []fantasy.MessagePart{result("c"), result("a"), result("b")}},
+	}
+
+	_, prepared, err := orderToolResults()(context.Background(), fantasy.PrepareStepFunctionOptions{Messages: messages})
+	if err != nil {
+		t.Fatalf("orderToolResults() error = %v", err)
+	}
+
+	var got []string
+	for _, ref := range toolResultRefs(prepared.Messages) {
+		got = append(got, ref.toolCallID)
+	}
+	if len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("order = %v, want [a b c]", got)
+	}
+	if first, _ := fantasy.AsMessagePart[fantasy.ToolResultPart](messages[2].Content[0]); first.ToolCallID != "c" {
+		t.Error("input messages were modified")
+	}
+
+	// Already ordered results are left alone
+	_, prepared, _ = orderToolResults()(context.Background(), fantasy.PrepareStepFunctionOptions{Messages: prepared.Messages})
+	if prepared.Messages != nil {
+		t.Error("ordered messages were rewritten")
+	}
+}
+
+func TestOrderStepToolResults(t *testing.T) {
+	call := func(id string) fantasy.ToolCallContent {
+		return fantasy.ToolCallContent{ToolCallID: id, ToolName: "get_component_logs", Input: "{}"}
+	}
+	result := func(id string) fantasy.ToolResultContent {
+		return fantasy.ToolResultContent{ToolCallID: id, Result: fantasy.ToolResultOutputContentText{Text: id}}
+	}
+	part := func(id string) fantasy.MessagePart {
+		return fantasy.ToolResultPart{ToolCallID: id, Output: fantasy.ToolResultOutputContentText{Text: id}}
+	}
+
+	step := fantasy.StepResult{
+		Response: fantasy.Response{Content: fantasy.ResponseContent{
+			fantasy.TextContent{Text: "checking"}, call("a"), call("b"), call("c"),
+			result("c"), result("a"), result("b"),
+		}},
+		Messages: []fantasy.Message{
+			{Role: fantasy.MessageRoleTool, Content: []fantasy.MessagePart{part("b"), part("c"), part("a")}},
+		},
+	}
+	orderStepToolResults(step)
+
+	var got []string
+	for _, r := range step.Content.ToolResults() {
+		got = append(got, r.ToolCallID)
+	}
+	if want := []string{"a", "b", "c"}; !slices.Equal(got, want) {
+		t.Errorf("content results = %v, want %v", got, want)
+	}
+	if _, ok := step.Content[0].(fantasy.TextContent); !ok {
+		t.Errorf("content[0] = %T, want the text left in place", step.Content[0])
+	}
+
+	got = nil
+	for _, ref := range toolResultRefs(step.Messages) {
+		got = append(got, ref.toolCallID)
+	}
+	if want := []string{"a", "b", "c"}; !slices.Equal(got, want) {
+		t.Errorf("message results = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+
+	"charm.land/fantasy"
+
+	"rca.agent/test/internal/config"
+)
+
+// defaultPricing holds list prices in USD per 1M tokens, keyed by model ID.
+// Dated snapshots match their undated ID (e.g. "claude-sonnet-4-20250514" uses
+// "claude-sonnet-4"), but other suffixes do not ("o3-mini" does not use "o3").
+// Override or extend with MODEL_PRICING.
+var defaultPricing = map[string]config.ModelPricing{
+	// OpenAI
+	"gpt-5":        {Input: 1.25, Output: 10, CacheRead: 0.125},
+	"gpt-5-mini":   {Input: 0.25, Output: 2, CacheRead: 0.025},
+	"gpt-5-nano":   {Input: 0.05, Output: 0.4, CacheRead: 0.005},
+	"gpt-4.1":      {Input: 2, Output: 8, CacheRead: 0.5},
+	"gpt-4.1-mini": {Input: 0.4, Output: 1.6, CacheRead: 0.1},
+	"gpt-4o":       {Input: 2.5, Output: 10, CacheRead: 1.25},
+	"gpt-4o-mini":  {Input: 0.15, Output: 0.6, CacheRead: 0.075},
+	"o3":           {Input: 2, Output: 8, CacheRead: 0.5},
+	"o3-mini":      {Input: 1.1, Output: 4.4, CacheRead: 0.55},
+	"o4-mini":      {Input: 1.1, Output: 4.4, CacheRead: 0.275},
+
+	// Anthropic
+	"claude-opus-4-5":   {Input: 5, Output: 25, CacheRead: 0.5, CacheWrite: 6.25},
+	"claude-opus-4-1":   {Input: 15, Output: 75, CacheRead: 1.5, CacheWrite: 18.75},
+	"claude-opus-4":     {Input: 15, Output: 75, CacheRead: 1.5, CacheWrite: 18.75},
+	"claude-sonnet-4-5": {Input: 3, Output: 15, CacheRead: 0.3, CacheWrite: 3.75},
+	"claude-sonnet-4":   {Input: 3, Output: 15, CacheRead: 0.3, CacheWrite: 3.75},
+	"claude-haiku-4-5":  {Input: 1, Output: 5, CacheRead: 0.1, CacheWrite: 1.25},
+
+	// Google
+	"gemini-2.5-pro":   {Input: 1.25, Output: 10, CacheRead: 0.31},
+	"gemini-2.5-flash": {Input: 0.3, Output: 2.5, CacheRead: 0.075},
+}
+
+// pricingTable computes the cost of model usage.
+type pricingTable map[string]config.ModelPricing
+
+// newPricingTable merges the configured overrides over the default prices.
+func newPricingTable(overrides map[string]config.ModelPricing) pricingTable {
+	table := make(pricingTable, len(defaultPricing)+len(overrides))
+	for k, v := range defaultPricing {
+		table[k] = v
+	}
+	for k, v := range overrides {
+		table[k] = v
+	}
+	return table
+}
+
+// snapshotSuffix matches the date suffix of a model snapshot, e.g. "-20250514"
+// or "-2025-04-14", and the "-latest" alias.
+var snapshotSuffix = regexp.MustCompile(`^-(\d{8}|\d{4}-\d{2}-\d{2}|latest)$`)
+
+// lookup finds the pricing for a "provider:model" name, trying the exact name,
+// then the model ID, then the model ID without its snapshot suffix.
+func (t pricingTable) lookup(model string) (config.ModelPricing, bool) {
+	if p, ok := t[model]; ok {
+		return p, true
+	}
+
+	modelID := parseModel(model).ModelID
+	if p, ok := t[modelID]; ok {
+		return p, true
+	}
+
+	for k, p := range t {
+		if rest, ok := strings.CutPrefix(modelID, k); ok && snapshotSuffix.MatchString(rest) {
+			return p, true
+		}
+	}
+	return config.ModelPricing{}, false
+}
+
+// unpricedModels records the models already warned about as having no pricing.
+var unpricedModels sync.Map
+
+// cost returns the USD cost of the usage for the given "provider:model" name.
+// Unknown models cost zero, with a warning logged once per model.
+func (t pricingTable) cost(model string, usage fantasy.Usage) float64 {
+	p, ok := t.lookup(model)
+	if !ok {
+		if _, warned := unpricedModels.LoadOrStore(model, true); !warned {
+			slog.Warn("No pricing for model, its cost is not tracked; set it in MODEL_PRICING", "model", model)
+		}
+		return 0
+	}
+
+	// Anthropic reports cached tokens separately from input tokens; other
+	// providers include them in the input token count.
+	provider := parseModel(model).Provider
+	input := usage.InputTokens
+	if provider != providerAnthropic {
+		input = max(input-usage.CacheReadTokens-usage.CacheCreationTokens, 0)
+	}
+
+	// Google reports thinking tokens separately from output tokens, and bills them
+	// as output; OpenAI includes reasoning tokens in the output token count.
+	output := usage.OutputTokens
+	if provider == providerGoogle {
+		output += usage.ReasoningTokens
+	}
+
+	return (float64(input)*p.Input +
+		float64(output)*p.Output +
+		float64(usage.CacheReadTokens)*p.CacheRead +
+		float64(usage.CacheCreationTokens)*p.CacheWrite) / 1e6
+}
@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"math"
+	"testing"
+
+	"charm.land/fantasy"
+
+	"rca.agent/test/internal/config"
+)
+
+func TestPricingTableCost(t *testing.T) {
+	table := newPricingTable(map[string]config.ModelPricing{
+		"openaicompat:local-llama": {Input: 0, Output: 0},
+	})
+
+	tests := []struct {
+		name  string
+		model string
+		usage fantasy.Usage
+		want  float64
+	}{
+		{
+			name:  "openai cached tokens are part of input",
+			model: "openai:gpt-4.1",
+			usage: fantasy.Usage{InputTokens: 1_000_000, OutputTokens: 100_000, CacheReadTokens: 400_000},
+			want:  0.6*2 + 0.1*8 + 0.4*0.5,
+		},
+		{
+			name:  "anthropic cached tokens are separate",
+			model: "anthropic:claude-sonnet-4-5",
+			usage: fantasy.Usage{InputTokens: 1_000_000, CacheReadTokens: 1_000_000, CacheCreationTokens: 1_000_000},
+			want:  3 + 0.3 + 3.75,
+		},
+		{
+			name:  "dated snapshot matches undated ID",
+			model: "anthropic:claude-sonnet-4-20250514",
+			usage: fantasy.Usage{OutputTokens: 1_000_000},
+			want:  15,
+		},
+		{
+			name:  "opus 4.5 snapshot is not priced as opus 4",
+			model: "anthropic:claude-opus-4-5-20251101",
+			usage: fantasy.Usage{InputTokens: 1_000_000, OutputTokens: 1_000_000},
+			want:  5 + 25,
+		},
+		{
+			name:  "haiku 4.5 snapshot",
+			model: "anthropic:claude-haiku-4-5-20251001",
+			usage: fantasy.Usage{InputTokens: 1_000_000, OutputTokens: 1_000_000},
+			want:  1 + 5,
+		},
+		{
+			name:  "o3-mini is not priced as o3",
+			model: "openai:o3-mini",
+			usage: fantasy.Usage{OutputTokens: 1_000_000},
+			want:  4.4,
+		},
+		{
+			name:  "gpt-5-nano is not priced as gpt-5",
+			model: "openai:gpt-5-nano",
+			usage: fantasy.Usage{OutputTokens: 1_000_000},
+			want:  0.4,
+		},
+		{
+			name:  "openai dated snapshot",
+			model: "openai:gpt-4.1-2025-04-14",
+			usage: fantasy.Usage{OutputTokens: 1_000_000},
+			want:  8,
+		},
+		{
+			name:  "other suffix does not match",
+			model: "openai:gpt-4o-audio-preview",
+			usage: fantasy.Usage{OutputTokens: 1_000_000},
+			want:  0,
+		},
+		{
+			name:  "gemini thinking tokens are billed as output",
+			model: "google:gemini-2.5-pro",
+			usage: fantasy.Usage{InputTokens: 1_000_000, OutputTokens: 200_000, ReasoningTokens: 800_000, TotalTokens: 2_000_000},
+			want:  1.25 + 10,
+		},
+		{
+			name:  "openai reasoning tokens are part of output",
+			model: "openai:o3-mini",
+			usage: fantasy.Usage{OutputTokens: 1_000_000, ReasoningTokens: 800_000},
+			want:  4.4,
+		},
+		{
+			name:  "override",
+			model: "openaicompat:local-llama",
+			usage: fantasy.Usage{InputTokens: 1_000_000},
+			want:  0,
+		},
+		{
+			name:  "unknown model",
+			model: "openai-compat:mystery",
+			usage: fantasy.Usage{InputTokens: 1_000_000},
+			want:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := table.cost(tt.model, tt.usage); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("cost(%q) = %v, want %v", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBudgetGuardWrapUp(t *testing.T) {
+	guard := newBudgetGuard(Budget{MaxTokens: 100}, "system", true)
+	stop := guard.stopCondition()
+	prepare := guard.prepareStep()
+
+	guard.observe(StepInfo{Usage: Usage{TotalTokens: 60}})
+	if stop(nil) {
+		t.Fatal("stopped before budget was exceeded")
+	}
+
+	guard.observe(StepInfo{Usage: Usage{TotalTokens: 60}})
+	if stop(nil) {
+		t.Fatal("stopped before wrap-up step")
+	}
+
+	_, prepared, err := prepare(t.Context(), fantasy.PrepareStepFunctionOptions{})
+	if err != nil {
+		t.Fatalf("prepareStep() error = %v", err)
+	}
+	if prepared.ToolChoice == nil || *prepared.ToolChoice != fantasy.SpecificToolChoice("structured_output") {
+		t.Errorf("ToolChoice = %v, want structured_output", prepared.ToolChoice)
+	}
+	if !stop(nil) {
+		t.Error("did not stop after wrap-up step")
+	}
+}
+
+func TestBudgetTighten(t *testing.T) {
+	got := Budget{MaxTokens: 1000}.Tighten(Budget{MaxTokens: 500, MaxCostUSD: 2})
+	want := Budget{MaxTokens: 500, MaxCostUSD: 2}
+	if got != want {
+		t.Errorf("Tighten() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"charm.land/fantasy"
+
+	"rca.agent/test/internal/mcp"
+)
+
+// ErrUnknownProfile is returned when a request selects a profile no server publishes.
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// ErrInvalidProfileArguments is returned when a request omits an argument its
+// profile requires.
+var ErrInvalidProfileArguments = errors.New("invalid profile arguments")
+
+// Profiles returns the analysis profiles: the prompts published by the MCP servers.
+func (a *Agent) Profiles(ctx context.Context) []mcp.Prompt {
+	return a.mcpManager.ListPrompts(ctx)
+}
+
+// profileMessages renders the selected profile into the messages that open the
+// conversation. No profile yields no messages.
+func (a *Agent) profileMessages(ctx context.Context, profile string, args map[string]string) ([]fantasy.Message, error) {
+	if profile == "" {
+		return nil, nil
+	}
+
+	server, name, qualified := strings.Cut(profile, "/")
+	if !qualified {
+		server, name = "", profile
+	}
+
+	var matches []mcp.Prompt
+	for _, p := range a.Profiles(ctx) {
+		if p.Name == name && (server == "" || p.Server == server) {
+			matches = append(matches, p)
+		}
+	}
+	switch {
+	case len(matches) == 0:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProfile, profile)
+	case len(matches) > 1:
+		return nil, fmt.Errorf("%w: %s is published by several servers; use server/name", ErrUnknownProfile, profile)
+	}
+
+	prompt := matches[0]
+	for _, arg := range prompt.Arguments {
+		if arg.Required && args[arg.Name] == "" {
+			return nil, fmt.Errorf("%w: %s/%s requires argument %q", ErrInvalidProfileArguments, prompt.Server, prompt.Name, arg.Name)
+		}
+	}
+
+	messages, err := a.mcpManager.GetPrompt(ctx, prompt.Server, prompt.Name, args)
+	if err != nil {
+		return nil, fmt.Errorf("get profile %s/%s: %w", prompt.Server, prompt.Name, err)
+	}
+	return messages, nil
+}
@@ -9,6 +9,7 @@ import (
 	"charm.land/fantasy/providers/anthropic"
 	"charm.land/fantasy/providers/google"
 	"charm.land/fantasy/providers/openai"
+	"charm.land/fantasy/providers/openaicompat"
 
 	"rca.agent/test/internal/config"
 )
@@ -21,6 +22,10 @@ const (
 	providerOpenAI    providerType = "openai"
 	providerAnthropic providerType = "anthropic"
 	providerGoogle    providerType = "google"
+
+	// providerOpenAICompat targets any OpenAI-compatible endpoint (e.g. a local llama server).
+	// It is never inferred and must be selected explicitly with the "openaicompat:" prefix.
+	providerOpenAICompat providerType = "openaicompat"
 )
 
 // modelInfo holds parsed model information
@@ -33,8 +38,8 @@ type modelInfo struct {
 // Examples:
 //   - "gpt-5.2" -> infers openai
 //   - "openai:o4-mini" -> explicit openai
-//   - "claude-opus-4.5" -> infers anthropic
-//   - "anthropic:claude-sonnet-4.5" -> explicit anthropic
+//   - "claude-opus-4-5" -> infers anthropic
+//   - "anthropic:claude-sonnet-4-5" -> explicit anthropic
 //   - "gemini-3-pro" -> infers google
 func parseModel(model string) modelInfo {
 	// Check for explicit provider prefix (provider:model)
@@ -108,15 +113,53 @@ func initLanguageModel(ctx context.Context, model string, cfg *config.Config) (f
 func buildProvider(pt providerType, cfg *config.Config) (fantasy.Provider, error) {
 	switch pt {
 	case providerOpenAI:
-		return openai.New(openai.WithAPIKey(cfg.RCALLMAPIKey))
+		return openai.New(openai.WithAPIKey(providerAPIKey(pt, cfg)))
 
 	case providerAnthropic:
-		return anthropic.New(anthropic.WithAPIKey(cfg.RCALLMAPIKey))
+		return anthropic.New(anthropic.WithAPIKey(providerAPIKey(pt, cfg)))
 
 	case providerGoogle:
-		return google.New(google.WithGeminiAPIKey(cfg.RCALLMAPIKey))
+		return google.New(google.WithGeminiAPIKey(providerAPIKey(pt, cfg)))
+
+	case providerOpenAICompat:
+		if cfg.OpenAICompatBaseURL == "" {
+			return nil, fmt.Errorf("OPENAICOMPAT_BASE_URL is required for provider %s", pt)
+		}
+		return openaicompat.New(
+			openaicompat.WithBaseURL(cfg.OpenAICompatBaseURL),
+			openaicompat.WithAPIKey(providerAPIKey(pt, cfg)),
+		)
 
 	default:
 		return nil, fmt.Errorf("unsupported provider: %s", pt)
 	}
 }
+
+// providerAPIKey returns the provider-specific key, or the shared RCA_LLM_API_KEY when unset.
+// OpenAI-compatible servers only get their own key: the shared one is meant for the
+// primary vendor and must not be sent to whatever server OPENAICOMPAT_BASE_URL names.
+func providerAPIKey(pt providerType, cfg *config.Config) string {
+	if pt == providerOpenAICompat {
+		return cfg.OpenAICompatAPIKey
+	}
+	keys := map[providerType]string{
+		providerOpenAI:    cfg.OpenAIAPIKey,
+		providerAnthropic: cfg.AnthropicAPIKey,
+		providerGoogle:    cfg.GoogleAPIKey,
+	}
+	if key := keys[pt]; key != "" {
+		return key
+	}
+	return cfg.RCALLMAPIKey
+}
+
+// checkAPIKey returns an error if a model has neither a provider-specific key nor
+// the shared RCA_LLM_API_KEY. OpenAI-compatible servers, often local, may not need one.
+func checkAPIKey(model string, cfg *config.Config) error {
+	pt := parseModel(model).Provider
+	if pt == "" || pt == providerOpenAICompat || providerAPIKey(pt, cfg) != "" {
+		// Models of unknown providers fail when they are initialized
+		return nil
+	}
+	return fmt.Errorf("no API key for model %s: set %s_API_KEY or RCA_LLM_API_KEY", model, strings.ToUpper(string(pt)))
+}
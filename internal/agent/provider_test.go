@@ -1,7 +1,12 @@
 package agent
 
 import (
+	"context"
+	"slices"
+	"strings"
 	"testing"
+
+	"rca.agent/test/internal/config"
 )
 
 func TestInferProvider(t *testing.T) {
@@ -75,3 +80,69 @@ func TestParseModel(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckAPIKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		model   string
+		cfg     config.Config
+		wantErr string
+	}{
+		{"shared key", "claude-sonnet-4-5", config.Config{RCALLMAPIKey: "shared"}, ""},
+		{"provider key", "openai:gpt-5", config.Config{OpenAIAPIKey: "o"}, ""},
+		{"other provider's key", "openai:gpt-5", config.Config{AnthropicAPIKey: "a"}, "OPENAI_API_KEY"},
+		{"missing key", "claude-sonnet-4-5", config.Config{}, "ANTHROPIC_API_KEY"},
+		{"keyless OpenAI-compatible server", "openaicompat:local-llama", config.Config{}, ""},
+	}
+	for _, tt := range tests {
+		err := checkAPIKey(tt.model, &tt.cfg)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: checkAPIKey() = %v", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: checkAPIKey() = %v, want error mentioning %s", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestProviderAPIKey(t *testing.T) {
+	cfg := &config.Config{RCALLMAPIKey: "shared", GoogleAPIKey: "g"}
+	if got := providerAPIKey(providerGoogle, cfg); got != "g" {
+		t.Errorf("google key = %q, want g", got)
+	}
+	if got := providerAPIKey(providerAnthropic, cfg); got != "shared" {
+		t.Errorf("anthropic key = %q, want shared", got)
+	}
+	if got := providerAPIKey(providerOpenAICompat, cfg); got != "" {
+		t.Errorf("openaicompat key = %q, want none", got)
+	}
+	cfg.OpenAICompatAPIKey = "local"
+	if got := providerAPIKey(providerOpenAICompat, cfg); got != "local" {
+		t.Errorf("openaicompat key = %q, want local", got)
+	}
+}
+
+func TestInitModelChainSkipsFallbacksWithoutKey(t *testing.T) {
+	cfg := &config.Config{
+		RCAModelName:        "claude-sonnet-4-5",
+		RCAModelFallbacks:   "openai:gpt-4.1,openaicompat:local-llama",
+		AnthropicAPIKey:     "a",
+		OpenAICompatBaseURL: "http://localhost:11434/v1",
+	}
+	model, err := initModelChain(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("initModelChain() error = %v", err)
+	}
+	var names []string
+	for _, m := range model.(*fallbackModel).models {
+		names = append(names, m.Model())
+	}
+	if want := []string{"claude-sonnet-4-5", "local-llama"}; !slices.Equal(names, want) {
+		t.Errorf("models = %v, want %v", names, want)
+	}
+
+	cfg.AnthropicAPIKey = ""
+	if _, err := initModelChain(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "ANTHROPIC_API_KEY") {
+		t.Errorf("initModelChain() without a primary key error = %v", err)
+	}
+}
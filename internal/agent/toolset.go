@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"charm.land/fantasy"
+
+	"rca.agent/test/internal/mcp"
+)
+
+// toolSet holds the tools offered to the model. MCP tools are re-listed when servers
+// report changes or reconnect, and the new set is swapped in atomically: each step
+// of an in-flight analysis picks up the set current when the step starts.
+type toolSet struct {
+	manager *mcp.Manager
+	native  []fantasy.AgentTool // Tools that do not come from MCP servers
+	// readResource is offered while a connected server publishes resources
+	readResource fantasy.AgentTool
+
+	mu      sync.Mutex // Serializes refreshes
+	current atomic.Pointer[[]fantasy.AgentTool]
+}
+
+func newToolSet(native ...fantasy.AgentTool) *toolSet {
+	s := &toolSet{native: native}
+	s.current.Store(&native)
+	return s
+}
+
+// tools returns the current tools.
+func (s *toolSet) tools() []fantasy.AgentTool {
+	return *s.current.Load()
+}
+
+// refresh re-lists the MCP tools and swaps in the new set if it changed.
+func (s *toolSet) refresh(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := slices.Clone(s.native)
+	if s.readResource != nil && s.manager.HasResources() {
+		next = append(next, s.readResource)
+	}
+	native := toolNames(next)
+	for _, t := range s.manager.GetAllTools(ctx) {
+		// Native tools take precedence over MCP tools aliased to the same name
+		if name := t.Info().Name; slices.Contains(native, name) {
+			slog.Warn("MCP tool shadowed by a native tool", "name", name, "tool", s.manager.ToolLabel(name))
+			continue
+		}
+		next = append(next, t)
+	}
+
+	prev := toolNames(s.tools())
+	names := toolNames(next)
+	var added, removed []string
+	for _, name := range names {
+		if !slices.Contains(prev, name) {
+			added = append(added, name)
+		}
+	}
+	for _, name := range prev {
+		if !slices.Contains(names, name) {
+			removed = append(removed, name)
+		}
+	}
+
+	// MCP tools are swapped in even when the names are unchanged, since their
+	// descriptions or schemas may have changed
+	s.current.Store(&next)
+	if len(added) > 0 || len(removed) > 0 {
+		slog.Info("Agent tools updated", "tools", len(next), "added", added, "removed", removed)
+	}
+}
+
+// prepareStep offers the current tools to the step.
+func (s *toolSet) prepareStep() fantasy.PrepareStepFunction {
+	return func(ctx context.Context, _ fantasy.PrepareStepFunctionOptions) (context.Context, fantasy.PrepareStepResult, error) {
+		return ctx, fantasy.PrepareStepResult{Tools: s.tools()}, nil
+	}
+}
+
+func toolNames(tools []fantasy.AgentTool) []string {
+	names := make([]string, len(tools))
+	for i, t := range tools {
+		names[i] = t.Info().Name
+	}
+	return names
+}
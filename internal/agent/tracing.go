@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"context"
+
+	"charm.land/fantasy"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("rca.agent/test/internal/agent")
+
+// stepTracer records a span per agent step. Steps run one after another, each as a
+// child of the analysis span, and the step's tool calls are children of its span.
+type stepTracer struct {
+	parent trace.Span
+	span   trace.Span // Span of the step in progress, if any
+}
+
+func newStepTracer(ctx context.Context) *stepTracer {
+	return &stepTracer{parent: trace.SpanFromContext(ctx)}
+}
+
+// prepareStep starts the step's span.
+func (t *stepTracer) prepareStep() fantasy.PrepareStepFunction {
+	return func(ctx context.Context, opts fantasy.PrepareStepFunctionOptions) (context.Context, fantasy.PrepareStepResult, error) {
+		// The context returned here is carried into the next step, so the span is
+		// started from the analysis span rather than the previous step's
+		ctx, t.span = tracer.Start(trace.ContextWithSpan(ctx, t.parent), "agent.step",
+			trace.WithAttributes(
+				attribute.Int("agent.step", opts.StepNumber),
+				attribute.Int("agent.messages", len(opts.Messages)),
+			))
+		return ctx, fantasy.PrepareStepResult{}, nil
+	}
+}
+
+// finish ends the step's span with the model that served it and its usage.
+func (t *stepTracer) finish(info StepInfo, step fantasy.StepResult) {
+	if t.span == nil {
+		return
+	}
+	t.span.SetAttributes(
+		attribute.String("gen_ai.request.model", info.Model),
+		attribute.String("gen_ai.response.finish_reason", string(step.FinishReason)),
+		attribute.Int64("gen_ai.usage.input_tokens", info.Usage.InputTokens),
+		attribute.Int64("gen_ai.usage.output_tokens", info.Usage.OutputTokens),
+		attribute.Float64("agent.cost_usd", info.Usage.CostUSD),
+		attribute.Int64("agent.context_tokens", info.ContextTokens),
+		attribute.Int("agent.tool_calls", len(step.Content.ToolCalls())),
+	)
+	t.span.End()
+	t.span = nil
+}
+
+// fail ends the span of a step that did not finish.
+func (t *stepTracer) fail(err error) {
+	if t.span == nil {
+		return
+	}
+	t.span.RecordError(err)
+	t.span.SetStatus(codes.Error, err.Error())
+	t.span.End()
+	t.span = nil
+}
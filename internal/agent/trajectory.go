@@ -0,0 +1,202 @@
+package agent
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"charm.land/fantasy"
+
+	"rca.agent/test/internal/mcp"
+	"rca.agent/test/internal/tools"
+)
+
+// Trajectory is the complete record of an analysis: what the model was asked, every
+// response and tool call it made along the way, and what it concluded.
+type Trajectory struct {
+	ID      string `json:"id"`
+	Caller  string `json:"caller,omitempty"`
+	Profile string `json:"profile,omitempty"`
+
+	SystemPrompt string              `json:"system_prompt"`
+	Messages     []TrajectoryMessage `json:"messages,omitempty"` // Profile messages preceding the prompt
+	Prompt       string              `json:"prompt"`
+	Steps        []TrajectoryStep    `json:"steps"`
+
+	Output         any    `json:"output,omitempty"`
+	Text           string `json:"text,omitempty"`
+	Usage          Usage  `json:"usage"`
+	BudgetExceeded bool   `json:"budget_exceeded,omitempty"`
+	Error          string `json:"error,omitempty"` // Set if the analysis failed
+
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// TrajectoryMessage is a message of the conversation that preceded the prompt.
+type TrajectoryMessage struct {
+	Role string `json:"role"`
+	Text string `json:"text"`
+}
+
+// TrajectoryStep is a model response and the tool calls it made.
+type TrajectoryStep struct {
+	StepInfo
+	FinishReason string               `json:"finish_reason"`
+	Reasoning    string               `json:"reasoning,omitempty"` // Where the provider returns it
+	Text         string               `json:"text,omitempty"`
+	ToolCalls    []TrajectoryToolCall `json:"tool_calls,omitempty"`
+	Todos        []tools.Todo         `json:"todos,omitempty"` // Todo list as updated in the step
+}
+
+// TrajectoryToolCall is a tool call and its result as the model saw it.
+type TrajectoryToolCall struct {
+	ID     string          `json:"id"`
+	Tool   string          `json:"tool"` // "server/tool" for MCP tools
+	Input  json.RawMessage `json:"input"`
+	Result string          `json:"result"`
+
+	// MCP result before response transformers and size limits, if they changed it
+	RawResult string          `json:"raw_result,omitempty"`
+	ErrorCode mcp.ErrorCode   `json:"error_code,omitempty"`
+	Cache     mcp.CacheStatus `json:"cache,omitempty"`
+}
+
+// NewAnalysisID returns a random analysis ID.
+func NewAnalysisID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// trajectoryRecorder builds the trajectory of an analysis as its steps finish.
+type trajectoryRecorder struct {
+	manager *mcp.Manager
+
+	mu         sync.Mutex
+	trajectory *Trajectory
+	raw        map[string]string // Raw MCP results by tool call ID
+}
+
+func newTrajectoryRecorder(manager *mcp.Manager, t *Trajectory) *trajectoryRecorder {
+	return &trajectoryRecorder{manager: manager, trajectory: t, raw: make(map[string]string)}
+}
+
+// rawResult records the raw result of an MCP tool call. Tool calls report concurrently.
+func (r *trajectoryRecorder) rawResult(toolCallID, raw string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.raw[toolCallID] = raw
+}
+
+// step records a finished step.
+func (r *trajectoryRecorder) step(info StepInfo, step fantasy.StepResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := TrajectoryStep{
+		StepInfo:     info,
+		FinishReason: string(step.FinishReason),
+		Reasoning:    step.Content.ReasoningText(),
+		Text:         step.Content.Text(),
+	}
+
+	results := make(map[string]fantasy.ToolResultContent)
+	for _, result := range step.Content.ToolResults() {
+		results[result.ToolCallID] = result
+	}
+	for _, call := range step.Content.ToolCalls() {
+		tc := TrajectoryToolCall{
+			ID:    call.ToolCallID,
+			Tool:  r.manager.ToolLabel(call.ToolName),
+			Input: rawJSON(call.Input),
+		}
+		if result, ok := results[call.ToolCallID]; ok {
+			tc.Result = toolResultText(result)
+			if code, failed := toolErrorCode(result); failed {
+				tc.ErrorCode = code
+			} else {
+				var meta mcp.ResultMetadata
+				_ = json.Unmarshal([]byte(result.ClientMetadata), &meta)
+				tc.Cache = meta.Cache
+			}
+		}
+		if raw, ok := r.raw[call.ToolCallID]; ok && raw != tc.Result {
+			tc.RawResult = raw
+		}
+		delete(r.raw, call.ToolCallID)
+		s.ToolCalls = append(s.ToolCalls, tc)
+
+		if call.ToolName == tools.TodosToolName {
+			var params tools.TodosParams
+			if err := json.Unmarshal([]byte(call.Input), &params); err == nil {
+				s.Todos = params.Todos
+			}
+		}
+	}
+
+	r.trajectory.Steps = append(r.trajectory.Steps, s)
+}
+
+// finish completes the trajectory with the analysis' outcome and returns it.
+func (r *trajectoryRecorder) finish(result *AnalysisResult, err error) *Trajectory {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.trajectory
+	t.FinishedAt = time.Now()
+	if err != nil {
+		t.Error = err.Error()
+		for _, step := range t.Steps {
+			t.Usage = t.Usage.add(step.Usage)
+		}
+		return t
+	}
+	t.Output = result.Output
+	t.Text = result.Text
+	t.Usage = result.Usage
+	t.BudgetExceeded = result.BudgetExceeded
+	return t
+}
+
+// trajectoryMessages converts messages to their text for the trajectory.
+func trajectoryMessages(messages []fantasy.Message) []TrajectoryMessage {
+	var out []TrajectoryMessage
+	for _, msg := range messages {
+		var parts []string
+		for _, part := range msg.Content {
+			if text, ok := fantasy.AsMessagePart[fantasy.TextPart](part); ok {
+				parts = append(parts, text.Text)
+			}
+		}
+		out = append(out, TrajectoryMessage{Role: string(msg.Role), Text: strings.Join(parts, "\n")})
+	}
+	return out
+}
+
+// toolResultText returns the text of a tool result as it was passed to the model.
+func toolResultText(result fantasy.ToolResultContent) string {
+	if textResult, ok := fantasy.AsToolResultOutputType[fantasy.ToolResultOutputContentText](result.Result); ok {
+		return textResult.Text
+	}
+	if errResult, ok := fantasy.AsToolResultOutputType[fantasy.ToolResultOutputContentError](result.Result); ok {
+		return errResult.Error.Error()
+	}
+	if mediaResult, ok := fantasy.AsToolResultOutputType[fantasy.ToolResultOutputContentMedia](result.Result); ok {
+		return fmt.Sprintf("%s\n[%s attachment]", mediaResult.Text, mediaResult.MediaType)
+	}
+	return fmt.Sprintf("%v", result.Result)
+}
+
+// rawJSON returns tool call input as JSON, quoting it if the model sent invalid JSON.
+func rawJSON(input string) json.RawMessage {
+	if json.Valid([]byte(input)) {
+		return json.RawMessage(input)
+	}
+	b, _ := json.Marshal(input)
+	return b
+}
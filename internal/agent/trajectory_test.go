@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"errors"
+	"testing"
+
+	"charm.land/fantasy"
+
+	"rca.agent/test/internal/mcp"
+	"rca.agent/test/internal/tools"
+)
+
+func TestTrajectoryRecorder(t *testing.T) {
+	r := newTrajectoryRecorder(mcp.NewManager(mcp.ManagerOptions{}), &Trajectory{ID: "a1", Prompt: "why is checkout slow?"})
+	r.rawResult("call-1", `{"logs":["raw"]}`)
+
+	step := fantasy.StepResult{Response: fantasy.Response{
+		FinishReason: fantasy.FinishReasonToolCalls,
+		Content: fantasy.ResponseContent{
+			fantasy.ReasoningContent{Text: "Check the logs first."},
+			fantasy.ToolCallContent{ToolCallID: "call-1", ToolName: "get_logs", Input: `{"component":"checkout"}`},
+			fantasy.ToolCallContent{ToolCallID: "call-2", ToolName: tools.TodosToolName, Input: `{"todos":[{"content":"Check logs","status":"in_progress"}]}`},
+			fantasy.ToolResultContent{ToolCallID: "call-1", ToolName: "get_logs", Result: fantasy.ToolResultOutputContentText{Text: "1 log line"}},
+			fantasy.ToolResultContent{ToolCallID: "call-2", ToolName: tools.TodosToolName, Result: fantasy.ToolResultOutputContentText{Text: "Todo list updated."}},
+		},
+	}}
+	r.step(StepInfo{Step: 0, Model: "openai:gpt-4.1", Usage: Usage{TotalTokens: 100}}, step)
+
+	traj := r.finish(nil, errors.New("context deadline exceeded"))
+	if traj.Error == "" || traj.Usage.TotalTokens != 100 {
+		t.Errorf("error = %q, usage = %+v", traj.Error, traj.Usage)
+	}
+	if len(traj.Steps) != 1 {
+		t.Fatalf("steps = %d, want 1", len(traj.Steps))
+	}
+	s := traj.Steps[0]
+	if s.Reasoning != "Check the logs first." || s.FinishReason != "tool-calls" {
+		t.Errorf("step = %+v", s)
+	}
+	if len(s.ToolCalls) != 2 {
+		t.Fatalf("tool calls = %+v", s.ToolCalls)
+	}
+	if call := s.ToolCalls[0]; call.Result != "1 log line" || call.RawResult != `{"logs":["raw"]}` || string(call.Input) != `{"component":"checkout"}` {
+		t.Errorf("tool call = %+v", call)
+	}
+	if s.ToolCalls[1].RawResult != "" {
+		t.Errorf("native tool has raw result %q", s.ToolCalls[1].RawResult)
+	}
+	if len(s.Todos) != 1 || s.Todos[0].Status != "in_progress" {
+		t.Errorf("todos = %+v", s.Todos)
+	}
+}
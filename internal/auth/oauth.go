@@ -14,6 +14,7 @@ import (
 
 	"rca.agent/test/internal/config"
 	"rca.agent/test/internal/httputil"
+	"rca.agent/test/internal/metrics"
 )
 
 // OAuthTokenResponse represents the OAuth2 token response
@@ -50,7 +51,11 @@ func (m *OAuthTokenManager) GetToken(ctx context.Context) (string, error) {
 	}
 	m.mu.RUnlock()
 
-	return m.refreshToken(ctx)
+	token, err := m.refreshToken(ctx)
+	if err != nil {
+		metrics.OAuthRefreshFailures.Inc()
+	}
+	return token, err
 }
 
 func (m *OAuthTokenManager) refreshToken(ctx context.Context) (string, error) {
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -10,24 +12,153 @@ import (
 	"github.com/knadh/koanf/v2"
 )
 
+// MaxParallelToolCallsLimit is the number of tool calls of a step the agent runs at
+// once; fantasy does not run more in parallel.
+const MaxParallelToolCallsLimit = 5
+
 // Config holds all configuration for the RCA agent
 type Config struct {
 	// LLM settings
 	RCAModelName string `koanf:"rca_model_name"`
 	RCALLMAPIKey string `koanf:"rca_llm_api_key"`
 
+	// Model fallback chain, tried in order when the primary model fails
+	// with a transient error (comma-separated, e.g. "openai:gpt-4.1,openaicompat:local-llama")
+	RCAModelFallbacks      string        `koanf:"rca_model_fallbacks"`
+	ModelMaxRetries        int           `koanf:"model_max_retries"`
+	ModelRetryInitialDelay time.Duration `koanf:"model_retry_initial_delay"`
+	ModelRetryMaxDelay     time.Duration `koanf:"model_retry_max_delay"`
+
+	// Default generation parameters (unset leaves the provider default)
+	ModelTemperature     *float64 `koanf:"model_temperature"`
+	ModelTopP            *float64 `koanf:"model_top_p"`
+	ModelMaxOutputTokens *int64   `koanf:"model_max_output_tokens"`
+	ModelReasoningEffort string   `koanf:"model_reasoning_effort"`
+	ModelThinkingBudget  *int64   `koanf:"model_thinking_budget"`
+
+	// Model pricing overrides as JSON, keyed by model ("provider:model" or model ID),
+	// e.g. {"gpt-4.1": {"input": 2, "output": 8, "cache_read": 0.5}}. Prices are USD per 1M tokens.
+	ModelPricing string `koanf:"model_pricing"`
+
+	// Token and cost budgets (0 means unlimited)
+	AnalysisTokenBudget   int64         `koanf:"analysis_token_budget"`
+	AnalysisCostBudgetUSD float64       `koanf:"analysis_cost_budget_usd"`
+	CallerTokenBudget     int64         `koanf:"caller_token_budget"`
+	CallerCostBudgetUSD   float64       `koanf:"caller_cost_budget_usd"`
+	CallerBudgetWindow    time.Duration `koanf:"caller_budget_window"`
+
+	// Context window management: older tool results are compacted into summaries once the
+	// estimated prompt size exceeds the threshold (0 disables compaction)
+	ContextCompactionThreshold int64  `koanf:"context_compaction_threshold"`
+	ContextKeepRecentResults   int    `koanf:"context_keep_recent_results"`
+	ContextSummarizer          string `koanf:"context_summarizer"`
+
+	// MCP tool result size limits (0 means unlimited). Per-tool limits are comma-separated
+	// tool=size pairs, in bytes or in tokens with a "t" suffix, e.g. "get_project_logs=200000,get_traces=20000t"
+	ToolResultMaxBytes  int    `koanf:"tool_result_max_bytes"`
+	ToolResultMaxTokens int    `koanf:"tool_result_max_tokens"`
+	ToolResultLimits    string `koanf:"tool_result_limits"`
+
+	// Per-provider API keys (fall back to RCALLMAPIKey when empty). The primary model
+	// needs one of the two, and fallback models without one are skipped, except
+	// OpenAI-compatible ones; this is checked when the models are initialized.
+	OpenAIAPIKey       string `koanf:"openai_api_key"`
+	AnthropicAPIKey    string `koanf:"anthropic_api_key"`
+	GoogleAPIKey       string `koanf:"google_api_key"`
+	OpenAICompatAPIKey string `koanf:"openaicompat_api_key"`
+
+	// OpenAI-compatible endpoint (e.g. a local llama server)
+	OpenAICompatBaseURL string `koanf:"openaicompat_base_url"`
+	// OpenAI-compatible models that accept a reasoning effort (comma-separated model
+	// IDs); the others are not sent one
+	OpenAICompatReasoningModels string `koanf:"openaicompat_reasoning_models"`
+
 	// MCP server URLs
 	ObserverMCPURL   string `koanf:"observer_mcp_url"`
 	OpenchoreoMCPURL string `koanf:"openchoreo_mcp_url"`
 
+	// How often MCP tool lists are re-fetched, in addition to list_changed notifications (0 disables)
+	MCPToolRefreshInterval time.Duration `koanf:"mcp_tool_refresh_interval"`
+
+	// Backoff bounds for reconnecting MCP servers that are down
+	MCPReconnectInitialDelay time.Duration `koanf:"mcp_reconnect_initial_delay"`
+	MCPReconnectMaxDelay     time.Duration `koanf:"mcp_reconnect_max_delay"`
+
+	// Per-server circuit breaker: calls fail fast for the open duration after this many consecutive failures
+	MCPBreakerThreshold    int           `koanf:"mcp_breaker_threshold"`
+	MCPBreakerOpenDuration time.Duration `koanf:"mcp_breaker_open_duration"`
+
+	// MCP sessions idle for longer than this are pinged before the next call
+	MCPIdlePingAfter time.Duration `koanf:"mcp_idle_ping_after"`
+
+	// Concurrency caps for tool calls made in parallel within a step, per analysis and
+	// per MCP server (0 = unlimited). At most MaxParallelToolCallsLimit calls of a step
+	// run at once regardless, so the per-analysis cap cannot be higher.
+	MaxParallelToolCalls  int `koanf:"max_parallel_tool_calls"`
+	MCPMaxConcurrentCalls int `koanf:"mcp_max_concurrent_calls"`
+
+	// MCP tool call timeouts: a default, and comma-separated name=duration overrides per
+	// server and per tool, e.g. "observability=90s" and "get_project_logs=3m". Tool
+	// timeouts take precedence over server timeouts.
+	MCPCallTimeout    time.Duration `koanf:"mcp_call_timeout"`
+	MCPServerTimeouts string        `koanf:"mcp_server_timeouts"`
+	MCPToolTimeouts   string        `koanf:"mcp_tool_timeouts"`
+
+	// How long successful MCP tool results are cached and shared across analyses, as
+	// comma-separated tool=duration pairs. Tools not listed are not cached, but identical
+	// calls within one analysis or in flight at the same time are still deduplicated.
+	MCPCacheTTLs string `koanf:"mcp_cache_ttls"`
+
+	// Limits on sampling requests, through which MCP servers have the model summarize
+	// their data: tokens sampled per request (0 disables sampling), estimated prompt
+	// tokens per request, and tokens per server per hour (0 = unlimited)
+	MCPSamplingMaxTokens      int64 `koanf:"mcp_sampling_max_tokens"`
+	MCPSamplingMaxInputTokens int64 `koanf:"mcp_sampling_max_input_tokens"`
+	MCPSamplingTokensPerHour  int64 `koanf:"mcp_sampling_tokens_per_hour"`
+
+	// Names MCP tools are offered to the model under, as comma-separated key=alias pairs:
+	// "server/tool=name" renames a tool, "server=prefix" the server part of mcp_<server>_<tool>
+	MCPToolAliases string `koanf:"mcp_tool_aliases"`
+
+	// How long a question an MCP server asks mid-analysis waits for a human answer
+	MCPElicitationTimeout time.Duration `koanf:"mcp_elicitation_timeout"`
+
 	// Logging
 	LogLevel string `koanf:"log_level"`
 
+	// Tracing: spans are exported over OTLP/HTTP to the endpoint (e.g.
+	// http://otel-collector:4318); no endpoint disables tracing
+	OTLPEndpoint     string  `koanf:"otlp_endpoint"`
+	TraceServiceName string  `koanf:"trace_service_name"`
+	TraceSampleRatio float64 `koanf:"trace_sample_ratio"`
+
+	// Storage of analysis reports and trajectories: memory, sqlite or opensearch.
+	// Unset, it is opensearch if the deprecated opensearch_reports is enabled and
+	// memory otherwise. Records older than the retention are deleted (0 keeps them).
+	StorageBackend          string        `koanf:"storage_backend"`
+	StorageSQLitePath       string        `koanf:"storage_sqlite_path"`
+	StorageMemoryMaxEntries int           `koanf:"storage_memory_max_entries"`
+	StorageRetention        time.Duration `koanf:"storage_retention"`
+	StorageCleanupInterval  time.Duration `koanf:"storage_cleanup_interval"`
+
+	// OpenAI-compatible embeddings API (e.g. https://api.openai.com/v1) with which the
+	// search_past_analyses tool ranks past analyses by meaning; no URL disables it
+	EmbeddingsBaseURL string `koanf:"embeddings_base_url"`
+	EmbeddingsModel   string `koanf:"embeddings_model"`
+	EmbeddingsAPIKey  string `koanf:"embeddings_api_key"`
+
 	// OpenSearch config
 	OpenSearchAddress  string `koanf:"opensearch_address"`
 	OpenSearchUsername string `koanf:"opensearch_username"`
 	OpenSearchPassword string `koanf:"opensearch_password"`
 
+	// Records are stored in indices named <prefix>-<kind>-YYYY.MM by the opensearch
+	// storage backend
+	OpenSearchIndexPrefix string `koanf:"opensearch_index_prefix"`
+	OpenSearchMaxRetries  int    `koanf:"opensearch_max_retries"`
+	// Deprecated: set storage_backend to opensearch instead
+	OpenSearchReports bool `koanf:"opensearch_reports"`
+
 	// OAuth2 Client Credentials
 	OAuthTokenURL     string `koanf:"oauth_token_url"`
 	OAuthClientID     string `koanf:"oauth_client_id"`
@@ -63,17 +194,93 @@ func Load() (*Config, error) {
 		"RCA_MODEL_NAME":  "rca_model_name",
 		"RCA_LLM_API_KEY": "rca_llm_api_key",
 
+		// Model fallbacks
+		"RCA_MODEL_FALLBACKS":       "rca_model_fallbacks",
+		"MODEL_MAX_RETRIES":         "model_max_retries",
+		"MODEL_RETRY_INITIAL_DELAY": "model_retry_initial_delay",
+		"MODEL_RETRY_MAX_DELAY":     "model_retry_max_delay",
+
+		// Generation parameters
+		"MODEL_TEMPERATURE":       "model_temperature",
+		"MODEL_TOP_P":             "model_top_p",
+		"MODEL_MAX_OUTPUT_TOKENS": "model_max_output_tokens",
+		"MODEL_REASONING_EFFORT":  "model_reasoning_effort",
+		"MODEL_THINKING_BUDGET":   "model_thinking_budget",
+
+		// Pricing and budgets
+		"MODEL_PRICING":            "model_pricing",
+		"ANALYSIS_TOKEN_BUDGET":    "analysis_token_budget",
+		"ANALYSIS_COST_BUDGET_USD": "analysis_cost_budget_usd",
+		"CALLER_TOKEN_BUDGET":      "caller_token_budget",
+		"CALLER_COST_BUDGET_USD":   "caller_cost_budget_usd",
+		"CALLER_BUDGET_WINDOW":     "caller_budget_window",
+
+		// Context management
+		"CONTEXT_COMPACTION_THRESHOLD": "context_compaction_threshold",
+		"CONTEXT_KEEP_RECENT_RESULTS":  "context_keep_recent_results",
+		"CONTEXT_SUMMARIZER":           "context_summarizer",
+
+		// Tool result limits
+		"TOOL_RESULT_MAX_BYTES":  "tool_result_max_bytes",
+		"TOOL_RESULT_MAX_TOKENS": "tool_result_max_tokens",
+		"TOOL_RESULT_LIMITS":     "tool_result_limits",
+
+		// Provider API keys
+		"OPENAI_API_KEY":                "openai_api_key",
+		"ANTHROPIC_API_KEY":             "anthropic_api_key",
+		"GOOGLE_API_KEY":                "google_api_key",
+		"OPENAICOMPAT_API_KEY":          "openaicompat_api_key",
+		"OPENAICOMPAT_BASE_URL":         "openaicompat_base_url",
+		"OPENAICOMPAT_REASONING_MODELS": "openaicompat_reasoning_models",
+
 		// MCP URLs
 		"OBSERVER_MCP_URL":   "observer_mcp_url",
 		"OPENCHOREO_MCP_URL": "openchoreo_mcp_url",
 
+		// MCP connection management
+		"MCP_TOOL_REFRESH_INTERVAL":     "mcp_tool_refresh_interval",
+		"MCP_RECONNECT_INITIAL_DELAY":   "mcp_reconnect_initial_delay",
+		"MCP_RECONNECT_MAX_DELAY":       "mcp_reconnect_max_delay",
+		"MCP_BREAKER_THRESHOLD":         "mcp_breaker_threshold",
+		"MCP_BREAKER_OPEN_DURATION":     "mcp_breaker_open_duration",
+		"MCP_IDLE_PING_AFTER":           "mcp_idle_ping_after",
+		"MAX_PARALLEL_TOOL_CALLS":       "max_parallel_tool_calls",
+		"MCP_MAX_CONCURRENT_CALLS":      "mcp_max_concurrent_calls",
+		"MCP_CALL_TIMEOUT":              "mcp_call_timeout",
+		"MCP_SERVER_TIMEOUTS":           "mcp_server_timeouts",
+		"MCP_TOOL_TIMEOUTS":             "mcp_tool_timeouts",
+		"MCP_CACHE_TTLS":                "mcp_cache_ttls",
+		"MCP_SAMPLING_MAX_TOKENS":       "mcp_sampling_max_tokens",
+		"MCP_SAMPLING_MAX_INPUT_TOKENS": "mcp_sampling_max_input_tokens",
+		"MCP_SAMPLING_TOKENS_PER_HOUR":  "mcp_sampling_tokens_per_hour",
+		"MCP_ELICITATION_TIMEOUT":       "mcp_elicitation_timeout",
+		"MCP_TOOL_ALIASES":              "mcp_tool_aliases",
+
 		// Logging
 		"LOG_LEVEL": "log_level",
 
+		// Tracing
+		"OTEL_EXPORTER_OTLP_ENDPOINT": "otlp_endpoint",
+		"OTEL_SERVICE_NAME":           "trace_service_name",
+		"TRACE_SAMPLE_RATIO":          "trace_sample_ratio",
+
+		// Storage
+		"STORAGE_BACKEND":            "storage_backend",
+		"STORAGE_SQLITE_PATH":        "storage_sqlite_path",
+		"STORAGE_MEMORY_MAX_ENTRIES": "storage_memory_max_entries",
+		"STORAGE_RETENTION":          "storage_retention",
+		"STORAGE_CLEANUP_INTERVAL":   "storage_cleanup_interval",
+		"EMBEDDINGS_BASE_URL":        "embeddings_base_url",
+		"EMBEDDINGS_MODEL":           "embeddings_model",
+		"EMBEDDINGS_API_KEY":         "embeddings_api_key",
+
 		// OpenSearch
-		"OPENSEARCH_ADDRESS":  "opensearch_address",
-		"OPENSEARCH_USERNAME": "opensearch_username",
-		"OPENSEARCH_PASSWORD": "opensearch_password",
+		"OPENSEARCH_ADDRESS":      "opensearch_address",
+		"OPENSEARCH_USERNAME":     "opensearch_username",
+		"OPENSEARCH_PASSWORD":     "opensearch_password",
+		"OPENSEARCH_INDEX_PREFIX": "opensearch_index_prefix",
+		"OPENSEARCH_MAX_RETRIES":  "opensearch_max_retries",
+		"OPENSEARCH_REPORTS":      "opensearch_reports",
 
 		// OAuth2
 		"OAUTH_TOKEN_URL":     "oauth_token_url",
@@ -116,6 +323,13 @@ func Load() (*Config, error) {
 
 	// Compute derived fields
 	cfg.AnalysisTimeout = time.Duration(cfg.AnalysisTimeoutSeconds) * time.Second
+	if cfg.StorageBackend == "" {
+		// Deployments that indexed reports in OpenSearch before storage backends existed keep doing so
+		cfg.StorageBackend = "memory"
+		if cfg.OpenSearchReports {
+			cfg.StorageBackend = "opensearch"
+		}
+	}
 
 	// Validate configuration
 	if err := cfg.validate(); err != nil {
@@ -131,17 +345,89 @@ func getDefaults() map[string]any {
 		"rca_model_name":  "",
 		"rca_llm_api_key": "",
 
+		// Model fallbacks
+		"rca_model_fallbacks":       "",
+		"model_max_retries":         2,
+		"model_retry_initial_delay": "1s",
+		"model_retry_max_delay":     "30s",
+
+		// Generation parameters (numeric ones have no default so they stay unset)
+		"model_reasoning_effort": "",
+
+		// Pricing and budgets
+		"model_pricing":            "",
+		"analysis_token_budget":    0,
+		"analysis_cost_budget_usd": 0,
+		"caller_token_budget":      0,
+		"caller_cost_budget_usd":   0,
+		"caller_budget_window":     "24h",
+
+		// Context management
+		"context_compaction_threshold": 100000,
+		"context_keep_recent_results":  4,
+		"context_summarizer":           "heuristic",
+
+		// Tool result limits
+		"tool_result_max_bytes":  100000,
+		"tool_result_max_tokens": 0,
+		"tool_result_limits":     "",
+
+		// Provider API keys
+		"openai_api_key":                "",
+		"anthropic_api_key":             "",
+		"google_api_key":                "",
+		"openaicompat_api_key":          "",
+		"openaicompat_base_url":         "",
+		"openaicompat_reasoning_models": "",
+
 		// MCP URLs
 		"observer_mcp_url":   "http://observer:8080/mcp",
 		"openchoreo_mcp_url": "http://openchoreo-api.openchoreo-control-plane.svc.cluster.local:8080/mcp",
 
+		// MCP connection management
+		"mcp_tool_refresh_interval":     "5m",
+		"mcp_reconnect_initial_delay":   "1s",
+		"mcp_reconnect_max_delay":       "1m",
+		"mcp_breaker_threshold":         5,
+		"mcp_breaker_open_duration":     "30s",
+		"mcp_idle_ping_after":           "1m",
+		"max_parallel_tool_calls":       4,
+		"mcp_max_concurrent_calls":      8,
+		"mcp_call_timeout":              "2m",
+		"mcp_server_timeouts":           "",
+		"mcp_tool_timeouts":             "",
+		"mcp_cache_ttls":                "list_organizations=10m,list_projects=5m,list_components=5m,list_environments=10m",
+		"mcp_sampling_max_tokens":       1024,
+		"mcp_sampling_max_input_tokens": 20000,
+		"mcp_sampling_tokens_per_hour":  200000,
+		"mcp_elicitation_timeout":       "5m",
+		"mcp_tool_aliases":              "",
+
 		// Logging
 		"log_level": "INFO",
 
+		// Tracing
+		"otlp_endpoint":      "",
+		"trace_service_name": "rca-agent",
+		"trace_sample_ratio": 1.0,
+
+		// Storage
+		"storage_backend":            "",
+		"storage_sqlite_path":        "rca-agent.db",
+		"storage_memory_max_entries": 500,
+		"storage_retention":          "720h",
+		"storage_cleanup_interval":   "1h",
+		"embeddings_base_url":        "",
+		"embeddings_model":           "text-embedding-3-small",
+		"embeddings_api_key":         "",
+
 		// OpenSearch
-		"opensearch_address":  "https://opensearch:9200",
-		"opensearch_username": "admin",
-		"opensearch_password": "ThisIsTheOpenSearchPassword1",
+		"opensearch_address":      "https://opensearch:9200",
+		"opensearch_username":     "admin",
+		"opensearch_password":     "ThisIsTheOpenSearchPassword1",
+		"opensearch_index_prefix": "rca-analyses",
+		"opensearch_max_retries":  3,
+		"opensearch_reports":      false,
 
 		// OAuth2
 		"oauth_token_url":     "",
@@ -168,10 +454,6 @@ func (c *Config) validate() error {
 		return fmt.Errorf("invalid server port: %d", c.ServerPort)
 	}
 
-	if c.RCALLMAPIKey == "" {
-		return fmt.Errorf("RCA_LLM_API_KEY is required")
-	}
-
 	if c.MaxConcurrentAnalyses <= 0 {
 		return fmt.Errorf("max_concurrent_analyses must be positive")
 	}
@@ -180,6 +462,121 @@ func (c *Config) validate() error {
 		return fmt.Errorf("analysis_timeout_seconds must be positive")
 	}
 
+	if c.ModelMaxRetries < 0 {
+		return fmt.Errorf("model_max_retries must not be negative")
+	}
+
+	if _, err := c.GetModelPricing(); err != nil {
+		return err
+	}
+
+	if c.AnalysisTokenBudget < 0 || c.AnalysisCostBudgetUSD < 0 ||
+		c.CallerTokenBudget < 0 || c.CallerCostBudgetUSD < 0 {
+		return fmt.Errorf("budgets must not be negative")
+	}
+
+	if c.CallerBudgetWindow <= 0 {
+		return fmt.Errorf("caller_budget_window must be positive")
+	}
+
+	if c.ContextCompactionThreshold < 0 || c.ContextKeepRecentResults < 0 {
+		return fmt.Errorf("context compaction settings must not be negative")
+	}
+
+	if c.ToolResultMaxBytes < 0 || c.ToolResultMaxTokens < 0 {
+		return fmt.Errorf("tool result limits must not be negative")
+	}
+
+	if _, err := c.GetToolResultLimits(); err != nil {
+		return err
+	}
+
+	if c.MCPToolRefreshInterval < 0 {
+		return fmt.Errorf("mcp_tool_refresh_interval must not be negative")
+	}
+
+	if c.MCPReconnectInitialDelay <= 0 || c.MCPReconnectMaxDelay < c.MCPReconnectInitialDelay {
+		return fmt.Errorf("mcp reconnect delays must be positive with max >= initial")
+	}
+
+	if c.MCPBreakerThreshold <= 0 || c.MCPBreakerOpenDuration <= 0 {
+		return fmt.Errorf("mcp circuit breaker settings must be positive")
+	}
+
+	if c.MCPIdlePingAfter <= 0 {
+		return fmt.Errorf("mcp_idle_ping_after must be positive")
+	}
+
+	if c.MaxParallelToolCalls < 0 || c.MCPMaxConcurrentCalls < 0 {
+		return fmt.Errorf("tool call concurrency limits must not be negative")
+	}
+	if c.MaxParallelToolCalls > MaxParallelToolCallsLimit {
+		return fmt.Errorf("max_parallel_tool_calls must be at most %d, the number of tool calls of a step the agent runs at once", MaxParallelToolCallsLimit)
+	}
+
+	if c.MCPCallTimeout <= 0 {
+		return fmt.Errorf("mcp_call_timeout must be positive")
+	}
+
+	if _, _, err := c.GetMCPCallTimeouts(); err != nil {
+		return err
+	}
+
+	if _, err := c.GetMCPCacheTTLs(); err != nil {
+		return err
+	}
+
+	if c.MCPSamplingMaxTokens < 0 || c.MCPSamplingMaxInputTokens < 0 || c.MCPSamplingTokensPerHour < 0 {
+		return fmt.Errorf("mcp sampling limits must not be negative")
+	}
+
+	if c.MCPElicitationTimeout <= 0 {
+		return fmt.Errorf("mcp_elicitation_timeout must be positive")
+	}
+
+	if _, err := c.GetMCPToolAliases(); err != nil {
+		return err
+	}
+
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		return fmt.Errorf("trace_sample_ratio must be between 0 and 1")
+	}
+
+	switch c.StorageBackend {
+	case "memory":
+		if c.StorageMemoryMaxEntries <= 0 {
+			return fmt.Errorf("storage_memory_max_entries must be positive")
+		}
+	case "sqlite":
+		if c.StorageSQLitePath == "" {
+			return fmt.Errorf("storage_sqlite_path is required for the sqlite storage backend")
+		}
+	case "opensearch":
+		if c.OpenSearchAddress == "" || c.OpenSearchIndexPrefix == "" {
+			return fmt.Errorf("opensearch_address and opensearch_index_prefix are required for the opensearch storage backend")
+		}
+	default:
+		return fmt.Errorf("invalid storage_backend %q (expected memory, sqlite or opensearch)", c.StorageBackend)
+	}
+
+	if c.StorageRetention < 0 || c.StorageCleanupInterval <= 0 {
+		return fmt.Errorf("storage_retention must not be negative and storage_cleanup_interval must be positive")
+	}
+
+	if c.EmbeddingsBaseURL != "" && c.EmbeddingsModel == "" {
+		return fmt.Errorf("embeddings_model is required with embeddings_base_url")
+	}
+
+	if c.OpenSearchMaxRetries < 0 {
+		return fmt.Errorf("opensearch_max_retries must not be negative")
+	}
+
+	switch c.ContextSummarizer {
+	case "heuristic", "llm":
+	default:
+		return fmt.Errorf("invalid context_summarizer %q (expected heuristic or llm)", c.ContextSummarizer)
+	}
+
 	return nil
 }
 
@@ -188,6 +585,144 @@ func (c *Config) IsOAuthConfigured() bool {
 	return c.OAuthTokenURL != "" && c.OAuthClientID != "" && c.OAuthClientSecret != ""
 }
 
+// GetModelFallbacks returns the ordered list of fallback model strings
+func (c *Config) GetModelFallbacks() []string {
+	var models []string
+	for _, m := range strings.Split(c.RCAModelFallbacks, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			models = append(models, m)
+		}
+	}
+	return models
+}
+
+// GetOpenAICompatReasoningModels returns the OpenAI-compatible models that accept a
+// reasoning effort
+func (c *Config) GetOpenAICompatReasoningModels() []string {
+	var models []string
+	for _, m := range strings.Split(c.OpenAICompatReasoningModels, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			models = append(models, m)
+		}
+	}
+	return models
+}
+
+// ModelPricing holds the price of a model in USD per 1M tokens
+type ModelPricing struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheRead  float64 `json:"cache_read"`
+	CacheWrite float64 `json:"cache_write"`
+}
+
+// GetModelPricing returns the configured pricing overrides, keyed by model
+func (c *Config) GetModelPricing() (map[string]ModelPricing, error) {
+	if c.ModelPricing == "" {
+		return nil, nil
+	}
+
+	var pricing map[string]ModelPricing
+	if err := json.Unmarshal([]byte(c.ModelPricing), &pricing); err != nil {
+		return nil, fmt.Errorf("invalid model_pricing: %w", err)
+	}
+	return pricing, nil
+}
+
+// ToolResultLimit caps the size of a single tool's results
+type ToolResultLimit struct {
+	MaxBytes  int
+	MaxTokens int
+}
+
+// GetToolResultLimits parses the per-tool result limits, keyed by MCP tool name
+func (c *Config) GetToolResultLimits() (map[string]ToolResultLimit, error) {
+	limits := make(map[string]ToolResultLimit)
+	for _, entry := range strings.Split(c.ToolResultLimits, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, size, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid tool_result_limits entry %q (expected tool=size)", entry)
+		}
+
+		var limit ToolResultLimit
+		size = strings.TrimSpace(size)
+		tokens, isTokens := strings.CutSuffix(size, "t")
+		n, err := strconv.Atoi(tokens)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid size in tool_result_limits entry %q", entry)
+		}
+		if isTokens {
+			limit.MaxTokens = n
+		} else {
+			limit.MaxBytes = n
+		}
+		limits[strings.TrimSpace(name)] = limit
+	}
+	return limits, nil
+}
+
+// GetMCPCallTimeouts returns the per-server and per-tool MCP call timeout overrides
+func (c *Config) GetMCPCallTimeouts() (servers, tools map[string]time.Duration, err error) {
+	if servers, err = parseDurations("mcp_server_timeouts", c.MCPServerTimeouts); err != nil {
+		return nil, nil, err
+	}
+	if tools, err = parseDurations("mcp_tool_timeouts", c.MCPToolTimeouts); err != nil {
+		return nil, nil, err
+	}
+	return servers, tools, nil
+}
+
+// GetMCPCacheTTLs returns the cache TTL of each MCP tool whose results are cached
+func (c *Config) GetMCPCacheTTLs() (map[string]time.Duration, error) {
+	return parseDurations("mcp_cache_ttls", c.MCPCacheTTLs)
+}
+
+// parseDurations parses comma-separated name=duration pairs.
+func parseDurations(key, value string) (map[string]time.Duration, error) {
+	durations := make(map[string]time.Duration)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, raw, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid %s entry %q (expected name=duration)", key, entry)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration in %s entry %q", key, entry)
+		}
+		durations[strings.TrimSpace(name)] = d
+	}
+	return durations, nil
+}
+
+// GetMCPToolAliases returns the configured MCP tool aliases, keyed by "server/tool" or "server"
+func (c *Config) GetMCPToolAliases() (map[string]string, error) {
+	aliases := make(map[string]string)
+	for _, entry := range strings.Split(c.MCPToolAliases, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, alias, ok := strings.Cut(entry, "=")
+		key, alias = strings.TrimSpace(key), strings.TrimSpace(alias)
+		if !ok || key == "" || alias == "" {
+			return nil, fmt.Errorf("invalid mcp_tool_aliases entry %q (expected server/tool=alias or server=alias)", entry)
+		}
+		aliases[key] = alias
+	}
+	return aliases, nil
+}
+
 // GetMCPServers returns the list of MCP server configurations
 func (c *Config) GetMCPServers() []MCPServerConfig {
 	var servers []MCPServerConfig
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// acceptsEventStream reports whether the client asked for server-sent events.
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// eventStream writes server-sent events to a response. Events may be sent
+// concurrently, e.g. progress from tool calls running in parallel, and after the
+// handler has returned, e.g. from a shared tool call that outlives the analysis;
+// those are dropped once the stream is closed.
+type eventStream struct {
+	mu     sync.Mutex
+	w      http.ResponseWriter
+	rc     *http.ResponseController
+	closed bool
+}
+
+// newEventStream starts an event stream response.
+func newEventStream(w http.ResponseWriter) *eventStream {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	s := &eventStream{w: w, rc: http.NewResponseController(w)}
+	s.rc.Flush()
+	return s
+}
+
+// send writes an event with data encoded as JSON and flushes it to the client.
+func (s *eventStream) send(event string, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("Failed to encode event", "event", event, "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload)
+	if err := s.rc.Flush(); err != nil {
+		slog.Debug("Failed to flush event", "event", event, "error", err)
+	}
+}
+
+// close stops the stream from writing to the response. It must be called before
+// the handler returns.
+func (s *eventStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+}
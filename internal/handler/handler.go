@@ -3,16 +3,36 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
 	"rca.agent/test/internal/agent"
+	"rca.agent/test/internal/mcp"
+	"rca.agent/test/internal/metrics"
+	"rca.agent/test/internal/reports"
+	"rca.agent/test/internal/storage"
 )
 
+var tracer = otel.Tracer("rca.agent/test/internal/handler")
+
 // AnalysisService defines the interface for analysis operations.
 type AnalysisService interface {
-	Analyze(ctx context.Context, prompt string) (*agent.AnalysisResult, error)
+	Analyze(ctx context.Context, req agent.Request) (*agent.AnalysisResult, error)
+	MCPHealth() []mcp.ServerHealth
+	Profiles(ctx context.Context) []mcp.Prompt
+	Elicitations(caller string) []agent.PendingElicitation
+	AnswerElicitation(caller, id string, resp mcp.ElicitationResponse) error
+	Trajectory(ctx context.Context, id string) (*agent.Trajectory, error)
+	SearchAnalyses(ctx context.Context, q reports.Query) ([]reports.Report, error)
 }
 
 // Handler handles HTTP requests.
@@ -32,7 +52,14 @@ func New(analysis AnalysisService, timeout time.Duration) *Handler {
 // RegisterRoutes registers all routes on the given mux.
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("GET /health", h.Health)
+	mux.HandleFunc("GET /health/mcp", h.MCPHealth)
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.HandleFunc("GET /profiles", h.Profiles)
 	mux.HandleFunc("POST /analyze", h.Analyze)
+	mux.HandleFunc("GET /analyses", h.SearchAnalyses)
+	mux.HandleFunc("GET /analyses/{id}/trajectory", h.Trajectory)
+	mux.HandleFunc("GET /elicitations", h.Elicitations)
+	mux.HandleFunc("POST /elicitations/{id}", h.AnswerElicitation)
 }
 
 // Health handles health check requests.
@@ -41,11 +68,75 @@ func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+// MCPHealth reports the connection state of each MCP server. The overall status is
+// "ok" when all servers are connected, "degraded" when some are not, and "down"
+// (with 503) when none are usable.
+func (h *Handler) MCPHealth(w http.ResponseWriter, r *http.Request) {
+	servers := h.analysis.MCPHealth()
+
+	status, usable := "ok", 0
+	for _, s := range servers {
+		if s.State != mcp.StateDown {
+			usable++
+		}
+		if s.State != mcp.StateConnected {
+			status = "degraded"
+		}
+	}
+
+	code := http.StatusOK
+	if len(servers) > 0 && usable == 0 {
+		status, code = "down", http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{"status": status, "servers": servers})
+}
+
+// Profiles lists the analysis profiles that requests can select.
+func (h *Handler) Profiles(w http.ResponseWriter, r *http.Request) {
+	profiles := h.analysis.Profiles(r.Context())
+	if profiles == nil {
+		profiles = []mcp.Prompt{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"profiles": profiles})
+}
+
+// Elicitations lists the questions MCP servers asked during the in-flight analyses of
+// the caller in the X-Caller-ID header that await a human answer.
+func (h *Handler) Elicitations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"elicitations": h.analysis.Elicitations(r.Header.Get("X-Caller-ID"))})
+}
+
+// AnswerElicitation answers a pending question, resuming the analysis that waits on it.
+// Only the caller whose analysis asked it, in the X-Caller-ID header, may answer.
+func (h *Handler) AnswerElicitation(w http.ResponseWriter, r *http.Request) {
+	var resp mcp.ElicitationResponse
+	if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	err := h.analysis.AnswerElicitation(r.Header.Get("X-Caller-ID"), r.PathValue("id"), resp)
+	if errors.Is(err, mcp.ErrUnknownElicitation) {
+		h.writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // Analyze handles analysis requests.
 func (h *Handler) Analyze(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Prompt string `json:"prompt"`
-	}
+	var req agent.Request
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.writeError(w, http.StatusBadRequest, "invalid request body")
 		return
@@ -56,23 +147,161 @@ func (h *Handler) Analyze(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Caller == "" {
+		req.Caller = r.Header.Get("X-Caller-ID")
+	}
+
+	if err := req.Validate(); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The ID is returned up front so that the trajectory of a failed analysis can be found
+	req.ID = agent.NewAnalysisID()
+	w.Header().Set("X-Analysis-ID", req.ID)
+
 	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
 	defer cancel()
 
+	// Callers that trace their requests get the analysis in the same trace
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "analyze",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("analysis.id", req.ID),
+			attribute.String("analysis.caller", req.Caller),
+			attribute.String("analysis.profile", req.Profile),
+		))
+	defer span.End()
+
+	// Clients that accept an event stream get the progress of tool calls, and the
+	// questions that block them, as it happens
+	var events *eventStream
+	if acceptsEventStream(r) {
+		events = newEventStream(w)
+		defer events.close()
+		req.OnProgress = func(p mcp.Progress) { events.send("progress", p) }
+		req.OnPendingElicitation = func(e agent.PendingElicitation) { events.send("elicitation", e) }
+	}
+
 	startTime := time.Now()
 
-	result, err := h.analysis.Analyze(ctx, req.Prompt)
+	result, err := h.analysis.Analyze(ctx, req)
 	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, err.Error())
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		status := analysisErrorStatus(err)
+		if events != nil {
+			events.send("error", map[string]any{"error": err.Error(), "status": status})
+			return
+		}
+		h.writeError(w, status, err.Error())
 		return
 	}
 
-	slog.Info("Analysis completed", "duration", time.Since(startTime))
+	slog.Info("Analysis completed",
+		"id", result.ID,
+		"duration", time.Since(startTime),
+		"caller", result.Caller,
+		"tokens", result.Usage.TotalTokens,
+		"cost_usd", result.Usage.CostUSD,
+		"tool_calls", result.ToolCalls,
+		"tool_failures", result.ToolFailures)
+	span.SetAttributes(
+		attribute.Int("analysis.steps", result.TotalSteps),
+		attribute.Int64("analysis.tokens", result.Usage.TotalTokens),
+		attribute.Float64("analysis.cost_usd", result.Usage.CostUSD),
+		attribute.Int("analysis.tool_calls", result.ToolCalls),
+		attribute.Bool("analysis.budget_exceeded", result.BudgetExceeded),
+	)
 
+	if events != nil {
+		events.send("result", result)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
 
+// analysisErrorStatus returns the HTTP status for an analysis that failed with err.
+func analysisErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, agent.ErrBudgetExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, agent.ErrUnknownProfile), errors.Is(err, agent.ErrInvalidProfileArguments):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// SearchAnalyses searches the reports of past analyses. Query parameters: q (full
+// text), org, project, component, caller, from and to (RFC 3339) and limit.
+func (h *Handler) SearchAnalyses(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := reports.Query{
+		Text:         params.Get("q"),
+		Organization: params.Get("org"),
+		Project:      params.Get("project"),
+		Component:    params.Get("component"),
+		Caller:       params.Get("caller"),
+	}
+	for name, t := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if v := params.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				h.writeError(w, http.StatusBadRequest, "invalid "+name+": expected an RFC 3339 time")
+				return
+			}
+			*t = parsed
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			h.writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		q.Limit = limit
+	}
+
+	found, err := h.analysis.SearchAnalyses(r.Context(), q)
+	if err != nil {
+		h.writeError(w, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"analyses": found})
+}
+
+// Trajectory returns the recorded trajectory of an analysis: its prompts, every
+// model response and tool call, and its outcome.
+func (h *Handler) Trajectory(w http.ResponseWriter, r *http.Request) {
+	trajectory, err := h.analysis.Trajectory(r.Context(), r.PathValue("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		h.writeError(w, http.StatusNotFound, "analysis not found")
+		return
+	}
+	if err != nil {
+		h.writeError(w, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trajectory)
+}
+
+// storeErrorStatus returns the HTTP status for a failed read of the store: a bad
+// gateway if its remote backend failed, an internal error otherwise.
+func storeErrorStatus(err error) int {
+	if errors.Is(err, storage.ErrUpstream) {
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
 func (h *Handler) writeError(w http.ResponseWriter, status int, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
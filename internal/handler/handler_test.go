@@ -0,0 +1,566 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"rca.agent/test/internal/agent"
+	"rca.agent/test/internal/config"
+	"rca.agent/test/internal/mcp"
+	"rca.agent/test/internal/reports"
+	"rca.agent/test/internal/service"
+	"rca.agent/test/internal/storage"
+)
+
+// stubService answers analyses with analyze; its other methods are not implemented.
+type stubService struct {
+	AnalysisService
+	analyze func(ctx context.Context, req agent.Request) (*agent.AnalysisResult, error)
+}
+
+func (s *stubService) Analyze(ctx context.Context, req agent.Request) (*agent.AnalysisResult, error) {
+	return s.analyze(ctx, req)
+}
+
+// fakeAnalyzer stands in for the agent behind the analysis service.
+type fakeAnalyzer struct {
+	analyze  func(ctx context.Context, req agent.Request) (*agent.AnalysisResult, error)
+	health   []mcp.ServerHealth
+	profiles []mcp.Prompt
+}
+
+func (a *fakeAnalyzer) Analyze(ctx context.Context, req agent.Request) (*agent.AnalysisResult, error) {
+	return a.analyze(ctx, req)
+}
+
+func (a *fakeAnalyzer) MCPHealth() []mcp.ServerHealth         { return a.health }
+func (a *fakeAnalyzer) Profiles(context.Context) []mcp.Prompt { return a.profiles }
+func (a *fakeAnalyzer) Close() error                          { return nil }
+
+// newTestMux returns the routes of a handler on the analysis service, with the
+// analyzer and a memory store.
+func newTestMux(t *testing.T, a *fakeAnalyzer) (*http.ServeMux, *storage.MemoryStore) {
+	t.Helper()
+	store := storage.NewMemoryStore(100)
+	svc := service.New(a, store, &config.Config{})
+	t.Cleanup(func() { svc.Close() })
+
+	mux := http.NewServeMux()
+	New(svc, time.Minute).RegisterRoutes(mux)
+	return mux, store
+}
+
+// serve sends a request to the mux, with a JSON body unless body is empty.
+func serve(mux *http.ServeMux, method, target, body string) *httptest.ResponseRecorder {
+	return serveAs(mux, "", method, target, body)
+}
+
+// serveAs sends a request to the mux on behalf of a caller.
+func serveAs(mux *http.ServeMux, caller, method, target, body string) *httptest.ResponseRecorder {
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest(method, target, nil)
+	} else {
+		r = httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if caller != "" {
+		r.Header.Set("X-Caller-ID", caller)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, r)
+	return rec
+}
+
+// decode decodes a JSON response body into v.
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+}
+
+// event is a server-sent event.
+type event struct {
+	name string
+	data string
+}
+
+// readEvents reads the events of a response body until it ends.
+func readEvents(t *testing.T, resp *http.Response) []event {
+	t.Helper()
+	scanner := bufio.NewScanner(resp.Body)
+	var events []event
+	for {
+		e, ok := nextEvent(t, scanner)
+		if !ok {
+			return events
+		}
+		events = append(events, e)
+	}
+}
+
+// nextEvent reads the next event from a response body, reporting false at its end.
+func nextEvent(t *testing.T, scanner *bufio.Scanner) (event, bool) {
+	t.Helper()
+	var current event
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			current.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		case line == "":
+			return current, true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("reading events: %v", err)
+	}
+	return event{}, false
+}
+
+func TestAnalyzeStreamsProgress(t *testing.T) {
+	service := &stubService{analyze: func(ctx context.Context, req agent.Request) (*agent.AnalysisResult, error) {
+		if req.OnProgress != nil {
+			req.OnProgress(mcp.Progress{Server: "observability", Tool: "get_project_logs", ToolCallID: "call-1", Progress: 1, Total: 2})
+		}
+		return &agent.AnalysisResult{ID: req.ID, Text: "payments is out of memory"}, nil
+	}}
+	mux := http.NewServeMux()
+	New(service, time.Minute).RegisterRoutes(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	post := func(accept string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/analyze", strings.NewReader(`{"prompt": "why is payments failing?"}`))
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /analyze: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := post("text/event-stream")
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	events := readEvents(t, resp)
+	if len(events) != 2 || events[0].name != "progress" || events[1].name != "result" {
+		t.Fatalf("events = %+v, want progress then result", events)
+	}
+	var progress mcp.Progress
+	if err := json.Unmarshal([]byte(events[0].data), &progress); err != nil || progress.ToolCallID != "call-1" || progress.Total != 2 {
+		t.Errorf("progress event = %s", events[0].data)
+	}
+	var result agent.AnalysisResult
+	if err := json.Unmarshal([]byte(events[1].data), &result); err != nil || result.ID != resp.Header.Get("X-Analysis-ID") {
+		t.Errorf("result event = %s", events[1].data)
+	}
+
+	// Without an event stream the result is returned as JSON, and progress only logged
+	resp = post("application/json")
+	result = agent.AnalysisResult{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || resp.StatusCode != http.StatusOK || result.Text != "payments is out of memory" {
+		t.Errorf("non-streaming response = %d %+v, %v", resp.StatusCode, result, err)
+	}
+}
+
+func TestAnalyzeDropsEventsAfterReturning(t *testing.T) {
+	var late func(mcp.Progress)
+	service := &stubService{analyze: func(ctx context.Context, req agent.Request) (*agent.AnalysisResult, error) {
+		late = req.OnProgress
+		return &agent.AnalysisResult{ID: req.ID}, nil
+	}}
+	mux := http.NewServeMux()
+	New(service, time.Minute).RegisterRoutes(mux)
+
+	r := httptest.NewRequest(http.MethodPost, "/analyze", strings.NewReader(`{"prompt": "why is payments failing?"}`))
+	r.Header.Set("Accept", "text/event-stream")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, r)
+	body := rec.Body.String()
+
+	// Progress from a tool call that outlives the analysis
+	late(mcp.Progress{Tool: "get_project_logs", ToolCallID: "call-1", Progress: 1})
+	if rec.Body.String() != body {
+		t.Errorf("event written after the handler returned: %q", strings.TrimPrefix(rec.Body.String(), body))
+	}
+}
+
+func TestAnalyzeStreamsElicitations(t *testing.T) {
+	mux, _ := newTestMux(t, &fakeAnalyzer{analyze: func(ctx context.Context, req agent.Request) (*agent.AnalysisResult, error) {
+		resp, err := req.OnElicit(ctx, mcp.Elicitation{ID: "q-1", Server: "deployments", Message: "Restart payments?"})
+		if err != nil {
+			return nil, err
+		}
+		return &agent.AnalysisResult{ID: req.ID, Text: resp.Action}, nil
+	}})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/analyze", strings.NewReader(`{"prompt": "why is payments failing?"}`))
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("X-Caller-ID", "team-a")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /analyze: %v", err)
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+
+	// The question arrives while the analysis waits on it
+	e, _ := nextEvent(t, scanner)
+	var pending agent.PendingElicitation
+	if err := json.Unmarshal([]byte(e.data), &pending); e.name != "elicitation" || err != nil || pending.ID != "q-1" || pending.Caller != "team-a" {
+		t.Fatalf("first event = %+v, want the elicitation", e)
+	}
+
+	answer, _ := http.NewRequest(http.MethodPost, server.URL+"/elicitations/q-1", strings.NewReader(`{"action": "accept"}`))
+	answer.Header.Set("X-Caller-ID", "team-a")
+	answerResp, err := http.DefaultClient.Do(answer)
+	if err != nil || answerResp.StatusCode != http.StatusNoContent {
+		t.Fatalf("answering = %v, %v", answerResp, err)
+	}
+	answerResp.Body.Close()
+
+	e, _ = nextEvent(t, scanner)
+	var result agent.AnalysisResult
+	if err := json.Unmarshal([]byte(e.data), &result); e.name != "result" || err != nil || result.Text != "accept" {
+		t.Errorf("second event = %+v, want the result of the answered analysis", e)
+	}
+}
+
+func TestAnalyzeStreamsErrors(t *testing.T) {
+	service := &stubService{analyze: func(context.Context, agent.Request) (*agent.AnalysisResult, error) {
+		return nil, agent.ErrBudgetExceeded
+	}}
+	mux := http.NewServeMux()
+	New(service, time.Minute).RegisterRoutes(mux)
+
+	req := httptest.NewRequest(http.MethodPost, "/analyze", strings.NewReader(`{"prompt": "why?"}`))
+	req.Header.Set("Accept", "text/event-stream")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	events := readEvents(t, rec.Result())
+	if len(events) != 1 || events[0].name != "error" || !strings.Contains(events[0].data, `"status":429`) {
+		t.Errorf("events = %+v, want an error with status 429", events)
+	}
+}
+
+func TestAnalysisErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{agent.ErrBudgetExceeded, http.StatusTooManyRequests},
+		{fmt.Errorf("%w: rca/oom", agent.ErrUnknownProfile), http.StatusBadRequest},
+		{fmt.Errorf("%w: rca/oom requires argument %q", agent.ErrInvalidProfileArguments, "service"), http.StatusBadRequest},
+		{context.DeadlineExceeded, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := analysisErrorStatus(tt.err); got != tt.want {
+			t.Errorf("analysisErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestStoreErrorStatus(t *testing.T) {
+	if got := storeErrorStatus(fmt.Errorf("search reports: %w", storage.ErrUpstream)); got != http.StatusBadGateway {
+		t.Errorf("status of a backend failure = %d, want 502", got)
+	}
+	if got := storeErrorStatus(fmt.Errorf("search reports: %w", context.Canceled)); got != http.StatusInternalServerError {
+		t.Errorf("status of a local failure = %d, want 500", got)
+	}
+}
+
+// recordSpans installs a tracer provider that records spans, once: the package's
+// tracer keeps the first provider installed.
+var recordSpans = sync.OnceValue(func() *tracetest.SpanRecorder {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	return spans
+})
+
+func TestAnalyzeContinuesCallerTrace(t *testing.T) {
+	spans := recordSpans()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var analysisSpan trace.SpanContext
+	service := &stubService{analyze: func(ctx context.Context, req agent.Request) (*agent.AnalysisResult, error) {
+		analysisSpan = trace.SpanContextFromContext(ctx)
+		return &agent.AnalysisResult{ID: req.ID}, nil
+	}}
+	mux := http.NewServeMux()
+	New(service, time.Minute).RegisterRoutes(mux)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/analyze", strings.NewReader(`{"prompt": "why?", "caller": "team-a"}`))
+	req.Header.Set("Traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if analysisSpan.TraceID().String() != traceID {
+		t.Errorf("analysis trace = %s, want the caller's %s", analysisSpan.TraceID(), traceID)
+	}
+
+	var span sdktrace.ReadOnlySpan
+	for _, s := range spans.Ended() {
+		if s.SpanContext().SpanID() == analysisSpan.SpanID() {
+			span = s
+		}
+	}
+	if span == nil || span.Name() != "analyze" {
+		t.Fatalf("span = %v, want the ended analyze span", span)
+	}
+	attrs := attribute.NewSet(span.Attributes()...)
+	if v, _ := attrs.Value("analysis.id"); v.AsString() != rec.Header().Get("X-Analysis-ID") {
+		t.Errorf("analysis.id = %v, want %s", v, rec.Header().Get("X-Analysis-ID"))
+	}
+	if v, _ := attrs.Value("analysis.caller"); v.AsString() != "team-a" {
+		t.Errorf("analysis.caller = %v", v)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	mux := http.NewServeMux()
+	New(&stubService{}, time.Minute).RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("GET /metrics = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	for _, name := range []string{"rca_analyses_active", "rca_analyses_max_concurrent", "go_goroutines"} {
+		if !strings.Contains(rec.Body.String(), "\n"+name+" ") {
+			t.Errorf("metrics lack %s", name)
+		}
+	}
+}
+
+func TestMCPHealth(t *testing.T) {
+	tests := []struct {
+		name       string
+		states     []mcp.ServerState
+		wantCode   int
+		wantStatus string
+	}{
+		{"no servers", nil, http.StatusOK, "ok"},
+		{"all connected", []mcp.ServerState{mcp.StateConnected, mcp.StateConnected}, http.StatusOK, "ok"},
+		{"some down", []mcp.ServerState{mcp.StateConnected, mcp.StateDown}, http.StatusOK, "degraded"},
+		{"degraded", []mcp.ServerState{mcp.StateDegraded}, http.StatusOK, "degraded"},
+		{"all down", []mcp.ServerState{mcp.StateDown, mcp.StateDown}, http.StatusServiceUnavailable, "down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analyzer := &fakeAnalyzer{}
+			for i, state := range tt.states {
+				analyzer.health = append(analyzer.health, mcp.ServerHealth{Name: fmt.Sprintf("server-%d", i), State: state})
+			}
+			mux, _ := newTestMux(t, analyzer)
+
+			rec := serve(mux, http.MethodGet, "/health/mcp", "")
+			var body struct {
+				Status  string             `json:"status"`
+				Servers []mcp.ServerHealth `json:"servers"`
+			}
+			decode(t, rec, &body)
+			if rec.Code != tt.wantCode || body.Status != tt.wantStatus || len(body.Servers) != len(tt.states) {
+				t.Errorf("GET /health/mcp = %d %+v, want %d %s", rec.Code, body, tt.wantCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	mux, _ := newTestMux(t, &fakeAnalyzer{})
+	rec := serve(mux, http.MethodGet, "/profiles", "")
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"profiles":[]}` {
+		t.Errorf("GET /profiles without profiles = %d %s", rec.Code, rec.Body)
+	}
+
+	mux, _ = newTestMux(t, &fakeAnalyzer{profiles: []mcp.Prompt{{Server: "observability", Name: "oom"}}})
+	var body struct {
+		Profiles []mcp.Prompt `json:"profiles"`
+	}
+	decode(t, serve(mux, http.MethodGet, "/profiles", ""), &body)
+	if len(body.Profiles) != 1 || body.Profiles[0].Name != "oom" {
+		t.Errorf("profiles = %+v", body.Profiles)
+	}
+}
+
+func TestTrajectory(t *testing.T) {
+	mux, store := newTestMux(t, &fakeAnalyzer{})
+	store.SaveTrajectory(context.Background(), &agent.Trajectory{ID: "a-1", Prompt: "why is payments failing?", StartedAt: time.Now()})
+
+	rec := serve(mux, http.MethodGet, "/analyses/a-1/trajectory", "")
+	var trajectory agent.Trajectory
+	decode(t, rec, &trajectory)
+	if rec.Code != http.StatusOK || trajectory.ID != "a-1" || trajectory.Prompt != "why is payments failing?" {
+		t.Errorf("GET trajectory = %d %+v", rec.Code, trajectory)
+	}
+
+	if rec := serve(mux, http.MethodGet, "/analyses/unknown/trajectory", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET unknown trajectory = %d, want 404", rec.Code)
+	}
+}
+
+func TestElicitations(t *testing.T) {
+	mux, _ := newTestMux(t, &fakeAnalyzer{analyze: func(ctx context.Context, req agent.Request) (*agent.AnalysisResult, error) {
+		resp, err := req.OnElicit(ctx, mcp.Elicitation{ID: "q-" + req.Caller, Server: "deployments", Message: "Restart payments?"})
+		if err != nil {
+			return nil, err
+		}
+		return &agent.AnalysisResult{ID: req.ID, Text: resp.Action}, nil
+	}})
+
+	results := make(map[string]chan *httptest.ResponseRecorder)
+	for _, caller := range []string{"team-a", "team-b"} {
+		result := make(chan *httptest.ResponseRecorder, 1)
+		results[caller] = result
+		go func() {
+			result <- serve(mux, http.MethodPost, "/analyze", `{"prompt": "why?", "caller": "`+caller+`"}`)
+		}()
+	}
+
+	var body struct {
+		Elicitations []agent.PendingElicitation `json:"elicitations"`
+	}
+	pending := func(caller string) []agent.PendingElicitation {
+		body.Elicitations = nil
+		decode(t, serveAs(mux, caller, http.MethodGet, "/elicitations", ""), &body)
+		return body.Elicitations
+	}
+	for _, caller := range []string{"team-a", "team-b"} {
+		for deadline := time.Now().Add(5 * time.Second); len(pending(caller)) == 0; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s has no pending elicitation", caller)
+			}
+		}
+	}
+
+	// Callers only see and answer the questions of their own analyses
+	if p := pending("team-a"); len(p) != 1 || p[0].ID != "q-team-a" || p[0].Caller != "team-a" {
+		t.Errorf("team-a's elicitations = %+v", p)
+	}
+	if p := pending(""); len(p) != 0 {
+		t.Errorf("elicitations without a caller = %+v, want none", p)
+	}
+	if rec := serveAs(mux, "team-b", http.MethodPost, "/elicitations/q-team-a", `{"action": "accept"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("answering another caller's elicitation = %d, want 404", rec.Code)
+	}
+	if rec := serveAs(mux, "team-a", http.MethodPost, "/elicitations/unknown", `{"action": "accept"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("answering an unknown elicitation = %d, want 404", rec.Code)
+	}
+	if rec := serveAs(mux, "team-a", http.MethodPost, "/elicitations/q-team-a", `{"action": "maybe"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("answering with an invalid action = %d, want 400", rec.Code)
+	}
+
+	for caller, action := range map[string]string{"team-a": "accept", "team-b": "decline"} {
+		if rec := serveAs(mux, caller, http.MethodPost, "/elicitations/q-"+caller, `{"action": "`+action+`"}`); rec.Code != http.StatusNoContent {
+			t.Errorf("answering %s = %d %s, want 204", caller, rec.Code, rec.Body)
+		}
+		rec := <-results[caller]
+		var result agent.AnalysisResult
+		decode(t, rec, &result)
+		if rec.Code != http.StatusOK || result.Text != action {
+			t.Errorf("%s's analysis = %d %+v, want it answered with %s", caller, rec.Code, result, action)
+		}
+		if p := pending(caller); len(p) != 0 {
+			t.Errorf("%s's elicitations after answering = %+v, want none", caller, p)
+		}
+	}
+}
+
+func TestSearchAnalyses(t *testing.T) {
+	mux, _ := newTestMux(t, &fakeAnalyzer{analyze: func(ctx context.Context, req agent.Request) (*agent.AnalysisResult, error) {
+		return &agent.AnalysisResult{
+			ID:       req.ID,
+			Caller:   req.Caller,
+			Output:   map[string]any{"summary": req.Caller + " hit an out of memory error"},
+			Entities: agent.Entities{Projects: []string{"payments"}},
+		}, nil
+	}})
+
+	// Searches also check that analyses run through the service are reported
+	for _, caller := range []string{"team-a", "team-b"} {
+		if rec := serve(mux, http.MethodPost, "/analyze", `{"prompt": "why is payments failing?", "caller": "`+caller+`"}`); rec.Code != http.StatusOK {
+			t.Fatalf("POST /analyze = %d %s", rec.Code, rec.Body)
+		}
+	}
+	var body struct {
+		Analyses []reports.Report `json:"analyses"`
+	}
+	for deadline := time.Now().Add(5 * time.Second); len(body.Analyses) < 2; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("reported analyses = %+v, want two", body.Analyses)
+		}
+		decode(t, serve(mux, http.MethodGet, "/analyses", ""), &body)
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		wantCode    int
+		wantCallers []string
+	}{
+		{"caller", "?caller=team-a", http.StatusOK, []string{"team-a"}},
+		{"unknown caller", "?caller=team-c", http.StatusOK, nil},
+		{"full text", "?q=team-b+memory", http.StatusOK, []string{"team-b"}},
+		{"project", "?project=payments&caller=team-b", http.StatusOK, []string{"team-b"}},
+		{"other project", "?project=checkout", http.StatusOK, nil},
+		{"limit", "?limit=1", http.StatusOK, []string{"team-b"}},
+		{"future", "?from=" + time.Now().Add(time.Hour).UTC().Format(time.RFC3339), http.StatusOK, nil},
+		{"invalid time", "?from=yesterday", http.StatusBadRequest, nil},
+		{"invalid limit", "?limit=-1", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(mux, http.MethodGet, "/analyses"+tt.query, "")
+			if rec.Code != tt.wantCode {
+				t.Fatalf("GET /analyses%s = %d %s, want %d", tt.query, rec.Code, rec.Body, tt.wantCode)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			body.Analyses = nil
+			decode(t, rec, &body)
+			var callers []string
+			for _, r := range body.Analyses {
+				callers = append(callers, r.Caller)
+			}
+			if !slices.Equal(callers, tt.wantCallers) {
+				t.Errorf("GET /analyses%s callers = %v, want %v", tt.query, callers, tt.wantCallers)
+			}
+		})
+	}
+
+	decode(t, serve(mux, http.MethodGet, "/analyses?caller=team-a", ""), &body)
+	if r := body.Analyses[0]; r.Summary != "team-a hit an out of memory error" || r.Prompt != "why is payments failing?" || r.ID == "" {
+		t.Errorf("report = %+v", r)
+	}
+}
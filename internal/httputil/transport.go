@@ -4,6 +4,9 @@ import (
 	"crypto/tls"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 // NewHTTPClient creates an HTTP client with common configuration.
@@ -18,7 +21,8 @@ func NewHTTPClient(timeout time.Duration, skipTLSVerify bool) *http.Client {
 	}
 }
 
-// HeaderRoundTripper wraps a transport to inject headers into all requests.
+// HeaderRoundTripper wraps a transport to inject headers into all requests, along
+// with the trace context of the request's context.
 type HeaderRoundTripper struct {
 	Headers   map[string]string
 	Transport http.RoundTripper
@@ -29,6 +33,7 @@ func (rt *HeaderRoundTripper) RoundTrip(req *http.Request) (*http.Response, erro
 	for k, v := range rt.Headers {
 		req.Header.Set(k, v)
 	}
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
 	return rt.Transport.RoundTrip(req)
 }
 
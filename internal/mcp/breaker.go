@@ -0,0 +1,123 @@
+package mcp
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerOpenFor   = 30 * time.Second
+)
+
+// CircuitState is the state of a server's circuit breaker.
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"    // Calls go through
+	CircuitOpen     CircuitState = "open"      // Calls fail fast until the open period elapses
+	CircuitHalfOpen CircuitState = "half_open" // A single probe call is let through
+)
+
+// circuitOpenError is returned for calls rejected by an open circuit.
+type circuitOpenError struct {
+	server   string
+	failures int
+	retryIn  time.Duration
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("MCP server '%s' unavailable: circuit open after %d consecutive failures, retrying in %s",
+		e.server, e.failures, e.retryIn.Round(time.Second))
+}
+
+// circuitBreaker stops calls to a server after repeated failures. After openFor it
+// lets a single probe through; the probe's outcome closes or re-opens the circuit.
+type circuitBreaker struct {
+	server    string
+	threshold int
+	openFor   time.Duration
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+}
+
+func newCircuitBreaker(server string, threshold int, openFor time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	if openFor <= 0 {
+		openFor = defaultBreakerOpenFor
+	}
+	return &circuitBreaker{server: server, threshold: threshold, openFor: openFor, state: CircuitClosed}
+}
+
+// allow reports whether a call may proceed. When the open period has elapsed the
+// caller becomes the probe and must report its outcome with success or failure.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if elapsed := time.Since(b.openedAt); elapsed < b.openFor {
+			return &circuitOpenError{server: b.server, failures: b.failures, retryIn: b.openFor - elapsed}
+		}
+		b.state = CircuitHalfOpen
+		return nil
+	case CircuitHalfOpen:
+		// A probe is already in flight
+		return &circuitOpenError{server: b.server, failures: b.failures, retryIn: 0}
+	default:
+		return nil
+	}
+}
+
+// probeDue reports whether the circuit is open and its open period has elapsed.
+func (b *circuitBreaker) probeDue() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == CircuitOpen && time.Since(b.openedAt) >= b.openFor
+}
+
+// success records a successful call and closes the circuit.
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = CircuitClosed
+	b.failures = 0
+}
+
+// failure records a failed call, opening the circuit once the threshold is reached
+// or when a probe fails.
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		b.state = CircuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// abandon records a call that was cancelled before its outcome was known. It counts
+// neither way; a cancelled probe lets the next call probe instead.
+func (b *circuitBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitHalfOpen {
+		b.state = CircuitOpen
+	}
+}
+
+func (b *circuitBreaker) current() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
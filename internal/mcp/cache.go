@@ -0,0 +1,237 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"charm.land/fantasy"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// maxCacheEntries bounds the shared result cache.
+const maxCacheEntries = 1000
+
+// CacheStatus tells how a tool result was obtained.
+type CacheStatus string
+
+const (
+	CacheMiss   CacheStatus = "miss"   // The tool was called
+	CacheHit    CacheStatus = "hit"    // Served from the cache
+	CacheShared CacheStatus = "shared" // Shared with an identical call that was in flight
+)
+
+// ResultMetadata is attached to successful tool responses as their client metadata.
+type ResultMetadata struct {
+	Cache CacheStatus `json:"cache"`
+}
+
+type cacheEntry struct {
+	response fantasy.ToolResponse
+	expires  time.Time
+}
+
+// resultCache caches successful tool results across analyses for a per-tool TTL and
+// deduplicates identical calls that are in flight at the same time.
+type resultCache struct {
+	ttls map[string]time.Duration // By MCP tool name; tools without a TTL are not cached
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	flight  singleflight.Group
+	calls   map[string]*trackedCall // Calls in flight or waited for, by key
+}
+
+// sharedResult is the result of a call shared by the analyses waiting for it.
+type sharedResult struct {
+	response fantasy.ToolResponse
+	raw      string // Result as the server returned it; empty if the call failed
+}
+
+func newResultCache(ttls map[string]time.Duration) *resultCache {
+	return &resultCache{ttls: ttls, entries: make(map[string]cacheEntry), calls: make(map[string]*trackedCall)}
+}
+
+// track returns the tracked call for key, registering an analysis' tool call made
+// with ctx as waiting for it, and a function unregistering it. When the last waiter
+// leaves, the call is cancelled and forgotten, so that a later identical call starts
+// afresh instead of joining it.
+func (c *resultCache) track(ctx context.Context, key, server, tool, toolCallID string) (*trackedCall, func()) {
+	c.mu.Lock()
+	call, ok := c.calls[key]
+	if !ok {
+		call = &trackedCall{server: server, tool: tool}
+		call.ctx, call.cancel = sharedCallContext(ctx)
+		c.calls[key] = call
+	}
+	leave := call.join(ctx, toolCallID)
+	c.mu.Unlock()
+
+	return call, func() {
+		leave()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if len(call.currentWaiters()) == 0 && c.calls[key] == call {
+			delete(c.calls, key)
+			call.cancel()
+			c.flight.Forget(key)
+		}
+	}
+}
+
+func (c *resultCache) get(key string) (fantasy.ToolResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return fantasy.ToolResponse{}, false
+	}
+	return entry.response, true
+}
+
+func (c *resultCache) put(toolName, key string, response fantasy.ToolResponse) {
+	ttl := c.ttls[toolName]
+	if ttl <= 0 || response.IsError {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= maxCacheEntries {
+		now := time.Now()
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		// Still full: drop an arbitrary entry
+		for k := range c.entries {
+			if len(c.entries) < maxCacheEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{response: response, expires: time.Now().Add(ttl)}
+}
+
+// requestCache holds the successful tool results of a single analysis, so that
+// repeated identical calls within it are answered without calling the server.
+type requestCache struct {
+	mu        sync.Mutex
+	responses map[string]fantasy.ToolResponse
+}
+
+type requestCacheKey struct{}
+
+// WithRequestCache returns a context whose identical tool calls are deduplicated.
+func WithRequestCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestCacheKey{}, &requestCache{responses: make(map[string]fantasy.ToolResponse)})
+}
+
+func requestCacheFrom(ctx context.Context) *requestCache {
+	rc, _ := ctx.Value(requestCacheKey{}).(*requestCache)
+	return rc
+}
+
+func (rc *requestCache) get(key string) (fantasy.ToolResponse, bool) {
+	if rc == nil {
+		return fantasy.ToolResponse{}, false
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	response, ok := rc.responses[key]
+	return response, ok
+}
+
+func (rc *requestCache) put(key string, response fantasy.ToolResponse) {
+	if rc == nil || response.IsError {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.responses[key] = response
+}
+
+// cacheKey identifies a call by server, tool and arguments. Arguments are
+// canonicalized by re-encoding them, which sorts object keys.
+func (t *Tool) cacheKey(args map[string]any) string {
+	canonical, _ := json.Marshal(args)
+	return t.serverName + "\x00" + t.tool.Name + "\x00" + string(canonical)
+}
+
+// cachedCall answers a call from the analysis' or the shared cache, or joins an
+// identical call in flight, and calls the tool otherwise. The call itself is shared
+// and not tied to any one analysis: it runs on a context carrying only the trace of
+// the analysis that started it, bounded by the tool's own timeout, and is cancelled
+// once no analysis waits for it. Each analysis waits within its own call limit and
+// deadline, and records the raw result itself.
+func (t *Tool) cachedCall(ctx context.Context, callID string, args map[string]any) fantasy.ToolResponse {
+	key := t.cacheKey(args)
+	rc := requestCacheFrom(ctx)
+	cache := t.manager.cache
+
+	if response, ok := rc.get(key); ok {
+		return t.withCacheStatus(response, CacheHit)
+	}
+	if response, ok := cache.get(key); ok {
+		rc.put(key, response)
+		return t.withCacheStatus(response, CacheHit)
+	}
+
+	// Wait for a slot within the analysis' concurrency limit
+	releaseAnalysis, err := callLimitFrom(ctx).acquire(ctx)
+	if err != nil {
+		return t.errorResponse(classifyError(err), fmt.Sprintf("waiting for a tool call slot: %v", err))
+	}
+	defer releaseAnalysis()
+
+	// Progress and questions of the shared call reach every analysis waiting for it
+	call, leave := cache.track(ctx, key, t.serverName, t.tool.Name, callID)
+	defer leave()
+
+	// The shared call must not be cancelled with the analysis that happened to start it
+	ch := cache.flight.DoChan(key, func() (any, error) {
+		response, raw := t.call(call.ctx, call, args)
+		cache.put(t.tool.Name, key, response)
+		return sharedResult{response: response, raw: raw}, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return t.errorResponse(classifyError(ctx.Err()), ctx.Err().Error())
+	case res := <-ch:
+		result := res.Val.(sharedResult)
+		rc.put(key, result.response)
+		if report := rawResultFuncFrom(ctx); report != nil && result.raw != "" {
+			report(callID, result.raw)
+		}
+		if res.Shared {
+			return t.withCacheStatus(result.response, CacheShared)
+		}
+		return t.withCacheStatus(result.response, CacheMiss)
+	}
+}
+
+// sharedCallContext returns a context for a call shared across analyses, carrying
+// only the trace span of ctx. Its deadline is not inherited: an analysis that joins
+// the call later may have longer left, and each one stops waiting at its own.
+func sharedCallContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithCancel(trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx)))
+}
+
+func (t *Tool) withCacheStatus(response fantasy.ToolResponse, status CacheStatus) fantasy.ToolResponse {
+	if response.IsError {
+		return response
+	}
+	if status != CacheMiss {
+		slog.Debug("MCP tool result from cache", "server", t.serverName, "tool", t.tool.Name, "cache", status)
+	}
+	return fantasy.WithResponseMetadata(response, ResultMetadata{Cache: status})
+}
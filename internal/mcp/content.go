@@ -0,0 +1,134 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// maxResourceBytes caps how much of an embedded text resource is inlined into a tool result.
+const maxResourceBytes = 20000
+
+// toolOutput is a tool result converted for the model.
+type toolOutput struct {
+	Body        string   // Structured content as JSON, or the joined text content
+	Attachments []string // Text renderings of resources and omitted media, in order
+	Image       []byte   // Base64-encoded image data, if an image is passed to the model
+	ImageType   string
+}
+
+// convertResult converts MCP tool result content into text and at most one image.
+// StructuredContent is preferred over text content when present, since servers send
+// the same data serialized as text for older clients. Images are passed through only
+// when allowMedia is set; otherwise they and any other binary content are described
+// in text.
+func convertResult(result *gomcp.CallToolResult, allowMedia bool) toolOutput {
+	var out toolOutput
+	var texts []string
+
+	structured := false
+	if result.StructuredContent != nil {
+		if b, err := json.Marshal(result.StructuredContent); err == nil {
+			out.Body = string(b)
+			structured = true
+		}
+	}
+
+	addImage := func(data []byte, mimeType string) bool {
+		if !allowMedia || out.Image != nil || !strings.HasPrefix(mimeType, "image/") {
+			return false
+		}
+		out.Image = []byte(base64.StdEncoding.EncodeToString(data))
+		out.ImageType = mimeType
+		return true
+	}
+
+	for _, c := range result.Content {
+		switch content := c.(type) {
+		case *gomcp.TextContent:
+			if !structured {
+				texts = append(texts, content.Text)
+			}
+
+		case *gomcp.ImageContent:
+			if !addImage(content.Data, content.MIMEType) {
+				out.Attachments = append(out.Attachments, fmt.Sprintf("[image omitted: %s, %d bytes]", content.MIMEType, len(content.Data)))
+			}
+
+		case *gomcp.AudioContent:
+			out.Attachments = append(out.Attachments, fmt.Sprintf("[audio omitted: %s, %d bytes]", content.MIMEType, len(content.Data)))
+
+		case *gomcp.ResourceLink:
+			out.Attachments = append(out.Attachments, describeResourceLink(content))
+
+		case *gomcp.EmbeddedResource:
+			if content.Resource == nil {
+				continue
+			}
+			if content.Resource.Blob != nil {
+				if !addImage(content.Resource.Blob, content.Resource.MIMEType) {
+					out.Attachments = append(out.Attachments, fmt.Sprintf("[binary resource omitted: %s (%s, %d bytes)]",
+						content.Resource.URI, content.Resource.MIMEType, len(content.Resource.Blob)))
+				}
+				continue
+			}
+			out.Attachments = append(out.Attachments, inlineResource(content.Resource))
+
+		default:
+			if b, err := json.Marshal(c); err == nil {
+				out.Attachments = append(out.Attachments, string(b))
+			}
+		}
+	}
+
+	if !structured {
+		out.Body = strings.Join(texts, "\n")
+	}
+	return out
+}
+
+// withAttachments appends the attachments to body, one per line.
+func (o toolOutput) withAttachments(body string) string {
+	if body == "" {
+		return strings.Join(o.Attachments, "\n")
+	}
+	return strings.Join(append([]string{body}, o.Attachments...), "\n")
+}
+
+// describeResourceLink renders a resource link as a single line.
+func describeResourceLink(link *gomcp.ResourceLink) string {
+	name := link.Title
+	if name == "" {
+		name = link.Name
+	}
+	desc := fmt.Sprintf("[resource: %s <%s>", name, link.URI)
+	if link.MIMEType != "" {
+		desc += " " + link.MIMEType
+	}
+	if link.Description != "" {
+		desc += " - " + link.Description
+	}
+	return desc + "]"
+}
+
+// inlineResource renders an embedded text resource, keeping the head and tail of large ones.
+func inlineResource(r *gomcp.ResourceContents) string {
+	text := r.Text
+	if len(text) > maxResourceBytes {
+		if truncated, kept, ok := truncateLines(text, maxResourceBytes); ok {
+			text = fmt.Sprintf("%s\n[resource truncated: %d of %d lines shown]", truncated, kept, strings.Count(text, "\n")+1)
+		} else {
+			truncated := cutBytes(text, maxResourceBytes)
+			text = fmt.Sprintf("%s\n[resource truncated: %d of %d bytes shown]", truncated, len(truncated), len(text))
+		}
+	}
+
+	header := "Resource " + r.URI
+	if r.MIMEType != "" {
+		header += " (" + r.MIMEType + ")"
+	}
+	return header + ":\n" + text
+}
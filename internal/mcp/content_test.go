@@ -0,0 +1,46 @@
+package mcp
+
+import (
+	"strings"
+	"testing"
+
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestConvertResultPrefersStructuredContent(t *testing.T) {
+	result := &gomcp.CallToolResult{
+		Content:           []gomcp.Content{&gomcp.TextContent{Text: `{"count": 1}`}},
+		StructuredContent: map[string]any{"count": 1},
+	}
+
+	out := convertResult(result, false)
+	if out.Body != `{"count":1}` {
+		t.Errorf("Body = %q", out.Body)
+	}
+}
+
+func TestConvertResultMedia(t *testing.T) {
+	result := &gomcp.CallToolResult{
+		Content: []gomcp.Content{
+			&gomcp.TextContent{Text: "dashboard"},
+			&gomcp.ImageContent{Data: []byte("png"), MIMEType: "image/png"},
+			&gomcp.EmbeddedResource{Resource: &gomcp.ResourceContents{URI: "file:///a.log", MIMEType: "text/plain", Text: "line"}},
+		},
+	}
+
+	out := convertResult(result, true)
+	if string(out.Image) != "cG5n" || out.ImageType != "image/png" {
+		t.Errorf("Image = %q (%s)", out.Image, out.ImageType)
+	}
+	if len(out.Attachments) != 1 || !strings.HasPrefix(out.Attachments[0], "Resource file:///a.log (text/plain):\nline") {
+		t.Errorf("Attachments = %q", out.Attachments)
+	}
+
+	out = convertResult(result, false)
+	if out.Image != nil {
+		t.Error("image passed through with media disabled")
+	}
+	if got := out.withAttachments(out.Body); !strings.Contains(got, "[image omitted: image/png, 3 bytes]") {
+		t.Errorf("text = %q", got)
+	}
+}
@@ -0,0 +1,115 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const defaultElicitationTimeout = 5 * time.Minute
+
+// ErrUnknownElicitation is returned when answering an elicitation that is not pending.
+var ErrUnknownElicitation = errors.New("unknown elicitation")
+
+// Elicitation is a question an MCP server asks a human while one of its tools runs.
+type Elicitation struct {
+	ID         string `json:"id"`
+	Server     string `json:"server"`
+	Tool       string `json:"tool"`
+	ToolCallID string `json:"tool_call_id"`
+	Message    string `json:"message"`
+	Schema     any    `json:"schema,omitempty"` // JSON schema of the expected answer (form questions)
+	URL        string `json:"url,omitempty"`    // Page the human should visit (URL questions)
+}
+
+// ElicitationResponse is a human's answer to an elicitation.
+type ElicitationResponse struct {
+	Action  string         `json:"action"`            // accept, decline or cancel
+	Content map[string]any `json:"content,omitempty"` // Answer matching the schema, if accepted
+}
+
+// ElicitFunc asks a human an elicitation and waits for the answer.
+type ElicitFunc func(ctx context.Context, e Elicitation) (ElicitationResponse, error)
+
+// elicitor identifies the analysis an ElicitFunc belongs to.
+type elicitor struct {
+	ask ElicitFunc
+}
+
+type elicitorKey struct{}
+
+// WithElicitFunc returns a context whose tool calls pass server questions to fn.
+// Without one, servers' questions are declined.
+func WithElicitFunc(ctx context.Context, fn ElicitFunc) context.Context {
+	return context.WithValue(ctx, elicitorKey{}, &elicitor{ask: fn})
+}
+
+func elicitorFrom(ctx context.Context) *elicitor {
+	e, _ := ctx.Value(elicitorKey{}).(*elicitor)
+	return e
+}
+
+// handleElicitation returns the elicitation/create handler for a server's session.
+// The request does not say which tool call it belongs to, so it is routed to the
+// analysis with calls in flight or waiting for a shared call on the server; if there
+// are several it is declined.
+func (m *Manager) handleElicitation(server string) func(context.Context, *gomcp.ElicitRequest) (*gomcp.ElicitResult, error) {
+	return func(ctx context.Context, req *gomcp.ElicitRequest) (*gomcp.ElicitResult, error) {
+		var target *callWaiter
+		var call *trackedCall
+		ambiguous := false
+		m.progress.Range(func(_, v any) bool {
+			c := v.(*trackedCall)
+			if c.server != server {
+				return true
+			}
+			for _, w := range c.currentWaiters() {
+				if w.elicit == nil {
+					continue
+				}
+				if target != nil && target.elicit != w.elicit {
+					ambiguous = true
+					return false
+				}
+				target, call = w, c
+			}
+			return true
+		})
+		if target == nil || ambiguous {
+			slog.Warn("MCP elicitation declined", "server", server, "message", req.Params.Message, "ambiguous", ambiguous)
+			return &gomcp.ElicitResult{Action: "decline"}, nil
+		}
+
+		e := Elicitation{
+			ID:         fmt.Sprintf("elicit-%d", m.elicitSeq.Add(1)),
+			Server:     server,
+			Tool:       call.tool,
+			ToolCallID: target.toolCallID,
+			Message:    req.Params.Message,
+			Schema:     req.Params.RequestedSchema,
+			URL:        req.Params.URL,
+		}
+		slog.Info("MCP elicitation", "id", e.ID, "server", server, "tool", e.Tool, "message", e.Message)
+
+		timeout := m.opts.ElicitationTimeout
+		if timeout <= 0 {
+			timeout = defaultElicitationTimeout
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		resume := call.pauseDeadline()
+		defer resume()
+
+		resp, err := target.elicit.ask(ctx, e)
+		if err != nil {
+			slog.Warn("MCP elicitation unanswered", "id", e.ID, "server", server, "error", err)
+			return &gomcp.ElicitResult{Action: "cancel"}, nil
+		}
+		slog.Info("MCP elicitation answered", "id", e.ID, "action", resp.Action)
+		return &gomcp.ElicitResult{Action: resp.Action, Content: resp.Content}, nil
+	}
+}
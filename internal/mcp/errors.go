@@ -0,0 +1,89 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+)
+
+// ErrorCode classifies why an MCP tool call failed.
+type ErrorCode string
+
+const (
+	CodeServerUnreachable ErrorCode = "server_unreachable" // Could not connect to or talk to the MCP server
+	CodeServerUnavailable ErrorCode = "server_unavailable" // Not attempted: the server's circuit is open after repeated failures
+	CodeAuthFailed        ErrorCode = "auth_failed"        // The server rejected our credentials
+	CodeInvalidArguments  ErrorCode = "invalid_arguments"  // The tool arguments were malformed or rejected
+	CodeUpstreamTimeout   ErrorCode = "upstream_timeout"   // The call or the backend behind the server timed out
+	CodeToolError         ErrorCode = "tool_error"         // The tool ran and reported an error
+	CodeCancelled         ErrorCode = "cancelled"          // The analysis stopped waiting before the server answered
+)
+
+// ErrorMetadata is attached to failed tool responses as their client metadata.
+type ErrorMetadata struct {
+	ErrorCode ErrorCode `json:"error_code"`
+	Server    string    `json:"server"`
+	Tool      string    `json:"tool"`
+}
+
+// errorResponse builds a failed tool response. The code is repeated in the text so
+// the model can tell a broken backend apart from an empty result.
+func (t *Tool) errorResponse(code ErrorCode, message string) fantasy.ToolResponse {
+	response := fantasy.NewTextErrorResponse(fmt.Sprintf("[%s] %s", code, message))
+	return fantasy.WithResponseMetadata(response, ErrorMetadata{
+		ErrorCode: code,
+		Server:    t.serverName,
+		Tool:      t.tool.Name,
+	})
+}
+
+// classifyError classifies an error returned while reaching the server or calling a tool.
+func classifyError(err error) ErrorCode {
+	var openErr *circuitOpenError
+	if errors.As(err, &openErr) {
+		return CodeServerUnavailable
+	}
+
+	var wireErr *jsonrpc.Error
+	if errors.As(err, &wireErr) {
+		if wireErr.Code == jsonrpc.CodeInvalidParams {
+			return CodeInvalidArguments
+		}
+		return CodeToolError
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return CodeCancelled
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return CodeUpstreamTimeout
+	}
+
+	msg := err.Error()
+	if strings.Contains(msg, "Unauthorized") || strings.Contains(msg, "Forbidden") {
+		return CodeAuthFailed
+	}
+	return CodeServerUnreachable
+}
+
+// classifyToolError classifies the error text of a result the tool flagged with IsError.
+func classifyToolError(text string) ErrorCode {
+	lower := strings.ToLower(text)
+	switch {
+	case strings.Contains(lower, "timed out") || strings.Contains(lower, "timeout") || strings.Contains(lower, "deadline exceeded"):
+		return CodeUpstreamTimeout
+	case strings.Contains(lower, "unauthorized") || strings.Contains(lower, "forbidden") || strings.Contains(lower, "permission denied"):
+		return CodeAuthFailed
+	case strings.Contains(lower, "invalid argument") || strings.Contains(lower, "invalid parameter") || strings.Contains(lower, "validation"):
+		return CodeInvalidArguments
+	default:
+		return CodeToolError
+	}
+}
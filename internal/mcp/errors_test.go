@@ -0,0 +1,33 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorCode
+	}{
+		{&jsonrpc.Error{Code: jsonrpc.CodeInvalidParams, Message: "bad"}, CodeInvalidArguments},
+		{&jsonrpc.Error{Code: jsonrpc.CodeInternalError, Message: "boom"}, CodeToolError},
+		{fmt.Errorf("call: %w", context.DeadlineExceeded), CodeUpstreamTimeout},
+		{fmt.Errorf("call: %w", context.Canceled), CodeCancelled},
+		{errors.New("calling \"initialize\": Unauthorized"), CodeAuthFailed},
+		{errors.New("dial tcp: connection refused"), CodeServerUnreachable},
+	}
+	for _, tt := range tests {
+		if got := classifyError(tt.err); got != tt.want {
+			t.Errorf("classifyError(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+
+	if got := classifyToolError("opensearch query timed out after 30s"); got != CodeUpstreamTimeout {
+		t.Errorf("classifyToolError = %s, want %s", got, CodeUpstreamTimeout)
+	}
+}
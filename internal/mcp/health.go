@@ -0,0 +1,120 @@
+package mcp
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerState is the connection state of an MCP server.
+type ServerState string
+
+const (
+	StateConnected ServerState = "connected" // Session established and calls succeeding
+	StateDegraded  ServerState = "degraded"  // Session established but recent calls failing
+	StateDown      ServerState = "down"      // No session; reconnection is being retried
+)
+
+// ServerHealth is a snapshot of the health of an MCP server.
+type ServerHealth struct {
+	Name                string       `json:"name"`
+	URL                 string       `json:"url"`
+	State               ServerState  `json:"state"`
+	Circuit             CircuitState `json:"circuit"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	LastError           string       `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time   `json:"last_error_at,omitempty"`
+	LastSuccessAt       *time.Time   `json:"last_success_at,omitempty"` // Last successful tool call or connection
+	LatencyMS           int64        `json:"latency_ms"`                // Duration of the last successful tool call
+}
+
+// healthTracker records per-server connection health.
+type healthTracker struct {
+	mu      sync.Mutex
+	servers map[string]*ServerHealth
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{servers: make(map[string]*ServerHealth)}
+}
+
+func (h *healthTracker) server(cfg Config) *ServerHealth {
+	s, ok := h.servers[cfg.Name]
+	if !ok {
+		s = &ServerHealth{Name: cfg.Name, URL: cfg.URL, State: StateDown}
+		h.servers[cfg.Name] = s
+	}
+	return s
+}
+
+// connected records a successful connection.
+func (h *healthTracker) connected(cfg Config) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.server(cfg)
+	now := time.Now()
+	s.State = StateConnected
+	s.ConsecutiveFailures = 0
+	s.LastSuccessAt = &now
+	observeState(s)
+}
+
+// down records a failed connection attempt or a lost session.
+func (h *healthTracker) down(cfg Config, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.server(cfg)
+	s.State = StateDown
+	h.failed(s, err)
+	observeState(s)
+}
+
+// callSucceeded records a successful tool call.
+func (h *healthTracker) callSucceeded(cfg Config, latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.server(cfg)
+	now := time.Now()
+	s.State = StateConnected
+	s.ConsecutiveFailures = 0
+	s.LastSuccessAt = &now
+	s.LatencyMS = latency.Milliseconds()
+	observeState(s)
+}
+
+// callFailed records a tool call that failed because of the server or its backend.
+func (h *healthTracker) callFailed(cfg Config, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.server(cfg)
+	if s.State == StateConnected {
+		s.State = StateDegraded
+	}
+	h.failed(s, err)
+	observeState(s)
+}
+
+func (h *healthTracker) failed(s *ServerHealth, err error) {
+	now := time.Now()
+	s.ConsecutiveFailures++
+	s.LastError = err.Error()
+	s.LastErrorAt = &now
+}
+
+// snapshot returns the health of all servers, sorted by name.
+func (h *healthTracker) snapshot() []ServerHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	out := make([]ServerHealth, 0, len(h.servers))
+	for _, s := range h.servers {
+		out = append(out, *s)
+	}
+	slices.SortFunc(out, func(a, b ServerHealth) int { return strings.Compare(a.Name, b.Name) })
+	return out
+}
@@ -0,0 +1,66 @@
+package mcp
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealthTrackerStates(t *testing.T) {
+	h := newHealthTracker()
+	cfg := Config{Name: "observer", URL: "http://observer/mcp"}
+
+	h.down(cfg, errors.New("connection refused"))
+	if s := h.snapshot()[0]; s.State != StateDown || s.ConsecutiveFailures != 1 || s.LastError != "connection refused" {
+		t.Errorf("after down: %+v", s)
+	}
+
+	h.connected(cfg)
+	h.callFailed(cfg, errors.New("timeout"))
+	if s := h.snapshot()[0]; s.State != StateDegraded || s.ConsecutiveFailures != 1 {
+		t.Errorf("after failed call: %+v", s)
+	}
+
+	h.callSucceeded(cfg, 150*time.Millisecond)
+	if s := h.snapshot()[0]; s.State != StateConnected || s.ConsecutiveFailures != 0 || s.LatencyMS != 150 {
+		t.Errorf("after successful call: %+v", s)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	b := newCircuitBreaker("observer", 2, 20*time.Millisecond)
+
+	b.failure()
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow after 1 failure: %v", err)
+	}
+	b.failure()
+	if err := b.allow(); err == nil || classifyError(err) != CodeServerUnavailable {
+		t.Fatalf("allow with open circuit = %v", err)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe not allowed: %v", err)
+	}
+	if err := b.allow(); err == nil {
+		t.Fatal("second call allowed while probing")
+	}
+
+	b.abandon()
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe not allowed after a cancelled one: %v", err)
+	}
+
+	b.failure()
+	if b.current() != CircuitOpen {
+		t.Fatalf("state after failed probe = %s", b.current())
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	b.allow()
+	b.success()
+	if b.current() != CircuitClosed {
+		t.Fatalf("state after successful probe = %s", b.current())
+	}
+}
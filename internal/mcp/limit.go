@@ -0,0 +1,39 @@
+package mcp
+
+import "context"
+
+// semaphore limits concurrent tool calls. A nil semaphore is unlimited.
+type semaphore chan struct{}
+
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+// acquire waits for a slot and returns a function releasing it.
+func (s semaphore) acquire(ctx context.Context) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	select {
+	case s <- struct{}{}:
+		return func() { <-s }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type callLimitKey struct{}
+
+// WithCallLimit returns a context that allows at most n concurrent MCP tool calls
+// among the calls made with it, e.g. within one analysis. n <= 0 means unlimited.
+func WithCallLimit(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, callLimitKey{}, newSemaphore(n))
+}
+
+func callLimitFrom(ctx context.Context) semaphore {
+	sem, _ := ctx.Value(callLimitKey{}).(semaphore)
+	return sem
+}
@@ -6,16 +6,25 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net/http"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
-gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+	"charm.land/fantasy"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
 
 	"rca.agent/test/internal/httputil"
 )
 
-const defaultTimeout = 30 * time.Second
+const (
+	defaultTimeout = 30 * time.Second
+	pingTimeout    = 5 * time.Second
+
+	defaultIdlePingAfter = time.Minute
+)
 
 // Config represents configuration for an MCP server
 type Config struct {
@@ -25,19 +34,143 @@ type Config struct {
 	TLSSkipVerify bool
 }
 
+// ManagerOptions configures behavior shared by all MCP servers
+type ManagerOptions struct {
+	// ResultLimit caps the size of every tool result after transformation
+	ResultLimit ResultLimit
+	// ToolResultLimits overrides ResultLimit for individual tools, keyed by MCP tool name
+	ToolResultLimits map[string]ResultLimit
+	// MediaResults passes images from tool results to the model. Only enable it
+	// when every model that may serve the analysis accepts images in tool results.
+	MediaResults bool
+	// ToolRefreshInterval is how often OnToolsChanged is called even without a
+	// list_changed notification (0 disables periodic refresh)
+	ToolRefreshInterval time.Duration
+	// OnToolsChanged is called from a background goroutine when the tools of a server
+	// may have changed: on list_changed notifications, on reconnection and periodically.
+	// Calls are serialized and bursts of notifications are coalesced.
+	OnToolsChanged func(ctx context.Context)
+	// ReconnectInitialDelay and ReconnectMaxDelay bound the exponential backoff used
+	// to reconnect servers that are down
+	ReconnectInitialDelay time.Duration
+	ReconnectMaxDelay     time.Duration
+	// BreakerThreshold is the number of consecutive failures after which calls to a
+	// server fail fast for BreakerOpenDuration
+	BreakerThreshold    int
+	BreakerOpenDuration time.Duration
+	// IdlePingAfter is how long a session may go unused before it is pinged ahead
+	// of the next call. Recently used sessions are called directly.
+	IdlePingAfter time.Duration
+	// MaxConcurrentCalls caps concurrent tool calls to each server (0 = unlimited)
+	MaxConcurrentCalls int
+	// CallTimeout bounds each tool call; ServerTimeouts and ToolTimeouts (keyed by
+	// MCP tool name) override it, tool timeouts taking precedence
+	CallTimeout    time.Duration
+	ServerTimeouts map[string]time.Duration
+	ToolTimeouts   map[string]time.Duration
+	// CacheTTLs sets how long successful results of each tool are cached and shared
+	// across analyses, keyed by MCP tool name. Tools without a TTL are not cached.
+	CacheTTLs map[string]time.Duration
+	// SamplingModel answers servers' sampling requests within SamplingPolicy; nil
+	// disables sampling
+	SamplingModel  fantasy.LanguageModel
+	SamplingPolicy SamplingPolicy
+	// ToolAliases renames tools offered to the model: keys are "server/tool" (replaces
+	// the whole name) or "server" (replaces the server part of mcp_<server>_<tool>)
+	ToolAliases map[string]string
+	// AllowedTools limits the tools offered to the model, as "server/tool" or a bare
+	// tool name, which allows the tool on the first server (by name) that exposes it.
+	// Name collisions are only looked for among allowed tools. nil allows every tool.
+	AllowedTools []string
+	// SchemaDialect is the JSON Schema subset tool input schemas are converted to
+	SchemaDialect SchemaDialect
+	// ElicitationTimeout bounds how long servers' questions wait for an answer
+	ElicitationTimeout time.Duration
+}
+
 // Manager manages multiple MCP client connections
 type Manager struct {
 	mu       sync.RWMutex
 	sessions map[string]*gomcp.ClientSession
 	configs  map[string]Config
+	tools    map[string][]*gomcp.Tool // Last listed tools per server
+	// Tools by the name they are offered to the model under
+	toolNames map[string]ToolRef
+	// Rendered contents of subscribed resources, by server and URI
+	resources map[string]cachedResource
+	opts      ManagerOptions
+
+	lastActive map[string]time.Time // Last successful use of each server's session
+	health     *healthTracker
+	breakers   map[string]*circuitBreaker
+	callSems   map[string]semaphore // Per-server concurrency limits
+	cache      *resultCache
+
+	progress    sync.Map // Progress token -> *trackedCall of the tool call that owns it
+	progressSeq atomic.Int64
+	elicitSeq   atomic.Int64
+
+	schemaWarnings sync.Map // Schema conversion warnings already logged
+	sampler        *sampler // nil if sampling is disabled
+
+	refresh chan struct{}
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup // Background goroutines
 }
 
 // NewManager creates a new MCP manager
-func NewManager() *Manager {
-	return &Manager{
-		sessions: make(map[string]*gomcp.ClientSession),
-		configs:  make(map[string]Config),
+func NewManager(opts ManagerOptions) *Manager {
+	m := &Manager{
+		sessions:   make(map[string]*gomcp.ClientSession),
+		configs:    make(map[string]Config),
+		tools:      make(map[string][]*gomcp.Tool),
+		resources:  make(map[string]cachedResource),
+		toolNames:  make(map[string]ToolRef),
+		lastActive: make(map[string]time.Time),
+		opts:       opts,
+		health:     newHealthTracker(),
+		breakers:   make(map[string]*circuitBreaker),
+		callSems:   make(map[string]semaphore),
+		cache:      newResultCache(opts.CacheTTLs),
+		refresh:    make(chan struct{}, 1),
+	}
+	if opts.SamplingModel != nil {
+		m.sampler = newSampler(opts.SamplingModel, opts.SamplingPolicy, m.chargeSampling)
+	}
+	return m
+}
+
+// callTimeout returns the timeout for a call to a tool, or 0 if unbounded
+func (m *Manager) callTimeout(serverName, toolName string) time.Duration {
+	if timeout, ok := m.opts.ToolTimeouts[toolName]; ok {
+		return timeout
+	}
+	if timeout, ok := m.opts.ServerTimeouts[serverName]; ok {
+		return timeout
 	}
+	return m.opts.CallTimeout
+}
+
+// resultLimitBytes returns the result size limit in bytes for a tool, or 0 if unlimited
+func (m *Manager) resultLimitBytes(toolName string) int {
+	if limit, ok := m.opts.ToolResultLimits[toolName]; ok {
+		return limit.bytes()
+	}
+	return m.opts.ResultLimit.bytes()
+}
+
+// limitResult truncates the result text of a tool to its size limit.
+func (m *Manager) limitResult(server, toolName, text string) string {
+	limit := m.resultLimitBytes(toolName)
+	if limit <= 0 || len(text) <= limit {
+		return text
+	}
+	slog.Warn("MCP tool result truncated",
+		"server", server,
+		"tool", toolName,
+		"bytes", len(text),
+		"limit", limit)
+	return truncateResult(toolName, text, limit)
 }
 
 // Initialize connects to all configured MCP servers concurrently
@@ -46,6 +179,9 @@ func (m *Manager) Initialize(ctx context.Context, configs []Config) {
 
 	for _, cfg := range configs {
 		m.configs[cfg.Name] = cfg
+		m.breakers[cfg.Name] = newCircuitBreaker(cfg.Name, m.opts.BreakerThreshold, m.opts.BreakerOpenDuration)
+		m.callSems[cfg.Name] = newSemaphore(m.opts.MaxConcurrentCalls)
+		m.health.down(cfg, errors.New("not connected yet"))
 
 		wg.Add(1)
 		go func(cfg Config) {
@@ -55,16 +191,71 @@ func (m *Manager) Initialize(ctx context.Context, configs []Config) {
 	}
 
 	wg.Wait()
+
+	// Background goroutines outlive the initialization context and are stopped by Close
+	bgCtx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.wg.Add(2)
+	go m.watchTools(bgCtx)
+	go m.supervise(bgCtx)
+}
+
+// Health returns the connection health of all configured servers.
+func (m *Manager) Health() []ServerHealth {
+	servers := m.health.snapshot()
+	for i := range servers {
+		if b, ok := m.breakers[servers[i].Name]; ok {
+			servers[i].Circuit = b.current()
+		}
+	}
+	return servers
+}
+
+// refreshTools schedules a call to OnToolsChanged without blocking.
+func (m *Manager) refreshTools() {
+	select {
+	case m.refresh <- struct{}{}:
+	default:
+		// A refresh is already pending
+	}
+}
+
+// watchTools calls OnToolsChanged when a refresh is requested or the refresh interval elapses.
+func (m *Manager) watchTools(ctx context.Context) {
+	defer m.wg.Done()
+
+	var tick <-chan time.Time
+	if m.opts.ToolRefreshInterval > 0 {
+		ticker := time.NewTicker(m.opts.ToolRefreshInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.refresh:
+		case <-tick:
+		}
+
+		if m.opts.OnToolsChanged != nil {
+			refreshCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
+			m.opts.OnToolsChanged(refreshCtx)
+			cancel()
+		}
+	}
 }
 
-func (m *Manager) connect(ctx context.Context, cfg Config) {
+func (m *Manager) connect(ctx context.Context, cfg Config) error {
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
 	session, err := m.createSession(ctx, cfg)
 	if err != nil {
 		slog.Error("MCP connection failed", "server", cfg.Name, "url", cfg.URL, "error", err)
-		return
+		m.health.down(cfg, err)
+		return err
 	}
 
 	// List tools to verify connection
@@ -72,14 +263,27 @@ func (m *Manager) connect(ctx context.Context, cfg Config) {
 	if err != nil {
 		session.Close()
 		slog.Error("MCP failed to list tools", "server", cfg.Name, "error", err)
-		return
+		m.health.down(cfg, err)
+		return err
 	}
 
 	m.mu.Lock()
+	if _, ok := m.sessions[cfg.Name]; ok {
+		// Reconnected on demand in the meantime
+		m.mu.Unlock()
+		session.Close()
+		return nil
+	}
 	m.sessions[cfg.Name] = session
+	m.tools[cfg.Name] = tools.Tools
+	m.forgetResources(cfg.Name)
+	m.lastActive[cfg.Name] = time.Now()
 	m.mu.Unlock()
 
+	m.health.connected(cfg)
+	m.breakers[cfg.Name].success()
 	slog.Info("MCP connected", "server", cfg.Name, "tools", len(tools.Tools))
+	return nil
 }
 
 func (m *Manager) createSession(ctx context.Context, cfg Config) (*gomcp.ClientSession, error) {
@@ -90,10 +294,18 @@ func (m *Manager) createSession(ctx context.Context, cfg Config) (*gomcp.ClientS
 		},
 	}
 
+	// The standalone SSE stream carries the notifications servers send outside of a
+	// request, such as tools/list_changed and resources/updated. Servers without it
+	// answer 405, which the transport accepts.
 	transport := &gomcp.StreamableClientTransport{
-		Endpoint:             cfg.URL,
-		HTTPClient:           httpClient,
-		DisableStandaloneSSE: true,
+		Endpoint:   cfg.URL,
+		HTTPClient: httpClient,
+	}
+
+	// Sampling is only advertised when a model is configured
+	var createMessage func(context.Context, *gomcp.CreateMessageRequest) (*gomcp.CreateMessageResult, error)
+	if m.sampler != nil {
+		createMessage = m.sampler.handler(cfg.Name)
 	}
 
 	client := gomcp.NewClient(
@@ -101,84 +313,264 @@ func (m *Manager) createSession(ctx context.Context, cfg Config) (*gomcp.ClientS
 			Name:    "fantasydemo",
 			Version: "1.0.0",
 		},
-		nil,
+		&gomcp.ClientOptions{
+			ToolListChangedHandler: func(context.Context, *gomcp.ToolListChangedRequest) {
+				slog.Debug("MCP tool list changed", "server", cfg.Name)
+				m.refreshTools()
+			},
+			ProgressNotificationHandler: m.handleProgress,
+			CreateMessageHandler:        createMessage,
+			ElicitationHandler:          m.handleElicitation(cfg.Name),
+			ResourceUpdatedHandler: func(_ context.Context, req *gomcp.ResourceUpdatedNotificationRequest) {
+				slog.Debug("MCP resource updated", "server", cfg.Name, "uri", req.Params.URI)
+				m.resourceUpdated(cfg.Name, req.Params.URI)
+			},
+		},
 	)
 
 	return client.Connect(ctx, transport, nil)
 }
 
-// GetSession returns a session, reconnecting if necessary
+// recordCall updates the health of a server after a tool call. Only failures caused
+// by the server or its backend count against it, and cancelled calls not at all.
+func (m *Manager) recordCall(name string, latency time.Duration, code ErrorCode, err error) {
+	if code == CodeCancelled {
+		m.breakers[name].abandon()
+		return
+	}
+
+	m.mu.RLock()
+	cfg := m.configs[name]
+	m.mu.RUnlock()
+
+	switch code {
+	case CodeServerUnreachable, CodeAuthFailed, CodeUpstreamTimeout:
+		m.health.callFailed(cfg, err)
+		m.breakers[name].failure()
+	default:
+		m.health.callSucceeded(cfg, latency)
+		m.breakers[name].success()
+		m.markActive(name)
+	}
+}
+
+// GetSession returns a session, reconnecting if necessary. It fails fast while the
+// server's circuit is open. The outcome of the call made with the session must be
+// reported with recordCall.
 func (m *Manager) GetSession(ctx context.Context, name string) (*gomcp.ClientSession, error) {
 	m.mu.RLock()
 	session, ok := m.sessions[name]
-	cfg, hasCfg := m.configs[name]
+	lastActive := m.lastActive[name]
+	_, hasCfg := m.configs[name]
 	m.mu.RUnlock()
 
 	if !hasCfg {
 		return nil, fmt.Errorf("mcp '%s' not configured", name)
 	}
 
-	// Check if session is alive
+	breaker := m.breakers[name]
+	if err := breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	// Sessions that were used recently are assumed alive; a dead one surfaces as a
+	// transport error on the call, which reconnects and retries it
 	if ok {
-		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		if time.Since(lastActive) < m.idlePingAfter() {
+			return session, nil
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
 		defer cancel()
-		if err := session.Ping(pingCtx, nil); err == nil {
+		err := session.Ping(pingCtx, nil)
+		if err == nil {
+			m.markActive(name)
 			return session, nil
 		}
+		if ctx.Err() != nil {
+			breaker.abandon()
+			return nil, ctx.Err()
+		}
 		// Ping failed - close and remove stale session before reconnecting
-		session.Close()
-		m.mu.Lock()
-		delete(m.sessions, name)
-		m.mu.Unlock()
+		m.health.down(m.configs[name], fmt.Errorf("ping failed: %w", err))
+		m.dropSession(name, session)
+	}
+
+	session, err := m.reconnect(ctx, name)
+	if err != nil {
+		if ctx.Err() != nil {
+			breaker.abandon()
+		} else {
+			breaker.failure()
+		}
+		return nil, err
 	}
+	return session, nil
+}
+
+// reconnect replaces the session of a server with a fresh one. It does not consult
+// the circuit breaker; callers report the outcome.
+func (m *Manager) reconnect(ctx context.Context, name string) (*gomcp.ClientSession, error) {
+	m.mu.RLock()
+	cfg := m.configs[name]
+	m.mu.RUnlock()
 
-	// Reconnect with fresh session
 	slog.Debug("MCP reconnecting", "server", name)
 
-	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	connectCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
-	newSession, err := m.createSession(ctx, cfg)
+	newSession, err := m.createSession(connectCtx, cfg)
 	if err != nil {
+		if ctx.Err() == nil {
+			m.health.down(cfg, err)
+		}
 		return nil, fmt.Errorf("reconnection failed: %w", err)
 	}
 
 	m.mu.Lock()
+	if existing, ok := m.sessions[name]; ok {
+		// Reconnected concurrently; keep the session already in use
+		m.mu.Unlock()
+		newSession.Close()
+		return existing, nil
+	}
 	m.sessions[name] = newSession
+	m.lastActive[name] = time.Now()
+	m.forgetResources(name)
 	m.mu.Unlock()
 
+	m.health.connected(cfg)
 	slog.Info("MCP reconnected", "server", name)
+	m.refreshTools()
 	return newSession, nil
 }
 
-// GetAllTools returns all tools from connected MCP servers
+// markActive records that a server's session was just used successfully.
+func (m *Manager) markActive(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastActive[name] = time.Now()
+}
+
+// idlePingAfter returns how long a session may be idle before it is pinged before use.
+func (m *Manager) idlePingAfter() time.Duration {
+	if m.opts.IdlePingAfter > 0 {
+		return m.opts.IdlePingAfter
+	}
+	return defaultIdlePingAfter
+}
+
+// dropSession closes a dead session and removes it unless it was already replaced.
+func (m *Manager) dropSession(name string, session *gomcp.ClientSession) {
+	session.Close()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sessions[name] == session {
+		delete(m.sessions, name)
+	}
+}
+
+// GetAllTools returns all tools from connected MCP servers. If listing the tools of a
+// server fails, the tools it listed last are returned so that a transient error does
+// not remove them.
 func (m *Manager) GetAllTools(ctx context.Context) []*Tool {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
+	sessions := make(map[string]*gomcp.ClientSession, len(m.sessions))
+	maps.Copy(sessions, m.sessions)
+	m.mu.RUnlock()
 
 	var tools []*Tool
+	names := make(map[string]ToolRef)
+	claimed := make(map[string]ToolRef) // Bare allowed names already matched, to their tool
+	var collisions [][2]ToolRef
 
-	for name, session := range m.sessions {
-		listed, err := session.ListTools(ctx, &gomcp.ListToolsParams{})
-		if err != nil {
-			slog.Warn("MCP failed to list tools", "server", name, "error", err)
-			continue
+	// Servers are visited in name order, so the first server to claim a name keeps it
+	for _, name := range slices.Sorted(maps.Keys(sessions)) {
+		listed, err := sessions[name].ListTools(ctx, &gomcp.ListToolsParams{})
+
+		m.mu.Lock()
+		if err == nil {
+			m.tools[name] = listed.Tools
+		} else {
+			slog.Warn("MCP failed to list tools", "server", name, "error", err, "cached", len(m.tools[name]))
 		}
+		serverTools := m.tools[name]
+		m.mu.Unlock()
 
-		for _, tool := range listed.Tools {
-			tools = append(tools, &Tool{
-				manager:    m,
-				serverName: name,
-				tool:       tool,
-			})
+		for _, tool := range serverTools {
+			ref := ToolRef{Server: name, Tool: tool.Name}
+			if !m.allowTool(ref, claimed) {
+				continue
+			}
+			exposed := m.toolName(ref)
+			if kept, ok := names[exposed]; ok {
+				collisions = append(collisions, [2]ToolRef{kept, ref})
+				continue
+			}
+			names[exposed] = ref
+			tools = append(tools, m.newTool(ref, exposed, tool))
+		}
+	}
+
+	m.mu.Lock()
+	changed := !maps.Equal(m.toolNames, names)
+	m.toolNames = names
+	m.mu.Unlock()
+
+	// Collisions are only reported when the tools change, not on every listing
+	if changed {
+		for _, c := range collisions {
+			slog.Warn("MCP tool name collision; configure an alias to expose both",
+				"name", m.toolName(c[1]), "kept", c[0], "dropped", c[1])
 		}
 	}
 
 	return tools
 }
 
+// newTool wraps an MCP tool, converting its input schema for the model. Parts of the
+// schema that cannot be represented are logged once per tool.
+func (m *Manager) newTool(ref ToolRef, name string, tool *gomcp.Tool) *Tool {
+	dialect := m.opts.SchemaDialect
+	if dialect == "" {
+		dialect = SchemaDialectJSON
+	}
+	parameters, required, warnings := convertInputSchema(tool.InputSchema, dialect)
+	validation := parameters
+	if dialect != SchemaDialectJSON {
+		validation, _, _ = convertInputSchema(tool.InputSchema, SchemaDialectJSON)
+	}
+	for _, w := range warnings {
+		if _, logged := m.schemaWarnings.LoadOrStore(ref.String()+"\x00"+w, true); !logged {
+			slog.Warn("MCP tool schema simplified", "tool", ref, "dialect", dialect, "detail", w)
+		}
+	}
+
+	return &Tool{
+		manager:    m,
+		serverName: ref.Server,
+		name:       name,
+		tool:       tool,
+		parameters: parameters,
+		required:   required,
+		inputSchema: map[string]any{
+			"type":                 "object",
+			"properties":           validation,
+			"required":             required,
+			"additionalProperties": rootAdditionalProperties(tool.InputSchema),
+		},
+	}
+}
+
 // Close closes all MCP client sessions
 func (m *Manager) Close() error {
+	if m.cancel != nil {
+		m.cancel()
+		m.wg.Wait()
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -0,0 +1,51 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestToolListChangedOutsideRequest(t *testing.T) {
+	schema := map[string]any{"type": "object"}
+	handler := func(context.Context, *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+		return &gomcp.CallToolResult{}, nil
+	}
+	server := gomcp.NewServer(&gomcp.Implementation{Name: "test", Version: "1.0.0"}, nil)
+	server.AddTool(&gomcp.Tool{Name: "list_projects", InputSchema: schema}, handler)
+	httpServer := httptest.NewServer(gomcp.NewStreamableHTTPHandler(func(*http.Request) *gomcp.Server { return server }, nil))
+	defer httpServer.Close()
+
+	// No periodic refresh, so only a list_changed notification triggers one
+	changed := make(chan struct{}, 1)
+	m := NewManager(ManagerOptions{OnToolsChanged: func(context.Context) {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}})
+	m.Initialize(context.Background(), []Config{{Name: "test", URL: httpServer.URL}})
+	defer m.Close()
+
+	// The server notifies sessions of tools added while no request is in flight; add
+	// tools until the standalone stream is up and one notification arrives
+	deadline := time.After(5 * time.Second)
+	for i := 0; ; i++ {
+		server.AddTool(&gomcp.Tool{Name: fmt.Sprintf("new_tool_%d", i), InputSchema: schema}, handler)
+		select {
+		case <-changed:
+			if tools := m.GetAllTools(context.Background()); len(tools) < 2 {
+				t.Errorf("tools after list_changed = %d", len(tools))
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("tools/list_changed sent outside a request was not received")
+		}
+	}
+}
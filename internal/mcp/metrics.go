@@ -0,0 +1,47 @@
+package mcp
+
+import (
+	"encoding/json"
+	"time"
+
+	"charm.land/fantasy"
+
+	"rca.agent/test/internal/metrics"
+)
+
+// responseMetadata returns the error code and cache status attached to a tool response.
+func responseMetadata(response fantasy.ToolResponse) (ErrorCode, CacheStatus) {
+	var meta struct {
+		ErrorCode ErrorCode   `json:"error_code"`
+		Cache     CacheStatus `json:"cache"`
+	}
+	_ = json.Unmarshal([]byte(response.Metadata), &meta)
+	return meta.ErrorCode, meta.Cache
+}
+
+// observeToolCall records the outcome and duration of a tool call.
+func observeToolCall(ref ToolRef, response fantasy.ToolResponse, duration time.Duration) {
+	code, cache := responseMetadata(response)
+	status := "ok"
+	switch {
+	case response.IsError && code != "":
+		status = string(code)
+	case response.IsError:
+		status = string(CodeToolError)
+	case cache == CacheHit || cache == CacheShared:
+		status = "cached"
+	}
+	metrics.ToolCalls.WithLabelValues(ref.Server, ref.Tool, status).Inc()
+	metrics.ToolCallDuration.WithLabelValues(ref.Server, ref.Tool).Observe(duration.Seconds())
+}
+
+// observeState records the current connection state of a server.
+func observeState(s *ServerHealth) {
+	for _, state := range []ServerState{StateConnected, StateDegraded, StateDown} {
+		value := 0.0
+		if s.State == state {
+			value = 1
+		}
+		metrics.ServerState.WithLabelValues(s.Name, string(state)).Set(value)
+	}
+}
@@ -0,0 +1,89 @@
+package mcp
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"regexp"
+	"slices"
+)
+
+// MaxToolNameLength is the longest tool name all providers accept (OpenAI's limit).
+const MaxToolNameLength = 64
+
+// Provider tool names may only contain letters, digits, underscores and hyphens.
+var invalidToolNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// ToolRef identifies an MCP tool by its server and its name on that server.
+type ToolRef struct {
+	Server string `json:"server"`
+	Tool   string `json:"tool"`
+}
+
+func (r ToolRef) String() string {
+	return r.Server + "/" + r.Tool
+}
+
+// toolName returns the name a tool is offered to the model under: mcp_<server>_<tool>,
+// where an alias for "server/tool" replaces the whole name and an alias for "server"
+// replaces the server part.
+func (m *Manager) toolName(ref ToolRef) string {
+	if alias, ok := m.opts.ToolAliases[ref.String()]; ok {
+		return sanitizeToolName(alias)
+	}
+	server := ref.Server
+	if alias, ok := m.opts.ToolAliases[ref.Server]; ok {
+		server = alias
+	}
+	return sanitizeToolName("mcp_" + server + "_" + ref.Tool)
+}
+
+// allowTool reports whether a tool is in AllowedTools. claimed holds the tools
+// bare names were already matched to in this listing, so that a bare name only
+// allows the first tool it matches.
+func (m *Manager) allowTool(ref ToolRef, claimed map[string]ToolRef) bool {
+	allowed := m.opts.AllowedTools
+	switch {
+	case allowed == nil, slices.Contains(allowed, ref.String()):
+		return true
+	case slices.Contains(allowed, ref.Tool):
+		if first, ok := claimed[ref.Tool]; ok {
+			slog.Debug("MCP tool allowed by name on another server; allow it as server/tool", "tool", ref, "allowed", first)
+			return false
+		}
+		claimed[ref.Tool] = ref
+		return true
+	}
+	return false
+}
+
+// sanitizeToolName replaces characters providers reject and shortens names over
+// MaxToolNameLength, keeping them unique with a hash of the full name.
+func sanitizeToolName(name string) string {
+	name = invalidToolNameChars.ReplaceAllString(name, "_")
+	if len(name) <= MaxToolNameLength {
+		return name
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	suffix := fmt.Sprintf("_%08x", h.Sum32())
+	return name[:MaxToolNameLength-len(suffix)] + suffix
+}
+
+// ResolveTool returns the MCP tool offered to the model under name.
+func (m *Manager) ResolveTool(name string) (ToolRef, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ref, ok := m.toolNames[name]
+	return ref, ok
+}
+
+// ToolLabel returns "server/tool" for a tool name offered to the model, for logs.
+// Names of tools that do not come from MCP servers are returned unchanged.
+func (m *Manager) ToolLabel(name string) string {
+	if ref, ok := m.ResolveTool(name); ok {
+		return ref.String()
+	}
+	return name
+}
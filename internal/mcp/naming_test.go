@@ -0,0 +1,58 @@
+package mcp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestToolName(t *testing.T) {
+	m := NewManager(ManagerOptions{ToolAliases: map[string]string{
+		"openchoreo-api":           "choreo",
+		"observability/get_traces": "traces",
+	}})
+
+	long := strings.Repeat("x", 80)
+	tests := []struct {
+		ref  ToolRef
+		want string
+	}{
+		{ToolRef{"observability", "get_project_logs"}, "mcp_observability_get_project_logs"},
+		{ToolRef{"observability", "get_traces"}, "traces"},
+		{ToolRef{"openchoreo-api", "list_projects"}, "mcp_choreo_list_projects"},
+		{ToolRef{"team.payments", "list projects"}, "mcp_team_payments_list_projects"},
+	}
+	for _, tt := range tests {
+		if got := m.toolName(tt.ref); got != tt.want {
+			t.Errorf("toolName(%v) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+
+	a, b := m.toolName(ToolRef{"observability", long + "a"}), m.toolName(ToolRef{"observability", long + "b"})
+	if len(a) != MaxToolNameLength || len(b) != MaxToolNameLength || a == b {
+		t.Errorf("long names = %q, %q", a, b)
+	}
+}
+
+func TestGetAllToolsChecksCollisionsAmongAllowedTools(t *testing.T) {
+	schema := map[string]any{"type": "object"}
+	// Both tools are offered as mcp_test_get_logs; only the second is allowed
+	m := newTestManager(t, ManagerOptions{AllowedTools: []string{"test/get_logs"}}, func(s *gomcp.Server) {
+		for _, name := range []string{"get.logs", "get_logs"} {
+			s.AddTool(&gomcp.Tool{Name: name, InputSchema: schema}, func(context.Context, *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+				return &gomcp.CallToolResult{}, nil
+			})
+		}
+	})
+
+	tools := m.GetAllTools(context.Background())
+	if len(tools) != 1 || tools[0].Ref() != (ToolRef{"test", "get_logs"}) {
+		var refs []ToolRef
+		for _, tool := range tools {
+			refs = append(refs, tool.Ref())
+		}
+		t.Errorf("tools = %v, want only test/get_logs", refs)
+	}
+}
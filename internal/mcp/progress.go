@@ -0,0 +1,212 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Progress is a progress update reported by a long-running MCP tool call.
+type Progress struct {
+	Server     string  `json:"server"`
+	Tool       string  `json:"tool"`
+	ToolCallID string  `json:"tool_call_id"`
+	Progress   float64 `json:"progress"`
+	Total      float64 `json:"total,omitempty"` // 0 if unknown
+	Message    string  `json:"message,omitempty"`
+}
+
+// ProgressFunc receives progress updates of tool calls.
+type ProgressFunc func(Progress)
+
+type progressFuncKey struct{}
+
+// WithProgressFunc returns a context whose tool calls report progress to fn.
+func WithProgressFunc(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressFuncKey{}, fn)
+}
+
+func progressFuncFrom(ctx context.Context) ProgressFunc {
+	fn, _ := ctx.Value(progressFuncKey{}).(ProgressFunc)
+	return fn
+}
+
+// RawResultFunc receives the result of a tool call as the server returned it, before
+// response transformers and size limits are applied.
+type RawResultFunc func(toolCallID, raw string)
+
+type rawResultFuncKey struct{}
+
+// WithRawResultFunc returns a context whose tool calls report their raw results to fn.
+func WithRawResultFunc(ctx context.Context, fn RawResultFunc) context.Context {
+	return context.WithValue(ctx, rawResultFuncKey{}, fn)
+}
+
+func rawResultFuncFrom(ctx context.Context) RawResultFunc {
+	fn, _ := ctx.Value(rawResultFuncKey{}).(RawResultFunc)
+	return fn
+}
+
+// trackedCall is a tool call in flight, which the tool calls of several analyses
+// may be waiting for when identical calls are shared.
+type trackedCall struct {
+	server, tool string
+	ctx          context.Context // Shared call context, cancelled when no analysis waits
+	cancel       context.CancelFunc
+
+	mu       sync.Mutex
+	waiters  []*callWaiter
+	deadline *callDeadline // Timeout of the call while it runs, if any
+}
+
+// callWaiter is an analysis' tool call waiting for a tracked call.
+type callWaiter struct {
+	toolCallID string
+	report     ProgressFunc
+	elicit     *elicitor
+	usage      *usageReporter
+}
+
+// join adds an analysis' tool call, made with ctx, to the call's waiters and returns
+// a function removing it.
+func (c *trackedCall) join(ctx context.Context, toolCallID string) func() {
+	w := &callWaiter{toolCallID: toolCallID, report: progressFuncFrom(ctx), elicit: elicitorFrom(ctx), usage: usageReporterFrom(ctx)}
+	c.mu.Lock()
+	c.waiters = append(c.waiters, w)
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.waiters = slices.DeleteFunc(c.waiters, func(o *callWaiter) bool { return o == w })
+	}
+}
+
+func (c *trackedCall) currentWaiters() []*callWaiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.waiters)
+}
+
+func (c *trackedCall) setDeadline(d *callDeadline) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = d
+}
+
+// pauseDeadline suspends the call's timeout until the returned function is called.
+func (c *trackedCall) pauseDeadline() func() {
+	c.mu.Lock()
+	d := c.deadline
+	c.mu.Unlock()
+	return d.pause()
+}
+
+// callDeadline is the timeout of a running tool call. It is suspended while the
+// server waits for a human to answer a question, so that answering can take longer
+// than the call itself may.
+type callDeadline struct {
+	mu        sync.Mutex
+	timer     *time.Timer
+	remaining time.Duration // Time left when the timer was last started
+	started   time.Time
+	paused    int // Pending questions
+	expired   bool
+}
+
+// startCallDeadline calls expire after timeout, not counting the time paused.
+func startCallDeadline(timeout time.Duration, expire func()) *callDeadline {
+	d := &callDeadline{remaining: timeout, started: time.Now()}
+	d.timer = time.AfterFunc(timeout, func() {
+		d.mu.Lock()
+		d.expired = true
+		d.mu.Unlock()
+		expire()
+	})
+	return d
+}
+
+// pause suspends the deadline until the returned function is called. A nil deadline
+// does not expire.
+func (d *callDeadline) pause() func() {
+	if d == nil {
+		return func() {}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.expired {
+		return func() {}
+	}
+	if d.paused == 0 {
+		d.timer.Stop()
+		d.remaining -= time.Since(d.started)
+	}
+	d.paused++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			if d.paused--; d.paused == 0 && !d.expired {
+				d.started = time.Now()
+				d.timer.Reset(max(d.remaining, 0))
+			}
+		})
+	}
+}
+
+// stop releases the deadline's timer.
+func (d *callDeadline) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expired = true
+	d.timer.Stop()
+}
+
+// trackProgress registers a progress token for a tool call. Progress notifications
+// carrying the token are logged and passed to the ProgressFunc of each waiting
+// analysis. The returned function unregisters the token.
+func (m *Manager) trackProgress(call *trackedCall) (string, func()) {
+	token := fmt.Sprintf("rca-%d", m.progressSeq.Add(1))
+	m.progress.Store(token, call)
+	return token, func() { m.progress.Delete(token) }
+}
+
+// handleProgress dispatches a progress notification to the call that owns its token.
+func (m *Manager) handleProgress(_ context.Context, req *gomcp.ProgressNotificationClientRequest) {
+	token, ok := req.Params.ProgressToken.(string)
+	if !ok {
+		return
+	}
+	v, ok := m.progress.Load(token)
+	if !ok {
+		return
+	}
+
+	call := v.(*trackedCall)
+	waiters := call.currentWaiters()
+	p := Progress{Server: call.server, Tool: call.tool, Progress: req.Params.Progress, Total: req.Params.Total, Message: req.Params.Message}
+	if len(waiters) > 0 {
+		p.ToolCallID = waiters[0].toolCallID
+	}
+
+	slog.Info("MCP tool progress",
+		"server", p.Server,
+		"tool", p.Tool,
+		"id", p.ToolCallID,
+		"progress", p.Progress,
+		"total", p.Total,
+		"message", p.Message)
+	for _, w := range waiters {
+		if w.report != nil {
+			p.ToolCallID = w.toolCallID
+			w.report(p)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"charm.land/fantasy"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Prompt is a prompt template published by an MCP server.
+type Prompt struct {
+	Server      string           `json:"server"`
+	Name        string           `json:"name"`
+	Title       string           `json:"title,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+// PromptArgument is an argument of a prompt template.
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// ListPrompts returns the prompts of all connected servers that publish any.
+func (m *Manager) ListPrompts(ctx context.Context) []Prompt {
+	sessions := m.sessionsWith(func(c *gomcp.ServerCapabilities) bool { return c.Prompts != nil })
+
+	var prompts []Prompt
+	for _, name := range slices.Sorted(maps.Keys(sessions)) {
+		for p, err := range sessions[name].Prompts(ctx, nil) {
+			if err != nil {
+				slog.Warn("MCP failed to list prompts", "server", name, "error", err)
+				break
+			}
+			prompt := Prompt{Server: name, Name: p.Name, Title: p.Title, Description: p.Description}
+			for _, arg := range p.Arguments {
+				prompt.Arguments = append(prompt.Arguments, PromptArgument{
+					Name:        arg.Name,
+					Description: arg.Description,
+					Required:    arg.Required,
+				})
+			}
+			prompts = append(prompts, prompt)
+		}
+	}
+	return prompts
+}
+
+// GetPrompt renders a prompt template into messages.
+func (m *Manager) GetPrompt(ctx context.Context, server, name string, args map[string]string) ([]fantasy.Message, error) {
+	session, err := m.GetSession(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	result, err := session.GetPrompt(ctx, &gomcp.GetPromptParams{Name: name, Arguments: args})
+	if err != nil {
+		m.recordCall(server, time.Since(start), classifyError(err), err)
+		return nil, err
+	}
+	m.recordCall(server, time.Since(start), "", nil)
+
+	messages := make([]fantasy.Message, 0, len(result.Messages))
+	for _, msg := range result.Messages {
+		text := promptContentText(msg.Content)
+		if msg.Role == "assistant" {
+			messages = append(messages, fantasy.Message{
+				Role:    fantasy.MessageRoleAssistant,
+				Content: []fantasy.MessagePart{fantasy.TextPart{Text: text}},
+			})
+		} else {
+			messages = append(messages, fantasy.NewUserMessage(text))
+		}
+	}
+	return messages, nil
+}
+
+// promptContentText renders prompt message content as text.
+func promptContentText(c gomcp.Content) string {
+	switch content := c.(type) {
+	case *gomcp.TextContent:
+		return content.Text
+	case *gomcp.EmbeddedResource:
+		if content.Resource != nil && content.Resource.Blob == nil {
+			return inlineResource(content.Resource)
+		}
+	case *gomcp.ResourceLink:
+		return describeResourceLink(content)
+	}
+	return fmt.Sprintf("[%T content omitted]", c)
+}
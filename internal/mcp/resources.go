@@ -0,0 +1,255 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"charm.land/fantasy"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const ReadResourceToolName = "read_resource"
+
+const readResourceDescription = `Read documents published by the platform's MCP servers, such as component specs and runbooks.
+Call without a uri to list the available resources, then call again with the uri (and server) of the resource to read.`
+
+// Resource is a resource published by an MCP server.
+type Resource struct {
+	Server      string `json:"server"`
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	MIMEType    string `json:"mime_type,omitempty"`
+}
+
+// ReadResourceParams are the parameters of the read_resource tool.
+type ReadResourceParams struct {
+	Server string `json:"server,omitempty" description:"Server that publishes the resource; may be omitted if the uri is unique"`
+	URI    string `json:"uri,omitempty" description:"URI of the resource to read; omit to list available resources"`
+}
+
+// sessionsWith returns the connected sessions whose server advertises a capability.
+func (m *Manager) sessionsWith(has func(*gomcp.ServerCapabilities) bool) map[string]*gomcp.ClientSession {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sessions := make(map[string]*gomcp.ClientSession)
+	for name, session := range m.sessions {
+		if init := session.InitializeResult(); init != nil && init.Capabilities != nil && has(init.Capabilities) {
+			sessions[name] = session
+		}
+	}
+	return sessions
+}
+
+// HasResources reports whether any connected server publishes resources.
+func (m *Manager) HasResources() bool {
+	return len(m.sessionsWith(func(c *gomcp.ServerCapabilities) bool { return c.Resources != nil })) > 0
+}
+
+// ListResources returns the resources of all connected servers that publish any.
+func (m *Manager) ListResources(ctx context.Context) []Resource {
+	sessions := m.sessionsWith(func(c *gomcp.ServerCapabilities) bool { return c.Resources != nil })
+
+	var resources []Resource
+	for _, name := range slices.Sorted(maps.Keys(sessions)) {
+		for r, err := range sessions[name].Resources(ctx, nil) {
+			if err != nil {
+				slog.Warn("MCP failed to list resources", "server", name, "error", err)
+				break
+			}
+			resources = append(resources, Resource{
+				Server:      name,
+				URI:         r.URI,
+				Name:        r.Name,
+				Title:       r.Title,
+				Description: r.Description,
+				MIMEType:    r.MIMEType,
+			})
+		}
+	}
+	return resources
+}
+
+// resourceCacheTTL bounds how long a subscribed resource is cached, in case the
+// server's update notification is lost or it cannot send one.
+var resourceCacheTTL = 5 * time.Minute
+
+// maxCachedResources bounds the resources kept subscribed; beyond it the entry
+// closest to expiry is evicted and unsubscribed.
+var maxCachedResources = 100
+
+// cachedResource is the rendered contents of a subscribed resource. The entry
+// lives as long as the subscription, and its contents are re-read in place once
+// stale.
+type cachedResource struct {
+	session *gomcp.ClientSession // Session holding the subscription
+	text    string
+	expires time.Time
+}
+
+// ReadResource reads a resource and renders its contents as text. Resources the
+// server lets us subscribe to are subscribed once per session, and their contents
+// are cached until it reports an update, for at most resourceCacheTTL.
+func (m *Manager) ReadResource(ctx context.Context, server, uri string) (string, error) {
+	key := server + "\x00" + uri
+	m.mu.RLock()
+	cached, ok := m.resources[key]
+	m.mu.RUnlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.text, nil
+	}
+
+	session, err := m.GetSession(ctx, server)
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	result, err := session.ReadResource(ctx, &gomcp.ReadResourceParams{URI: uri})
+	if err != nil {
+		m.recordCall(server, time.Since(start), classifyError(err), err)
+		return "", err
+	}
+	m.recordCall(server, time.Since(start), "", nil)
+
+	parts := make([]string, 0, len(result.Contents))
+	for _, c := range result.Contents {
+		if c.Blob != nil {
+			parts = append(parts, fmt.Sprintf("[binary resource omitted: %s (%s, %d bytes)]", c.URI, c.MIMEType, len(c.Blob)))
+			continue
+		}
+		parts = append(parts, inlineResource(c))
+	}
+	text := strings.Join(parts, "\n\n")
+
+	if ok && cached.session == session {
+		// Still subscribed; only the contents were stale
+		m.cacheResource(ctx, key, session, text)
+		return text, nil
+	}
+	if init := session.InitializeResult(); init != nil && init.Capabilities != nil &&
+		init.Capabilities.Resources != nil && init.Capabilities.Resources.Subscribe {
+		if err := session.Subscribe(ctx, &gomcp.SubscribeParams{URI: uri}); err != nil {
+			slog.Debug("MCP resource subscription failed", "server", server, "uri", uri, "error", err)
+		} else {
+			m.cacheResource(ctx, key, session, text)
+		}
+	}
+
+	return text, nil
+}
+
+// cacheResource stores the contents of a subscribed resource, evicting and
+// unsubscribing the entry closest to expiry if the cache is full.
+func (m *Manager) cacheResource(ctx context.Context, key string, session *gomcp.ClientSession, text string) {
+	m.mu.Lock()
+	var evictKey string
+	var evicted cachedResource
+	if _, ok := m.resources[key]; !ok && len(m.resources) >= maxCachedResources {
+		for k, r := range m.resources {
+			if evictKey == "" || r.expires.Before(evicted.expires) {
+				evictKey, evicted = k, r
+			}
+		}
+		delete(m.resources, evictKey)
+	}
+	m.resources[key] = cachedResource{session: session, text: text, expires: time.Now().Add(resourceCacheTTL)}
+	m.mu.Unlock()
+
+	if evictKey != "" {
+		server, uri, _ := strings.Cut(evictKey, "\x00")
+		if err := evicted.session.Unsubscribe(ctx, &gomcp.UnsubscribeParams{URI: uri}); err != nil {
+			slog.Debug("MCP resource unsubscription failed", "server", server, "uri", uri, "error", err)
+		}
+	}
+}
+
+// resourceUpdated marks a cached resource stale after the server reported a
+// change. The subscription is kept, so the next read refreshes the contents.
+func (m *Manager) resourceUpdated(server, uri string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := server + "\x00" + uri
+	if r, ok := m.resources[key]; ok {
+		r.expires = time.Time{}
+		m.resources[key] = r
+	}
+}
+
+// forgetResources drops the cached resources of a server whose session was
+// replaced, since subscriptions do not carry over to the new session.
+// The caller must hold m.mu.
+func (m *Manager) forgetResources(server string) {
+	for key := range m.resources {
+		if strings.HasPrefix(key, server+"\x00") {
+			delete(m.resources, key)
+		}
+	}
+}
+
+// NewReadResourceTool creates the read_resource tool, which lists and reads the
+// resources of the manager's servers. Its results are held to the size limit of
+// tool results, which ToolResultLimits may override for read_resource.
+func NewReadResourceTool(m *Manager) fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		ReadResourceToolName,
+		readResourceDescription,
+		func(ctx context.Context, params ReadResourceParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			if params.URI == "" {
+				resources := m.ListResources(ctx)
+				if params.Server != "" {
+					resources = slices.DeleteFunc(resources, func(r Resource) bool { return r.Server != params.Server })
+				}
+				if len(resources) == 0 {
+					return fantasy.NewTextResponse("No resources are available."), nil
+				}
+				b, err := json.Marshal(resources)
+				if err != nil {
+					return fantasy.NewTextErrorResponse(err.Error()), nil
+				}
+				return fantasy.NewTextResponse(m.limitResult(params.Server, ReadResourceToolName, string(b))), nil
+			}
+
+			server := params.Server
+			if server == "" {
+				var err error
+				if server, err = m.resourceServer(ctx, params.URI); err != nil {
+					return fantasy.NewTextErrorResponse(err.Error()), nil
+				}
+			}
+
+			text, err := m.ReadResource(ctx, server, params.URI)
+			if err != nil {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("[%s] %v", classifyError(err), err)), nil
+			}
+			return fantasy.NewTextResponse(m.limitResult(server, ReadResourceToolName, text)), nil
+		})
+}
+
+// resourceServer finds the server that publishes a resource.
+func (m *Manager) resourceServer(ctx context.Context, uri string) (string, error) {
+	var servers []string
+	for _, r := range m.ListResources(ctx) {
+		if r.URI == uri && !slices.Contains(servers, r.Server) {
+			servers = append(servers, r.Server)
+		}
+	}
+
+	switch len(servers) {
+	case 1:
+		return servers[0], nil
+	case 0:
+		return "", fmt.Errorf("no server publishes resource %q; call %s without a uri to list resources", uri, ReadResourceToolName)
+	default:
+		return "", errors.New("resource " + uri + " is published by several servers (" + strings.Join(servers, ", ") + "); pass the server")
+	}
+}
@@ -0,0 +1,167 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestResourcesAndPrompts(t *testing.T) {
+	m := newTestManager(t, ManagerOptions{}, func(s *gomcp.Server) {
+		s.AddResource(&gomcp.Resource{URI: "docs://runbooks/payments", Name: "payments-runbook", MIMEType: "text/markdown"},
+			func(ctx context.Context, req *gomcp.ReadResourceRequest) (*gomcp.ReadResourceResult, error) {
+				return &gomcp.ReadResourceResult{Contents: []*gomcp.ResourceContents{
+					{URI: req.Params.URI, MIMEType: "text/markdown", Text: "Restart the payments pods."},
+				}}, nil
+			})
+		s.AddPrompt(&gomcp.Prompt{Name: "latency", Arguments: []*gomcp.PromptArgument{{Name: "service", Required: true}}},
+			func(ctx context.Context, req *gomcp.GetPromptRequest) (*gomcp.GetPromptResult, error) {
+				return &gomcp.GetPromptResult{Messages: []*gomcp.PromptMessage{
+					{Role: "user", Content: &gomcp.TextContent{Text: "Investigate latency of " + req.Params.Arguments["service"]}},
+				}}, nil
+			})
+	})
+	ctx := context.Background()
+
+	tool := NewReadResourceTool(m)
+	resp, err := tool.Run(ctx, fantasy.ToolCall{ID: "call-1", Input: `{}`})
+	if err != nil || resp.IsError || !strings.Contains(resp.Content, "docs://runbooks/payments") {
+		t.Fatalf("list resources = %+v, %v", resp, err)
+	}
+	resp, err = tool.Run(ctx, fantasy.ToolCall{ID: "call-2", Input: `{"uri": "docs://runbooks/payments"}`})
+	if err != nil || resp.IsError || !strings.Contains(resp.Content, "Restart the payments pods.") {
+		t.Fatalf("read resource = %+v, %v", resp, err)
+	}
+	resp, err = tool.Run(ctx, fantasy.ToolCall{ID: "call-3", Input: `{"uri": "docs://missing"}`})
+	if err != nil || !resp.IsError {
+		t.Fatalf("read missing resource = %+v, %v", resp, err)
+	}
+
+	prompts := m.ListPrompts(ctx)
+	if len(prompts) != 1 || prompts[0].Server != "test" || prompts[0].Name != "latency" || !prompts[0].Arguments[0].Required {
+		t.Fatalf("prompts = %+v", prompts)
+	}
+	messages, err := m.GetPrompt(ctx, "test", "latency", map[string]string{"service": "checkout"})
+	if err != nil || len(messages) != 1 || messages[0].Role != fantasy.MessageRoleUser {
+		t.Fatalf("GetPrompt = %+v, %v", messages, err)
+	}
+	if text := messages[0].Content[0].(fantasy.TextPart).Text; text != "Investigate latency of checkout" {
+		t.Errorf("prompt text = %q", text)
+	}
+}
+
+func TestReadResourceLimitsSize(t *testing.T) {
+	m := newTestManager(t, ManagerOptions{ResultLimit: ResultLimit{MaxBytes: 1000}}, func(s *gomcp.Server) {
+		s.AddResource(&gomcp.Resource{URI: "docs://runbooks/payments", Name: "payments-runbook"},
+			func(ctx context.Context, req *gomcp.ReadResourceRequest) (*gomcp.ReadResourceResult, error) {
+				return &gomcp.ReadResourceResult{Contents: []*gomcp.ResourceContents{
+					{URI: req.Params.URI, Text: strings.Repeat("Restart the payments pods.\n", 200)},
+				}}, nil
+			})
+	})
+	if !m.HasResources() {
+		t.Fatal("HasResources() = false, want true")
+	}
+
+	resp, err := NewReadResourceTool(m).Run(context.Background(), fantasy.ToolCall{ID: "call-1", Input: `{"uri": "docs://runbooks/payments"}`})
+	if err != nil || resp.IsError {
+		t.Fatalf("read resource = %+v, %v", resp, err)
+	}
+	if len(resp.Content) > 1000 || !strings.Contains(resp.Content, "[truncated: ") {
+		t.Errorf("read resource returned %d bytes: %.100q", len(resp.Content), resp.Content)
+	}
+}
+
+func TestHasResourcesWithoutResourceServers(t *testing.T) {
+	m := newTestManager(t, ManagerOptions{}, func(s *gomcp.Server) {
+		s.AddTool(&gomcp.Tool{Name: "list_projects", InputSchema: map[string]any{"type": "object"}}, func(context.Context, *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			return &gomcp.CallToolResult{}, nil
+		})
+	})
+	if m.HasResources() {
+		t.Error("HasResources() = true for a server without resources")
+	}
+}
+
+func TestSubscribedResourceCache(t *testing.T) {
+	var version, subscribes, unsubscribes atomic.Int32
+	server := gomcp.NewServer(&gomcp.Implementation{Name: "test", Version: "1.0.0"}, &gomcp.ServerOptions{
+		SubscribeHandler: func(context.Context, *gomcp.SubscribeRequest) error {
+			subscribes.Add(1)
+			return nil
+		},
+		UnsubscribeHandler: func(context.Context, *gomcp.UnsubscribeRequest) error {
+			unsubscribes.Add(1)
+			return nil
+		},
+	})
+	readHandler := func(ctx context.Context, req *gomcp.ReadResourceRequest) (*gomcp.ReadResourceResult, error) {
+		text := map[int32]string{0: "v0", 1: "v1", 2: "v2"}[version.Load()]
+		return &gomcp.ReadResourceResult{Contents: []*gomcp.ResourceContents{{URI: req.Params.URI, Text: text}}}, nil
+	}
+	server.AddResource(&gomcp.Resource{URI: "docs://runbook", Name: "runbook"}, readHandler)
+	server.AddResource(&gomcp.Resource{URI: "docs://spec", Name: "spec"}, readHandler)
+	httpServer := httptest.NewServer(gomcp.NewStreamableHTTPHandler(func(*http.Request) *gomcp.Server { return server }, nil))
+	defer httpServer.Close()
+
+	m := NewManager(ManagerOptions{})
+	m.Initialize(context.Background(), []Config{{Name: "test", URL: httpServer.URL}})
+	defer m.Close()
+	ctx := context.Background()
+
+	read := func(uri string) string {
+		t.Helper()
+		text, err := m.ReadResource(ctx, "test", uri)
+		if err != nil {
+			t.Fatalf("ReadResource: %v", err)
+		}
+		// The contents follow a header naming the resource
+		return text[strings.LastIndex(text, "\n")+1:]
+	}
+	if got := read("docs://runbook"); got != "v0" {
+		t.Fatalf("first read = %q", got)
+	}
+	version.Store(1)
+	if got := read("docs://runbook"); got != "v0" {
+		t.Fatalf("cached read = %q, want v0", got)
+	}
+
+	// The update notification arrives outside a request and drops the cached contents
+	server.ResourceUpdated(ctx, &gomcp.ResourceUpdatedNotificationParams{URI: "docs://runbook"})
+	deadline := time.Now().Add(5 * time.Second)
+	for read("docs://runbook") != "v1" {
+		if time.Now().After(deadline) {
+			t.Fatal("resource still cached after resources/updated")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// Without a notification, cached contents expire
+	defer func(ttl time.Duration) { resourceCacheTTL = ttl }(resourceCacheTTL)
+	resourceCacheTTL = 50 * time.Millisecond
+	m.resourceUpdated("test", "docs://runbook")
+	read("docs://runbook")
+	version.Store(2)
+	time.Sleep(100 * time.Millisecond)
+	if got := read("docs://runbook"); got != "v2" {
+		t.Errorf("read after TTL = %q, want v2", got)
+	}
+	if n := subscribes.Load(); n != 1 {
+		t.Errorf("subscribed %d times, want once per session", n)
+	}
+
+	// Evicting an entry unsubscribes from it
+	defer func(limit int) { maxCachedResources = limit }(maxCachedResources)
+	maxCachedResources = 1
+	read("docs://spec")
+	if s, u := subscribes.Load(), unsubscribes.Load(); s != 2 || u != 1 {
+		t.Errorf("after eviction subscribed %d and unsubscribed %d times, want 2 and 1", s, u)
+	}
+}
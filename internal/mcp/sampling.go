@@ -0,0 +1,224 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// SamplingPolicy limits what MCP servers may ask of the model through sampling.
+type SamplingPolicy struct {
+	MaxTokens      int64 // Tokens sampled per request; server requests for more are capped
+	MaxInputTokens int64 // Estimated prompt tokens above which requests are refused (0 = unlimited)
+	TokensPerHour  int64 // Tokens each server may use per hour (0 = unlimited)
+}
+
+// UsageFunc receives the usage of the model ("provider:model") that answered a
+// sampling request made while one of an analysis' tool calls ran.
+type UsageFunc func(model string, usage fantasy.Usage)
+
+// usageReporter identifies the analysis a UsageFunc belongs to.
+type usageReporter struct {
+	report UsageFunc
+}
+
+type usageReporterKey struct{}
+
+// WithUsageFunc returns a context whose tool calls report the model usage of the
+// sampling requests servers make while they run to fn.
+func WithUsageFunc(ctx context.Context, fn UsageFunc) context.Context {
+	return context.WithValue(ctx, usageReporterKey{}, &usageReporter{report: fn})
+}
+
+func usageReporterFrom(ctx context.Context) *usageReporter {
+	r, _ := ctx.Value(usageReporterKey{}).(*usageReporter)
+	return r
+}
+
+// ServingModel is a model that serves calls with one of several models, such as a
+// fallback chain, and tells which one served a call.
+type ServingModel interface {
+	fantasy.LanguageModel
+	// GenerateServed generates a response and returns the model ("provider:model")
+	// that served it.
+	GenerateServed(ctx context.Context, call fantasy.Call) (*fantasy.Response, string, error)
+}
+
+// sampler answers sampling requests from MCP servers with the configured model.
+type sampler struct {
+	model  fantasy.LanguageModel
+	policy SamplingPolicy
+	charge func(server, model string, usage fantasy.Usage) // Charges usage to analyses
+
+	mu    sync.Mutex
+	usage map[string]*samplingWindow // Token usage per server in the current hour
+}
+
+type samplingWindow struct {
+	start  time.Time
+	tokens int64
+}
+
+func newSampler(model fantasy.LanguageModel, policy SamplingPolicy, charge func(server, model string, usage fantasy.Usage)) *sampler {
+	return &sampler{model: model, policy: policy, charge: charge, usage: make(map[string]*samplingWindow)}
+}
+
+// handler returns the sampling/createMessage handler for a server's session.
+func (s *sampler) handler(server string) func(context.Context, *gomcp.CreateMessageRequest) (*gomcp.CreateMessageResult, error) {
+	return func(ctx context.Context, req *gomcp.CreateMessageRequest) (*gomcp.CreateMessageResult, error) {
+		result, err := s.createMessage(ctx, server, req.Params)
+		if err != nil {
+			slog.Warn("MCP sampling request failed", "server", server, "error", err)
+		}
+		return result, err
+	}
+}
+
+func (s *sampler) createMessage(ctx context.Context, server string, params *gomcp.CreateMessageParams) (*gomcp.CreateMessageResult, error) {
+	var prompt fantasy.Prompt
+	inputBytes := len(params.SystemPrompt)
+	if params.SystemPrompt != "" {
+		prompt = append(prompt, fantasy.NewSystemMessage(params.SystemPrompt))
+	}
+	for _, msg := range params.Messages {
+		text, ok := msg.Content.(*gomcp.TextContent)
+		if !ok {
+			return nil, &jsonrpc.Error{Code: jsonrpc.CodeInvalidParams, Message: fmt.Sprintf("unsupported sampling content %T: only text is supported", msg.Content)}
+		}
+		inputBytes += len(text.Text)
+		if msg.Role == "assistant" {
+			prompt = append(prompt, fantasy.Message{
+				Role:    fantasy.MessageRoleAssistant,
+				Content: []fantasy.MessagePart{fantasy.TextPart{Text: text.Text}},
+			})
+		} else {
+			prompt = append(prompt, fantasy.NewUserMessage(text.Text))
+		}
+	}
+
+	if s.policy.MaxInputTokens > 0 && int64(inputBytes/bytesPerToken) > s.policy.MaxInputTokens {
+		return nil, &jsonrpc.Error{Code: jsonrpc.CodeInvalidParams, Message: fmt.Sprintf("sampling prompt of ~%d tokens exceeds the limit of %d", inputBytes/bytesPerToken, s.policy.MaxInputTokens)}
+	}
+	if err := s.checkBudget(server); err != nil {
+		return nil, err
+	}
+
+	maxTokens := s.policy.MaxTokens
+	if params.MaxTokens > 0 && params.MaxTokens < maxTokens {
+		maxTokens = params.MaxTokens
+	}
+	call := fantasy.Call{Prompt: prompt, MaxOutputTokens: &maxTokens}
+	if params.Temperature != 0 {
+		call.Temperature = &params.Temperature
+	}
+
+	start := time.Now()
+	resp, served, err := s.generate(ctx, call)
+	if err != nil {
+		return nil, err
+	}
+	s.record(server, resp.Usage.TotalTokens)
+	if s.charge != nil {
+		s.charge(server, served, resp.Usage)
+	}
+
+	slog.Info("MCP sampling request",
+		"server", server,
+		"model", served,
+		"tokens", resp.Usage.TotalTokens,
+		"duration", time.Since(start))
+
+	stopReason := string(resp.FinishReason)
+	switch resp.FinishReason {
+	case fantasy.FinishReasonStop:
+		stopReason = "endTurn"
+	case fantasy.FinishReasonLength:
+		stopReason = "maxTokens"
+	}
+	return &gomcp.CreateMessageResult{
+		Content:    &gomcp.TextContent{Text: resp.Content.Text()},
+		Model:      served[strings.Index(served, ":")+1:],
+		Role:       "assistant",
+		StopReason: stopReason,
+	}, nil
+}
+
+// generate answers a sampling request with the model, returning the model that
+// served it ("provider:model").
+func (s *sampler) generate(ctx context.Context, call fantasy.Call) (*fantasy.Response, string, error) {
+	if m, ok := s.model.(ServingModel); ok {
+		return m.GenerateServed(ctx, call)
+	}
+	resp, err := s.model.Generate(ctx, call)
+	return resp, s.model.Provider() + ":" + s.model.Model(), err
+}
+
+// checkBudget refuses requests from a server that used up its hourly tokens.
+func (s *sampler) checkBudget(server string) error {
+	if s.policy.TokensPerHour <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.usage[server]
+	if w != nil && time.Since(w.start) < time.Hour && w.tokens >= s.policy.TokensPerHour {
+		return &jsonrpc.Error{Code: jsonrpc.CodeInvalidParams, Message: fmt.Sprintf("sampling budget of %d tokens per hour exhausted", s.policy.TokensPerHour)}
+	}
+	return nil
+}
+
+func (s *sampler) record(server string, tokens int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.usage[server]
+	if w == nil || time.Since(w.start) >= time.Hour {
+		w = &samplingWindow{start: time.Now()}
+		s.usage[server] = w
+	}
+	w.tokens += tokens
+}
+
+// chargeSampling charges the usage of a sampling request to the analyses with tool
+// calls in flight on the server. The request does not say which call it belongs
+// to, so if there are several analyses it is split evenly between them.
+func (m *Manager) chargeSampling(server, model string, usage fantasy.Usage) {
+	var reporters []*usageReporter
+	m.progress.Range(func(_, v any) bool {
+		c := v.(*trackedCall)
+		if c.server != server {
+			return true
+		}
+		for _, w := range c.currentWaiters() {
+			if w.usage != nil && !slices.Contains(reporters, w.usage) {
+				reporters = append(reporters, w.usage)
+			}
+		}
+		return true
+	})
+	if len(reporters) == 0 {
+		slog.Debug("MCP sampling usage not charged to an analysis", "server", server, "tokens", usage.TotalTokens)
+		return
+	}
+
+	n := int64(len(reporters))
+	share := fantasy.Usage{
+		InputTokens:         usage.InputTokens / n,
+		OutputTokens:        usage.OutputTokens / n,
+		TotalTokens:         usage.TotalTokens / n,
+		ReasoningTokens:     usage.ReasoningTokens / n,
+		CacheCreationTokens: usage.CacheCreationTokens / n,
+		CacheReadTokens:     usage.CacheReadTokens / n,
+	}
+	for _, r := range reporters {
+		r.report(model, share)
+	}
+}
@@ -0,0 +1,131 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// echoModel answers with the last prompt message and records the output token cap.
+type echoModel struct {
+	fantasy.LanguageModel
+	maxTokens int64
+}
+
+func (m *echoModel) Provider() string { return "fake" }
+func (m *echoModel) Model() string    { return "echo" }
+
+func (m *echoModel) Generate(_ context.Context, call fantasy.Call) (*fantasy.Response, error) {
+	m.maxTokens = *call.MaxOutputTokens
+	last := call.Prompt[len(call.Prompt)-1].Content[0].(fantasy.TextPart)
+	return &fantasy.Response{
+		Content:      fantasy.ResponseContent{fantasy.TextContent{Text: "summary of " + last.Text}},
+		FinishReason: fantasy.FinishReasonStop,
+		Usage:        fantasy.Usage{TotalTokens: 60},
+	}, nil
+}
+
+func TestSamplingAndElicitation(t *testing.T) {
+	schema := map[string]any{"type": "object"}
+	model := &echoModel{}
+	m := newTestManager(t, ManagerOptions{
+		SamplingModel:  model,
+		SamplingPolicy: SamplingPolicy{MaxTokens: 100, MaxInputTokens: 10, TokensPerHour: 100},
+		// Answering a question may take longer than the call may run
+		ToolTimeouts: map[string]time.Duration{"restart_component": 200 * time.Millisecond},
+	}, func(s *gomcp.Server) {
+		s.AddTool(&gomcp.Tool{Name: "summarize_logs", InputSchema: schema}, func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			var args struct{ Logs string }
+			_ = json.Unmarshal(req.Params.Arguments, &args)
+			res, err := req.Session.CreateMessage(ctx, &gomcp.CreateMessageParams{
+				MaxTokens: 500,
+				Messages:  []*gomcp.SamplingMessage{{Role: "user", Content: &gomcp.TextContent{Text: args.Logs}}},
+			})
+			if err != nil {
+				return &gomcp.CallToolResult{IsError: true, Content: []gomcp.Content{&gomcp.TextContent{Text: err.Error()}}}, nil
+			}
+			return &gomcp.CallToolResult{Content: []gomcp.Content{res.Content}}, nil
+		})
+		s.AddTool(&gomcp.Tool{Name: "restart_component", InputSchema: schema}, func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			res, err := req.Session.Elicit(ctx, &gomcp.ElicitParams{
+				Message:         "Restart payments?",
+				RequestedSchema: map[string]any{"type": "object", "properties": map[string]any{"confirm": map[string]any{"type": "boolean"}}},
+			})
+			if err != nil {
+				return nil, err
+			}
+			return &gomcp.CallToolResult{Content: []gomcp.Content{&gomcp.TextContent{Text: res.Action}}}, nil
+		})
+	})
+
+	// Sampling is charged to the analysis whose call the server sampled for
+	var charged []string
+	usageCtx := WithUsageFunc(context.Background(), func(model string, usage fantasy.Usage) {
+		charged = append(charged, fmt.Sprintf("%s=%d", model, usage.TotalTokens))
+	})
+	summarize := testTool(t, m, "summarize_logs")
+	resp, _ := summarize.Run(usageCtx, fantasy.ToolCall{ID: "call-1", Input: `{"logs": "oom"}`})
+	if resp.IsError || resp.Content != "summary of oom" || model.maxTokens != 100 {
+		t.Fatalf("sampling = %+v (max tokens %d)", resp, model.maxTokens)
+	}
+	if len(charged) != 1 || charged[0] != "fake:echo=60" {
+		t.Errorf("charged sampling usage = %v, want [fake:echo=60]", charged)
+	}
+	resp, _ = summarize.Run(context.Background(), fantasy.ToolCall{ID: "call-2", Input: `{"logs": "` + strings.Repeat("x", 100) + `"}`})
+	if !resp.IsError || !strings.Contains(resp.Content, "exceeds the limit") {
+		t.Errorf("oversized sampling prompt = %+v", resp)
+	}
+	summarize.Run(context.Background(), fantasy.ToolCall{ID: "call-3", Input: `{"logs": "disk"}`})
+	resp, _ = summarize.Run(context.Background(), fantasy.ToolCall{ID: "call-4", Input: `{"logs": "cpu"}`})
+	if !resp.IsError || !strings.Contains(resp.Content, "budget") {
+		t.Errorf("sampling over hourly budget = %+v", resp)
+	}
+
+	restart := testTool(t, m, "restart_component")
+	resp, _ = restart.Run(context.Background(), fantasy.ToolCall{ID: "call-5", Input: `{}`})
+	if resp.Content != "decline" {
+		t.Errorf("elicitation without ElicitFunc = %+v", resp)
+	}
+
+	var asked Elicitation
+	ctx := WithElicitFunc(context.Background(), func(_ context.Context, e Elicitation) (ElicitationResponse, error) {
+		asked = e
+		time.Sleep(400 * time.Millisecond)
+		return ElicitationResponse{Action: "accept", Content: map[string]any{"confirm": true}}, nil
+	})
+	resp, _ = restart.Run(ctx, fantasy.ToolCall{ID: "call-6", Input: `{}`})
+	if resp.Content != "accept" || asked.ToolCallID != "call-6" || asked.Message != "Restart payments?" {
+		t.Errorf("elicitation = %+v, asked %+v", resp, asked)
+	}
+}
+
+// fallbackEchoModel is an echoModel whose answers are served by a fallback model.
+type fallbackEchoModel struct {
+	echoModel
+}
+
+func (m *fallbackEchoModel) GenerateServed(ctx context.Context, call fantasy.Call) (*fantasy.Response, string, error) {
+	resp, err := m.Generate(ctx, call)
+	return resp, "other:fallback", err
+}
+
+func TestSamplingChargesServedModel(t *testing.T) {
+	var charged string
+	s := newSampler(&fallbackEchoModel{}, SamplingPolicy{MaxTokens: 100}, func(_, model string, _ fantasy.Usage) { charged = model })
+
+	result, err := s.createMessage(context.Background(), "test", &gomcp.CreateMessageParams{
+		Messages: []*gomcp.SamplingMessage{{Role: "user", Content: &gomcp.TextContent{Text: "oom"}}},
+	})
+	if err != nil {
+		t.Fatalf("createMessage() error = %v", err)
+	}
+	if charged != "other:fallback" || result.Model != "fallback" {
+		t.Errorf("charged %q, result model %q, want the fallback model", charged, result.Model)
+	}
+}
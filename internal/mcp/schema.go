@@ -0,0 +1,386 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// SchemaDialect is the subset of JSON Schema tool input schemas are converted to.
+type SchemaDialect string
+
+const (
+	// SchemaDialectJSON keeps the full schema, with $refs inlined.
+	SchemaDialectJSON SchemaDialect = "json_schema"
+	// SchemaDialectGemini reduces schemas to what the Gemini provider translates: type,
+	// description, properties, required, items and string enums. Alternatives are
+	// narrowed to the first one, and enums, formats and defaults are spelled out in
+	// the description.
+	SchemaDialectGemini SchemaDialect = "gemini"
+)
+
+// Keywords the Gemini dialect keeps; the rest are described or dropped.
+var geminiKeywords = []string{"type", "description", "properties", "required", "items", "enum"}
+
+// Keywords that carry no meaning for the model once $refs are inlined.
+var metaKeywords = []string{"$defs", "definitions", "$schema", "$id", "$comment", "$anchor"}
+
+// schemaConverter converts a tool's input schema into the properties and required
+// fields of fantasy.ToolInfo, collecting what cannot be represented.
+type schemaConverter struct {
+	dialect  SchemaDialect
+	defs     map[string]any // $ref targets by pointer, e.g. "#/$defs/TimeRange"
+	warnings []string
+}
+
+// convertInputSchema converts an MCP input schema, which may be a map, a
+// *jsonschema.Schema or raw JSON, for the model.
+func convertInputSchema(input any, dialect SchemaDialect) (properties map[string]any, required []string, warnings []string) {
+	properties = make(map[string]any)
+	if input == nil {
+		return properties, nil, nil
+	}
+
+	root, err := normalizeSchema(input)
+	if err != nil {
+		return properties, nil, []string{fmt.Sprintf("input schema is not a JSON object (%v); the tool is offered without parameters", err)}
+	}
+
+	c := &schemaConverter{dialect: dialect, defs: make(map[string]any)}
+	for _, key := range []string{"$defs", "definitions"} {
+		defs, _ := root[key].(map[string]any)
+		for name, def := range defs {
+			c.defs["#/"+key+"/"+name] = def
+		}
+	}
+	root, stack := c.resolve(root, "", nil)
+
+	if typ, ok := root["type"].(string); ok && typ != "object" {
+		c.warn("", "root schema of type %s is offered as an object", typ)
+	}
+
+	// The root is always offered as a plain object, so alternatives are merged
+	rootProps, _ := root["properties"].(map[string]any)
+	rootProps = maps.Clone(rootProps)
+	required = stringList(root["required"])
+	for _, key := range []string{"anyOf", "oneOf"} {
+		variants, _ := root[key].([]any)
+		if len(variants) == 0 {
+			continue
+		}
+		c.warn("", "root %s is offered as the union of its variants' properties; variant requirements are not declared", key)
+		for _, v := range variants {
+			variant, ok := v.(map[string]any)
+			if !ok {
+				continue
+			}
+			variant, _ = c.resolve(variant, "", nil)
+			props, _ := variant["properties"].(map[string]any)
+			for name, prop := range props {
+				if _, ok := rootProps[name]; !ok {
+					if rootProps == nil {
+						rootProps = make(map[string]any)
+					}
+					rootProps[name] = prop
+				}
+			}
+		}
+	}
+	if extra, ok := root["additionalProperties"]; ok && extra != false && len(rootProps) == 0 {
+		c.warn("", "arbitrary root properties cannot be declared")
+	}
+
+	for name, prop := range rootProps {
+		properties[name] = c.convert(prop, name, stack)
+	}
+	return properties, required, c.warnings
+}
+
+// normalizeSchema turns a schema of any Go type into a generic JSON map.
+func normalizeSchema(schema any) (map[string]any, error) {
+	if m, ok := schema.(map[string]any); ok {
+		return m, nil
+	}
+
+	var raw []byte
+	switch s := schema.(type) {
+	case json.RawMessage:
+		raw = s
+	case []byte:
+		raw = s
+	default:
+		var err error
+		if raw, err = json.Marshal(schema); err != nil {
+			return nil, err
+		}
+	}
+	var m map[string]any
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *schemaConverter) warn(path, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if path != "" {
+		msg = path + ": " + msg
+	}
+	if !slices.Contains(c.warnings, msg) {
+		c.warnings = append(c.warnings, msg)
+	}
+}
+
+// resolve follows a schema's $ref, letting keywords next to the $ref override the
+// target's. stack holds the refs being expanded, to stop at recursive schemas; it is
+// returned with the refs followed added.
+func (c *schemaConverter) resolve(s map[string]any, path string, stack []string) (map[string]any, []string) {
+	ref, ok := s["$ref"].(string)
+	if !ok {
+		return s, stack
+	}
+
+	placeholder := make(map[string]any)
+	if desc, ok := s["description"]; ok {
+		placeholder["description"] = desc
+	}
+	if slices.Contains(stack, ref) {
+		c.warn(path, "recursive reference %s is offered as an unconstrained object", ref)
+		placeholder["type"] = "object"
+		return placeholder, stack
+	}
+	target, ok := c.defs[ref].(map[string]any)
+	if !ok {
+		c.warn(path, "unresolvable reference %s is offered as an unconstrained value", ref)
+		return placeholder, stack
+	}
+
+	resolved, stack := c.resolve(target, path, append(slices.Clone(stack), ref))
+	merged := maps.Clone(resolved)
+	for k, v := range s {
+		if k != "$ref" {
+			merged[k] = v
+		}
+	}
+	return merged, stack
+}
+
+// convert inlines the $refs of a schema node and its children, and reduces it to
+// the converter's dialect.
+func (c *schemaConverter) convert(node any, path string, stack []string) any {
+	s, ok := node.(map[string]any)
+	if !ok {
+		// Boolean schemas: true accepts anything, false nothing
+		if node == false {
+			c.warn(path, "false schema is offered as an unconstrained value")
+		}
+		return map[string]any{}
+	}
+
+	s, stack = c.resolve(s, path, stack)
+	s = maps.Clone(s)
+	for _, key := range metaKeywords {
+		delete(s, key)
+	}
+
+	if props, ok := s["properties"].(map[string]any); ok {
+		converted := make(map[string]any, len(props))
+		for name, prop := range props {
+			converted[name] = c.convert(prop, path+"."+name, stack)
+		}
+		s["properties"] = converted
+	}
+	switch items := s["items"].(type) {
+	case map[string]any:
+		s["items"] = c.convert(items, path+"[]", stack)
+	case []any:
+		// Tuple items (draft 4-7) are offered as an array of the first item's schema
+		c.warn(path, "tuple items are offered as an array of the first item's type")
+		if len(items) > 0 {
+			s["items"] = c.convert(items[0], path+"[]", stack)
+		} else {
+			delete(s, "items")
+		}
+	}
+	if extra, ok := s["additionalProperties"].(map[string]any); ok {
+		s["additionalProperties"] = c.convert(extra, path+"{}", stack)
+	}
+	for _, key := range []string{"anyOf", "oneOf", "allOf"} {
+		if variants, ok := s[key].([]any); ok {
+			converted := make([]any, len(variants))
+			for i, v := range variants {
+				converted[i] = c.convert(v, path, stack)
+			}
+			s[key] = converted
+		}
+	}
+
+	if c.dialect == SchemaDialectGemini {
+		c.simplify(s, path)
+	}
+	return s
+}
+
+// simplify reduces an already converted schema node to the Gemini dialect.
+func (c *schemaConverter) simplify(s map[string]any, path string) {
+	if variants, ok := s["allOf"].([]any); ok {
+		delete(s, "allOf")
+		for _, v := range variants {
+			if variant, ok := v.(map[string]any); ok {
+				mergeSchema(s, variant)
+			}
+		}
+	}
+	for _, key := range []string{"anyOf", "oneOf"} {
+		variants, ok := s[key].([]any)
+		if !ok {
+			continue
+		}
+		delete(s, key)
+
+		var nonNull []map[string]any
+		for _, v := range variants {
+			if variant, ok := v.(map[string]any); ok && variant["type"] != "null" {
+				nonNull = append(nonNull, variant)
+			}
+		}
+		if len(nonNull) > 1 {
+			c.warn(path, "only the first of %d alternatives is offered", len(nonNull))
+		}
+		if len(nonNull) > 0 {
+			mergeSchema(s, nonNull[0])
+		}
+	}
+
+	// Nullable types are offered as their non-null type
+	if types, ok := s["type"].([]any); ok {
+		s["type"] = "string"
+		for _, t := range types {
+			if t != "null" {
+				s["type"] = t
+				break
+			}
+		}
+	}
+	if v, ok := s["const"]; ok {
+		s["enum"] = []any{v}
+	}
+	if _, ok := s["type"]; !ok {
+		switch {
+		case s["properties"] != nil || s["additionalProperties"] != nil:
+			s["type"] = "object"
+		case s["items"] != nil:
+			s["type"] = "array"
+		case s["enum"] != nil:
+			s["type"] = "string"
+		default:
+			c.warn(path, "value without a type is offered as a string")
+			s["type"] = "string"
+		}
+	}
+
+	// The Gemini provider drops everything but the kept keywords, so constraints
+	// the model should respect are moved into the description
+	var notes []string
+	if values, ok := s["enum"].([]any); ok {
+		notes = append(notes, "One of: "+joinValues(values)+".")
+	}
+	if format, ok := s["format"].(string); ok {
+		notes = append(notes, "Format: "+format+".")
+	}
+	if def, ok := s["default"]; ok {
+		notes = append(notes, "Default: "+joinValues([]any{def})+".")
+	}
+	if _, ok := s["additionalProperties"].(map[string]any); ok && s["properties"] == nil {
+		notes = append(notes, "Object with arbitrary keys.")
+		c.warn(path, "map values cannot be declared")
+	}
+	if len(notes) > 0 {
+		desc, _ := s["description"].(string)
+		s["description"] = strings.TrimSpace(desc + " " + strings.Join(notes, " "))
+	}
+
+	// Gemini only accepts enums of strings; other values stay in the description
+	// and are still checked when the call's arguments are validated
+	if values, ok := s["enum"].([]any); ok && (s["type"] != "string" || len(stringList(values)) != len(values)) {
+		delete(s, "enum")
+	}
+
+	var dropped []string
+	for key := range s {
+		if !slices.Contains(geminiKeywords, key) {
+			switch key {
+			case "format", "default", "const", "additionalProperties", "title", "examples":
+			default:
+				dropped = append(dropped, key)
+			}
+			delete(s, key)
+		}
+	}
+	if len(dropped) > 0 {
+		slices.Sort(dropped)
+		c.warn(path, "unsupported keywords dropped: %s", strings.Join(dropped, ", "))
+	}
+}
+
+// mergeSchema merges the keywords of src into dst, which takes precedence except
+// for properties and required fields, which are combined.
+func mergeSchema(dst, src map[string]any) {
+	for k, v := range src {
+		switch k {
+		case "properties":
+			props, _ := dst["properties"].(map[string]any)
+			props = maps.Clone(props)
+			if props == nil {
+				props = make(map[string]any)
+			}
+			srcProps, _ := v.(map[string]any)
+			for name, prop := range srcProps {
+				if _, ok := props[name]; !ok {
+					props[name] = prop
+				}
+			}
+			dst["properties"] = props
+		case "required":
+			required := stringList(dst["required"])
+			for _, name := range stringList(v) {
+				if !slices.Contains(required, name) {
+					required = append(required, name)
+				}
+			}
+			dst["required"] = required
+		default:
+			if _, ok := dst[k]; !ok {
+				dst[k] = v
+			}
+		}
+	}
+}
+
+// stringList returns a JSON array of strings as a slice.
+func stringList(v any) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []any:
+		strs := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		return strs
+	}
+	return nil
+}
+
+func joinValues(values []any) string {
+	strs := make([]string, len(values))
+	for i, v := range values {
+		b, _ := json.Marshal(v)
+		strs[i] = string(b)
+	}
+	return strings.Join(strs, ", ")
+}
@@ -0,0 +1,109 @@
+package mcp
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+const logsSchema = `{
+	"type": "object",
+	"$defs": {
+		"TimeRange": {
+			"type": "object",
+			"description": "Time window to search",
+			"properties": {
+				"start": {"type": "string", "format": "date-time"},
+				"end": {"type": "string", "format": "date-time"}
+			},
+			"required": ["start"]
+		},
+		"Node": {"type": "object", "properties": {"child": {"$ref": "#/$defs/Node"}}}
+	},
+	"properties": {
+		"range": {"$ref": "#/$defs/TimeRange"},
+		"level": {"type": ["string", "null"], "enum": ["info", "error"], "description": "Minimum level"},
+		"limit": {"anyOf": [{"type": "integer", "minimum": 1}, {"type": "null"}]},
+		"tree": {"$ref": "#/$defs/Node"}
+	},
+	"required": ["range"],
+	"additionalProperties": false
+}`
+
+func TestConvertInputSchema(t *testing.T) {
+	props, required, warnings := convertInputSchema(json.RawMessage(logsSchema), SchemaDialectJSON)
+	if !slices.Equal(required, []string{"range"}) {
+		t.Errorf("required = %v", required)
+	}
+	timeRange := props["range"].(map[string]any)
+	if timeRange["description"] != "Time window to search" || timeRange["properties"].(map[string]any)["end"] == nil {
+		t.Errorf("range = %v, want inlined $defs/TimeRange", timeRange)
+	}
+	if _, ok := props["limit"].(map[string]any)["anyOf"]; !ok {
+		t.Errorf("limit = %v, want anyOf kept", props["limit"])
+	}
+	child := props["tree"].(map[string]any)["properties"].(map[string]any)["child"]
+	if !reflect.DeepEqual(child, map[string]any{"type": "object"}) || len(warnings) != 1 || !strings.Contains(warnings[0], "recursive") {
+		t.Errorf("tree.child = %v, warnings = %v", child, warnings)
+	}
+
+	props, _, warnings = convertInputSchema(json.RawMessage(logsSchema), SchemaDialectGemini)
+	level := props["level"].(map[string]any)
+	if level["type"] != "string" || level["description"] != `Minimum level One of: "info", "error".` {
+		t.Errorf("gemini level = %v", level)
+	}
+	limit := props["limit"].(map[string]any)
+	if !reflect.DeepEqual(limit, map[string]any{"type": "integer"}) {
+		t.Errorf("gemini limit = %v", limit)
+	}
+	start := props["range"].(map[string]any)["properties"].(map[string]any)["start"].(map[string]any)
+	if start["description"] != "Format: date-time." || start["format"] != nil {
+		t.Errorf("gemini range.start = %v", start)
+	}
+	if !slices.ContainsFunc(warnings, func(w string) bool { return strings.Contains(w, "limit: unsupported keywords dropped: minimum") }) {
+		t.Errorf("gemini warnings = %v", warnings)
+	}
+}
+
+func TestConvertInputSchemaTypes(t *testing.T) {
+	schema := &jsonschema.Schema{
+		Type:       "object",
+		Properties: map[string]*jsonschema.Schema{"project": {Type: "string", Description: "Project name"}},
+		Required:   []string{"project"},
+	}
+	props, required, _ := convertInputSchema(schema, SchemaDialectJSON)
+	if props["project"].(map[string]any)["description"] != "Project name" || !slices.Equal(required, []string{"project"}) {
+		t.Errorf("*jsonschema.Schema = %v, %v", props, required)
+	}
+
+	root := map[string]any{"oneOf": []any{
+		map[string]any{"type": "object", "properties": map[string]any{"trace_id": map[string]any{"type": "string"}}},
+		map[string]any{"type": "object", "properties": map[string]any{"span_id": map[string]any{"type": "string"}}},
+	}}
+	props, _, warnings := convertInputSchema(root, SchemaDialectJSON)
+	if len(props) != 2 || len(warnings) != 1 {
+		t.Errorf("root oneOf = %v, warnings = %v", props, warnings)
+	}
+}
+
+func TestConvertInputSchemaGeminiNonStringEnums(t *testing.T) {
+	root := map[string]any{"type": "object", "properties": map[string]any{
+		"level":   map[string]any{"type": "string", "enum": []any{"info", "error"}},
+		"verbose": map[string]any{"type": "integer", "enum": []any{1.0, 2.0}},
+		"dry_run": map[string]any{"type": "boolean", "const": true, "description": "Must be set"},
+	}}
+	props, _, _ := convertInputSchema(root, SchemaDialectGemini)
+	if level := props["level"].(map[string]any); !reflect.DeepEqual(level["enum"], []any{"info", "error"}) {
+		t.Errorf("level = %v", level)
+	}
+	if verbose := props["verbose"].(map[string]any); verbose["enum"] != nil || verbose["description"] != "One of: 1, 2." {
+		t.Errorf("verbose = %v", verbose)
+	}
+	if dryRun := props["dry_run"].(map[string]any); dryRun["enum"] != nil || dryRun["description"] != "Must be set One of: true." {
+		t.Errorf("dry_run = %v", dryRun)
+	}
+}
@@ -0,0 +1,113 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	defaultReconnectInitialDelay = time.Second
+	defaultReconnectMaxDelay     = time.Minute
+
+	// supervisorInterval is how often the supervisor checks for servers that are down.
+	supervisorInterval = time.Second
+)
+
+// supervise keeps reconnecting servers that have no session, backing off
+// exponentially per server. Reconnected servers trigger a tool refresh so their
+// tools become available to the agent.
+func (m *Manager) supervise(ctx context.Context) {
+	defer m.wg.Done()
+
+	initial := m.opts.ReconnectInitialDelay
+	if initial <= 0 {
+		initial = defaultReconnectInitialDelay
+	}
+	maxDelay := m.opts.ReconnectMaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultReconnectMaxDelay
+	}
+
+	delays := make(map[string]time.Duration)
+	nextAttempt := make(map[string]time.Time)
+
+	ticker := time.NewTicker(supervisorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, cfg := range m.downServers() {
+			if time.Now().Before(nextAttempt[cfg.Name]) {
+				continue
+			}
+
+			if err := m.connect(ctx, cfg); err != nil {
+				delay := min(max(delays[cfg.Name]*2, initial), maxDelay)
+				delays[cfg.Name] = delay
+				// Up to 20% jitter so that replicas do not reconnect in lockstep
+				nextAttempt[cfg.Name] = time.Now().Add(delay + rand.N(delay/5+1))
+				continue
+			}
+
+			delete(delays, cfg.Name)
+			delete(nextAttempt, cfg.Name)
+			m.refreshTools()
+		}
+
+		for name, b := range m.breakers {
+			if b.probeDue() {
+				m.probe(ctx, name, b)
+			}
+		}
+	}
+}
+
+// probe checks whether a server with an open circuit has recovered by pinging its
+// session. Servers without a session are probed by reconnecting them instead.
+func (m *Manager) probe(ctx context.Context, name string, b *circuitBreaker) {
+	m.mu.RLock()
+	session, ok := m.sessions[name]
+	cfg := m.configs[name]
+	m.mu.RUnlock()
+
+	if !ok || b.allow() != nil {
+		return
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	if err := session.Ping(pingCtx, nil); err != nil {
+		b.failure()
+		m.health.down(cfg, fmt.Errorf("ping failed: %w", err))
+		m.dropSession(name, session)
+		slog.Warn("MCP probe failed", "server", name, "error", err)
+		return
+	}
+
+	b.success()
+	m.health.connected(cfg)
+	slog.Info("MCP circuit closed", "server", name)
+}
+
+// downServers returns the configured servers that have no session.
+func (m *Manager) downServers() []Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var down []Config
+	for name, cfg := range m.configs {
+		if _, ok := m.sessions[name]; !ok {
+			down = append(down, cfg)
+		}
+	}
+	return down
+}
@@ -3,18 +3,31 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
+	"time"
 
 	"charm.land/fantasy"
 	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"rca.agent/test/internal/metrics"
 )
 
 // Tool wraps an MCP tool as a Fantasy AgentTool
 type Tool struct {
 	manager    *Manager
 	serverName string
+	name       string // Name offered to the model
 	tool       *gomcp.Tool
+
+	// Input schema converted for the model, and with only $refs inlined for validation
+	parameters  map[string]any
+	required    []string
+	inputSchema map[string]any
 }
 
 // Name returns the original MCP tool name.
@@ -22,66 +35,148 @@ func (t *Tool) Name() string {
 	return t.tool.Name
 }
 
-func (t *Tool) Info() fantasy.ToolInfo {
-	parameters := make(map[string]any)
-	required := make([]string, 0)
-
-	if input, ok := t.tool.InputSchema.(map[string]any); ok {
-		if props, ok := input["properties"].(map[string]any); ok {
-			parameters = props
-		}
-		if req, ok := input["required"].([]any); ok {
-			for _, v := range req {
-				if s, ok := v.(string); ok {
-					required = append(required, s)
-				}
-			}
-		}
-	}
+// Ref returns the server and original name of the tool.
+func (t *Tool) Ref() ToolRef {
+	return ToolRef{Server: t.serverName, Tool: t.tool.Name}
+}
 
+func (t *Tool) Info() fantasy.ToolInfo {
 	return fantasy.ToolInfo{
-		Name:        fmt.Sprintf("mcp_%s_%s", t.serverName, t.tool.Name),
+		Name:        t.name,
 		Description: t.tool.Description,
-		Parameters:  parameters,
-		Required:    required,
+		Parameters:  t.parameters,
+		Required:    t.required,
+		// MCP tools are read-only queries, so calls within a step run concurrently
+		Parallel: true,
 	}
 }
 
 func (t *Tool) Run(ctx context.Context, params fantasy.ToolCall) (fantasy.ToolResponse, error) {
-	// Get session with auto-reconnect
-	session, err := t.manager.GetSession(ctx, t.serverName)
-	if err != nil {
-		return fantasy.NewTextErrorResponse(err.Error()), nil
-	}
+	ctx, span := tracer.Start(ctx, "mcp.tool_call",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("mcp.server", t.serverName),
+			attribute.String("mcp.tool", t.tool.Name),
+			attribute.String("gen_ai.tool.call.id", params.ID),
+			attribute.Int("mcp.arguments.bytes", len(params.Input)),
+		))
+
+	start := time.Now()
+	response := t.run(ctx, params)
+	observeToolCall(t.Ref(), response, time.Since(start))
+	endToolSpan(span, response)
+	return response, nil
+}
 
+func (t *Tool) run(ctx context.Context, params fantasy.ToolCall) fantasy.ToolResponse {
 	var args map[string]any
 	if err := json.Unmarshal([]byte(params.Input), &args); err != nil {
-		return fantasy.NewTextErrorResponse(fmt.Sprintf("error parsing parameters: %v", err)), nil
+		return t.errorResponse(CodeInvalidArguments, fmt.Sprintf("error parsing parameters: %v", err))
 	}
 
-	result, err := session.CallTool(ctx, &gomcp.CallToolParams{
-		Name:      t.tool.Name,
-		Arguments: args,
-	})
+	// Invalid calls are answered locally, with more precise errors than servers give
+	args, problems := validateArgs(t.inputSchema, args)
+	if len(problems) > 0 {
+		return t.errorResponse(CodeInvalidArguments, fmt.Sprintf("invalid arguments for %s:\n- %s\nFix the arguments and call the tool again.",
+			t.name, strings.Join(problems, "\n- ")))
+	}
+
+	return t.cachedCall(ctx, params.ID, args)
+}
+
+// call calls the tool on its server and converts the result. It also returns the
+// result as the server returned it, or "" if the call failed.
+func (t *Tool) call(ctx context.Context, tracked *trackedCall, args map[string]any) (fantasy.ToolResponse, string) {
+	// Wait for a slot within the server's concurrency limit
+	queued := metrics.QueuedToolCalls.WithLabelValues(t.serverName)
+	queued.Inc()
+	releaseServer, err := t.manager.callSems[t.serverName].acquire(ctx)
+	queued.Dec()
 	if err != nil {
-		return fantasy.NewTextErrorResponse(err.Error()), nil
+		return t.errorResponse(classifyError(err), fmt.Sprintf("waiting for a tool call slot: %v", err)), ""
 	}
+	defer releaseServer()
 
-	if len(result.Content) == 0 {
-		return fantasy.NewTextResponse(""), nil
+	// Get session with auto-reconnect; fails fast while the circuit is open
+	session, err := t.manager.GetSession(ctx, t.serverName)
+	if err != nil {
+		code := classifyError(err)
+		if ctx.Err() != nil {
+			code = CodeCancelled
+		} else if code == CodeToolError || code == CodeInvalidArguments {
+			code = CodeServerUnreachable
+		}
+		return t.errorResponse(code, err.Error()), ""
+	}
+
+	callParams := &gomcp.CallToolParams{
+		// SetProgressToken does not allocate Meta
+		Meta:      gomcp.Meta{},
+		Name:      t.tool.Name,
+		Arguments: args,
+	}
+	token, untrack := t.manager.trackProgress(tracked)
+	defer untrack()
+	callParams.SetProgressToken(token)
+
+	// Bound the call so that one hung query cannot use up the whole analysis; the
+	// timeout is paused while the server waits for a human to answer a question
+	callCtx := ctx
+	timeout := t.manager.callTimeout(t.serverName, t.tool.Name)
+	if timeout > 0 {
+		var cancel context.CancelCauseFunc
+		callCtx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		deadline := startCallDeadline(timeout, func() { cancel(context.DeadlineExceeded) })
+		defer deadline.stop()
+		tracked.setDeadline(deadline)
+		defer tracked.setDeadline(nil)
 	}
 
-	var textParts []string
-	for _, v := range result.Content {
-		switch content := v.(type) {
-		case *gomcp.TextContent:
-			textParts = append(textParts, content.Text)
-		default:
-			textParts = append(textParts, fmt.Sprintf("%v", v))
+	start := time.Now()
+	result, err := session.CallTool(callCtx, callParams)
+	if err != nil && callCtx.Err() == nil && classifyError(err) == CodeServerUnreachable {
+		// The session is dead: reconnect and retry the call once
+		trace.SpanFromContext(ctx).AddEvent("mcp.reconnect")
+		slog.Debug("MCP session lost, retrying call", "server", t.serverName, "tool", t.tool.Name, "error", err)
+		t.manager.dropSession(t.serverName, session)
+		if session, err = t.manager.reconnect(callCtx, t.serverName); err == nil {
+			result, err = session.CallTool(callCtx, callParams)
 		}
 	}
+	if err != nil && ctx.Err() == nil && errors.Is(context.Cause(callCtx), context.DeadlineExceeded) {
+		t.manager.recordCall(t.serverName, time.Since(start), CodeUpstreamTimeout, err)
+		slog.Warn("MCP tool call timed out", "server", t.serverName, "tool", t.tool.Name, "timeout", timeout)
+		return t.errorResponse(CodeUpstreamTimeout, fmt.Sprintf(
+			"%s did not respond within %s. This error is retryable: retry with %s.",
+			t.tool.Name, timeout, refineHint(t.tool.Name))), ""
+	}
+	if err != nil && ctx.Err() != nil {
+		// Nobody waits for the call any more; that says nothing about the server
+		t.manager.recordCall(t.serverName, time.Since(start), CodeCancelled, err)
+		return t.errorResponse(CodeCancelled, err.Error()), ""
+	}
+	if err != nil {
+		code := classifyError(err)
+		t.manager.recordCall(t.serverName, time.Since(start), code, err)
+		return t.errorResponse(code, err.Error()), ""
+	}
+
+	output := convertResult(result, t.manager.opts.MediaResults)
 
-	textContent := strings.Join(textParts, "\n")
+	if result.IsError {
+		// Error text is not transformed, as transformers expect successful payloads,
+		// but it is held to the size limit all the same
+		// The server answered, so whatever the tool reports counts as a reachable server;
+		// the code derived from the text only tells the model what went wrong
+		text := output.withAttachments(output.Body)
+		t.manager.recordCall(t.serverName, time.Since(start), CodeToolError, errors.New(text))
+		return t.errorResponse(classifyToolError(text), t.limitResult(text)), ""
+	}
+	t.manager.recordCall(t.serverName, time.Since(start), "", nil)
+	raw := output.withAttachments(output.Body)
+
+	textContent := output.Body
 
 	// Apply response transformer if one exists for this tool
 	if transformer := GetTransformer(t.tool.Name); transformer != nil {
@@ -93,7 +188,23 @@ func (t *Tool) Run(ctx context.Context, params fantasy.ToolCall) (fantasy.ToolRe
 		}
 	}
 
-	return fantasy.NewTextResponse(textContent), nil
+	textContent = output.withAttachments(textContent)
+
+	// Enforce size limits after transformation
+	textContent = t.limitResult(textContent)
+
+	if output.Image != nil {
+		response := fantasy.NewImageResponse(output.Image, output.ImageType)
+		response.Content = textContent
+		return response, raw
+	}
+
+	return fantasy.NewTextResponse(textContent), raw
+}
+
+// limitResult truncates result text to the tool's size limit.
+func (t *Tool) limitResult(text string) string {
+	return t.manager.limitResult(t.serverName, t.tool.Name, text)
 }
 
 func (t *Tool) ProviderOptions() fantasy.ProviderOptions {
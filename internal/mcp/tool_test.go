@@ -0,0 +1,443 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"rca.agent/test/internal/metrics"
+)
+
+// newTestManager starts an MCP server with the given tools and returns a manager connected to it.
+func newTestManager(t *testing.T, opts ManagerOptions, register func(*gomcp.Server)) *Manager {
+	t.Helper()
+
+	server := gomcp.NewServer(&gomcp.Implementation{Name: "test", Version: "1.0.0"}, nil)
+	register(server)
+	httpServer := httptest.NewServer(gomcp.NewStreamableHTTPHandler(func(*http.Request) *gomcp.Server { return server }, nil))
+	t.Cleanup(httpServer.Close)
+
+	m := NewManager(opts)
+	m.Initialize(context.Background(), []Config{{Name: "test", URL: httpServer.URL}})
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func testTool(t *testing.T, m *Manager, name string) *Tool {
+	t.Helper()
+	for _, tool := range m.GetAllTools(context.Background()) {
+		if tool.Name() == name {
+			return tool
+		}
+	}
+	t.Fatalf("tool %s not found", name)
+	return nil
+}
+
+func TestToolRunProgressAndTimeout(t *testing.T) {
+	schema := map[string]any{"type": "object"}
+	m := newTestManager(t, ManagerOptions{
+		CallTimeout:  5 * time.Second,
+		ToolTimeouts: map[string]time.Duration{"get_project_logs": 200 * time.Millisecond},
+	}, func(s *gomcp.Server) {
+		s.AddTool(&gomcp.Tool{Name: "list_projects", InputSchema: schema}, func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			req.Session.NotifyProgress(ctx, &gomcp.ProgressNotificationParams{
+				ProgressToken: req.Params.GetProgressToken(),
+				Progress:      1,
+				Total:         2,
+				Message:       "listing",
+			})
+			// Notifications are dispatched asynchronously; give it time to arrive before the result
+			time.Sleep(50 * time.Millisecond)
+			return &gomcp.CallToolResult{Content: []gomcp.Content{&gomcp.TextContent{Text: "payments"}}}, nil
+		})
+		s.AddTool(&gomcp.Tool{Name: "get_project_logs", InputSchema: schema}, func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+	})
+
+	var mu sync.Mutex
+	var progress []Progress
+	ctx := WithProgressFunc(context.Background(), func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		progress = append(progress, p)
+	})
+
+	resp, err := testTool(t, m, "list_projects").Run(ctx, fantasy.ToolCall{ID: "call-1", Input: "{}"})
+	if err != nil || resp.IsError || resp.Content != "payments" {
+		t.Fatalf("list_projects = %+v, %v", resp, err)
+	}
+	mu.Lock()
+	if len(progress) != 1 || progress[0].ToolCallID != "call-1" || progress[0].Message != "listing" {
+		t.Errorf("progress = %+v", progress)
+	}
+	mu.Unlock()
+
+	start := time.Now()
+	resp, _ = testTool(t, m, "get_project_logs").Run(ctx, fantasy.ToolCall{ID: "call-2", Input: "{}"})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timed out call took %s", elapsed)
+	}
+	if !resp.IsError || !strings.HasPrefix(resp.Content, "[upstream_timeout]") || !strings.Contains(resp.Content, "retryable") {
+		t.Errorf("timeout response = %q", resp.Content)
+	}
+}
+
+func TestToolRunCache(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	handler := func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+		mu.Lock()
+		calls[req.Params.Name]++
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		return &gomcp.CallToolResult{Content: []gomcp.Content{&gomcp.TextContent{Text: "ok"}}}, nil
+	}
+
+	schema := map[string]any{"type": "object"}
+	m := newTestManager(t, ManagerOptions{
+		CacheTTLs: map[string]time.Duration{"list_projects": time.Minute},
+	}, func(s *gomcp.Server) {
+		s.AddTool(&gomcp.Tool{Name: "list_projects", InputSchema: schema}, handler)
+		s.AddTool(&gomcp.Tool{Name: "get_project_logs", InputSchema: schema}, handler)
+	})
+
+	cacheStatus := func(resp fantasy.ToolResponse) CacheStatus {
+		var meta ResultMetadata
+		json.Unmarshal([]byte(resp.Metadata), &meta)
+		return meta.Cache
+	}
+
+	// Cached across analyses, with argument order not mattering
+	list := testTool(t, m, "list_projects")
+	if resp, _ := list.Run(context.Background(), fantasy.ToolCall{Input: `{"org": "acme", "env": "prod"}`}); cacheStatus(resp) != CacheMiss {
+		t.Errorf("first call cache = %q", cacheStatus(resp))
+	}
+	if resp, _ := list.Run(context.Background(), fantasy.ToolCall{Input: `{"env": "prod", "org": "acme"}`}); cacheStatus(resp) != CacheHit {
+		t.Errorf("second call cache = %q", cacheStatus(resp))
+	}
+
+	// Not cached across analyses, but deduplicated within one and while in flight
+	logs := testTool(t, m, "get_project_logs")
+	logs.Run(context.Background(), fantasy.ToolCall{Input: `{}`})
+	ctx := WithRequestCache(context.Background())
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Go(func() { logs.Run(ctx, fantasy.ToolCall{Input: `{}`}) })
+	}
+	wg.Wait()
+	if resp, _ := logs.Run(ctx, fantasy.ToolCall{Input: `{}`}); cacheStatus(resp) != CacheHit {
+		t.Errorf("repeated call in analysis cache = %q", cacheStatus(resp))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls["list_projects"] != 1 || calls["get_project_logs"] != 2 {
+		t.Errorf("calls = %v, want list_projects 1, get_project_logs 2", calls)
+	}
+}
+
+func TestToolRunSharedCall(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	schema := map[string]any{"type": "object"}
+	m := newTestManager(t, ManagerOptions{}, func(s *gomcp.Server) {
+		s.AddTool(&gomcp.Tool{Name: "get_project_logs", InputSchema: schema}, func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			close(started)
+			<-release
+			req.Session.NotifyProgress(ctx, &gomcp.ProgressNotificationParams{
+				ProgressToken: req.Params.GetProgressToken(),
+				Progress:      1,
+			})
+			time.Sleep(50 * time.Millisecond)
+			return &gomcp.CallToolResult{Content: []gomcp.Content{&gomcp.TextContent{Text: "logs"}}}, nil
+		})
+	})
+	logs := testTool(t, m, "get_project_logs")
+
+	// Each analysis records its own progress and raw results
+	var mu sync.Mutex
+	progress := make(map[string][]string)
+	raw := make(map[string][]string)
+	analysisContext := func(ctx context.Context, name string) context.Context {
+		ctx = WithProgressFunc(ctx, func(p Progress) {
+			mu.Lock()
+			defer mu.Unlock()
+			progress[name] = append(progress[name], p.ToolCallID)
+		})
+		return WithRawResultFunc(ctx, func(toolCallID, result string) {
+			mu.Lock()
+			defer mu.Unlock()
+			raw[name] = append(raw[name], toolCallID+"="+result)
+		})
+	}
+
+	// The first analysis starts the call and is cancelled while the second waits for it
+	firstCtx, cancelFirst := context.WithCancel(analysisContext(context.Background(), "first"))
+	first := make(chan fantasy.ToolResponse)
+	go func() {
+		resp, _ := logs.Run(firstCtx, fantasy.ToolCall{ID: "call-1", Input: `{}`})
+		first <- resp
+	}()
+	<-started
+
+	second := make(chan fantasy.ToolResponse)
+	go func() {
+		resp, _ := logs.Run(analysisContext(context.Background(), "second"), fantasy.ToolCall{ID: "call-2", Input: `{}`})
+		second <- resp
+	}()
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		m.cache.mu.Lock()
+		call := m.cache.calls[logs.cacheKey(map[string]any{})]
+		m.cache.mu.Unlock()
+		if call != nil && len(call.currentWaiters()) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("second call did not join the first")
+		}
+	}
+
+	cancelFirst()
+	if resp := <-first; !resp.IsError {
+		t.Errorf("cancelled call = %+v, want error", resp)
+	}
+	close(release)
+	if resp := <-second; resp.IsError || resp.Content != "logs" {
+		t.Errorf("shared call = %+v", resp)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(progress["first"]) != 0 || len(raw["first"]) != 0 {
+		t.Errorf("cancelled analysis got progress %v and raw results %v", progress["first"], raw["first"])
+	}
+	if len(progress["second"]) != 1 || progress["second"][0] != "call-2" {
+		t.Errorf("second analysis progress = %v", progress["second"])
+	}
+	if len(raw["second"]) != 1 || raw["second"][0] != "call-2=logs" {
+		t.Errorf("second analysis raw results = %v", raw["second"])
+	}
+}
+
+func TestToolRunSharedCallCancelledWithoutWaiters(t *testing.T) {
+	started, cancelled := make(chan struct{}, 2), make(chan struct{}, 2)
+	schema := map[string]any{"type": "object"}
+	m := newTestManager(t, ManagerOptions{}, func(s *gomcp.Server) {
+		s.AddTool(&gomcp.Tool{Name: "get_project_logs", InputSchema: schema}, func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			started <- struct{}{}
+			select {
+			case <-ctx.Done():
+				cancelled <- struct{}{}
+			case <-time.After(5 * time.Second):
+			}
+			return &gomcp.CallToolResult{Content: []gomcp.Content{&gomcp.TextContent{Text: "logs"}}}, nil
+		})
+	})
+	logs := testTool(t, m, "get_project_logs")
+
+	// Once its only analysis is cancelled, the call is cancelled and a later identical
+	// call starts afresh
+	for i := range 2 {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan fantasy.ToolResponse)
+		go func() {
+			resp, _ := logs.Run(ctx, fantasy.ToolCall{Input: `{}`})
+			done <- resp
+		}()
+		select {
+		case <-started:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("call %d did not start", i+1)
+		}
+		cancel()
+		if resp := <-done; !resp.IsError {
+			t.Errorf("cancelled call %d = %+v, want error", i+1, resp)
+		}
+		select {
+		case <-cancelled:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("call %d kept running without waiters", i+1)
+		}
+	}
+}
+
+func TestToolRunSharedCallOutlivesStarterDeadline(t *testing.T) {
+	started := make(chan struct{})
+	schema := map[string]any{"type": "object"}
+	m := newTestManager(t, ManagerOptions{CallTimeout: 5 * time.Second}, func(s *gomcp.Server) {
+		s.AddTool(&gomcp.Tool{Name: "get_project_logs", InputSchema: schema}, func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			close(started)
+			time.Sleep(300 * time.Millisecond)
+			return &gomcp.CallToolResult{Content: []gomcp.Content{&gomcp.TextContent{Text: "logs"}}}, nil
+		})
+	})
+	logs := testTool(t, m, "get_project_logs")
+
+	// The first analysis runs out of time while the second, with time left, waits
+	firstCtx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	first := make(chan fantasy.ToolResponse)
+	go func() {
+		resp, _ := logs.Run(firstCtx, fantasy.ToolCall{ID: "call-1", Input: `{}`})
+		first <- resp
+	}()
+	<-started
+	second, _ := logs.Run(context.Background(), fantasy.ToolCall{ID: "call-2", Input: `{}`})
+
+	if resp := <-first; !strings.HasPrefix(resp.Content, "[upstream_timeout]") {
+		t.Errorf("first analysis = %q", resp.Content)
+	}
+	if second.IsError || second.Content != "logs" {
+		t.Errorf("second analysis = %+v", second)
+	}
+}
+
+func TestToolRunCancelledCallsSpareServer(t *testing.T) {
+	started := make(chan struct{}, 3)
+	schema := map[string]any{"type": "object"}
+	m := newTestManager(t, ManagerOptions{BreakerThreshold: 2}, func(s *gomcp.Server) {
+		s.AddTool(&gomcp.Tool{Name: "get_project_logs", InputSchema: schema}, func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			started <- struct{}{}
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+			return &gomcp.CallToolResult{Content: []gomcp.Content{&gomcp.TextContent{Text: "logs"}}}, nil
+		})
+		s.AddTool(&gomcp.Tool{Name: "list_projects", InputSchema: schema}, func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			return &gomcp.CallToolResult{Content: []gomcp.Content{&gomcp.TextContent{Text: "payments"}}}, nil
+		})
+	})
+	logs := testTool(t, m, "get_project_logs")
+
+	for i := range 3 {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+		resp, _ := logs.Run(ctx, fantasy.ToolCall{Input: fmt.Sprintf(`{"attempt": %d}`, i)})
+		if !resp.IsError || !strings.HasPrefix(resp.Content, "[cancelled]") {
+			t.Errorf("cancelled call %d = %q", i+1, resp.Content)
+		}
+	}
+
+	if health := m.Health(); health[0].State != StateConnected || health[0].Circuit != CircuitClosed {
+		t.Errorf("health after cancelled calls = %+v", health[0])
+	}
+	if resp, _ := testTool(t, m, "list_projects").Run(context.Background(), fantasy.ToolCall{Input: `{}`}); resp.IsError {
+		t.Errorf("list_projects = %q", resp.Content)
+	}
+}
+
+func TestToolRunToolErrorsSpareServer(t *testing.T) {
+	schema := map[string]any{"type": "object"}
+	m := newTestManager(t, ManagerOptions{BreakerThreshold: 2}, func(s *gomcp.Server) {
+		s.AddTool(&gomcp.Tool{Name: "query_logs", InputSchema: schema}, func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			return &gomcp.CallToolResult{IsError: true, Content: []gomcp.Content{&gomcp.TextContent{Text: "query timeout"}}}, nil
+		})
+	})
+	query := testTool(t, m, "query_logs")
+
+	for i := range 3 {
+		resp, _ := query.Run(context.Background(), fantasy.ToolCall{Input: fmt.Sprintf(`{"attempt": %d}`, i)})
+		if !strings.HasPrefix(resp.Content, "[upstream_timeout] query timeout") {
+			t.Errorf("call %d = %q", i+1, resp.Content)
+		}
+	}
+	if health := m.Health(); health[0].State != StateConnected || health[0].Circuit != CircuitClosed {
+		t.Errorf("health after tool errors = %+v", health[0])
+	}
+}
+
+func TestToolRunTracing(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	var traceparent string
+	m := newTestManager(t, ManagerOptions{}, func(s *gomcp.Server) {
+		s.AddTool(&gomcp.Tool{Name: "get_traces", InputSchema: map[string]any{"type": "object"}}, func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			traceparent = req.Extra.Header.Get("Traceparent")
+			return &gomcp.CallToolResult{Content: []gomcp.Content{&gomcp.TextContent{Text: "[]"}}}, nil
+		})
+	})
+
+	testTool(t, m, "get_traces").Run(context.Background(), fantasy.ToolCall{ID: "call-1", Input: `{}`})
+
+	ended := spans.Ended()
+	if len(ended) != 1 || ended[0].Name() != "mcp.tool_call" {
+		t.Fatalf("spans = %v", ended)
+	}
+	attrs := attribute.NewSet(ended[0].Attributes()...)
+	if v, _ := attrs.Value("mcp.tool"); v.AsString() != "get_traces" {
+		t.Errorf("mcp.tool = %v", v)
+	}
+	if v, _ := attrs.Value("mcp.cache"); v.AsString() != string(CacheMiss) {
+		t.Errorf("mcp.cache = %v", v)
+	}
+	if !strings.Contains(traceparent, ended[0].SpanContext().TraceID().String()) {
+		t.Errorf("traceparent = %q, want trace %s", traceparent, ended[0].SpanContext().TraceID())
+	}
+}
+
+func TestToolRunMetrics(t *testing.T) {
+	m := newTestManager(t, ManagerOptions{}, func(s *gomcp.Server) {
+		s.AddTool(&gomcp.Tool{Name: "get_metrics", InputSchema: map[string]any{"type": "object"}}, func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			return &gomcp.CallToolResult{Content: []gomcp.Content{&gomcp.TextContent{Text: "[]"}}}, nil
+		})
+	})
+	tool := testTool(t, m, "get_metrics")
+
+	tool.Run(context.Background(), fantasy.ToolCall{ID: "call-1", Input: `{}`})
+	tool.Run(context.Background(), fantasy.ToolCall{ID: "call-2", Input: `"not an object"`})
+
+	if n := testutil.ToFloat64(metrics.ToolCalls.WithLabelValues("test", "get_metrics", "ok")); n != 1 {
+		t.Errorf("ok calls = %v, want 1", n)
+	}
+	if n := testutil.ToFloat64(metrics.ToolCalls.WithLabelValues("test", "get_metrics", string(CodeInvalidArguments))); n != 1 {
+		t.Errorf("invalid_arguments calls = %v, want 1", n)
+	}
+	if n := testutil.ToFloat64(metrics.ServerState.WithLabelValues("test", string(StateConnected))); n != 1 {
+		t.Errorf("connected state = %v, want 1", n)
+	}
+}
+
+func TestToolRunLimitsErrorText(t *testing.T) {
+	m := newTestManager(t, ManagerOptions{ToolResultLimits: map[string]ResultLimit{"get_logs": {MaxBytes: 1000}}}, func(s *gomcp.Server) {
+		s.AddTool(&gomcp.Tool{Name: "get_logs", InputSchema: map[string]any{"type": "object"}}, func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+			trace := strings.Repeat("at payments.handler(handler.go:42)\n", 1000)
+			return &gomcp.CallToolResult{IsError: true, Content: []gomcp.Content{&gomcp.TextContent{Text: "panic: out of memory\n" + trace}}}, nil
+		})
+	})
+
+	resp, err := testTool(t, m, "get_logs").Run(context.Background(), fantasy.ToolCall{ID: "call-1", Input: `{}`})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !resp.IsError || !strings.Contains(resp.Content, "panic: out of memory") {
+		t.Errorf("response = %.200q, want the start of the error", resp.Content)
+	}
+	if len(resp.Content) > 1200 {
+		t.Errorf("error text is %d bytes, want it held to the limit of 1000", len(resp.Content))
+	}
+}
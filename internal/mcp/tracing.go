@@ -0,0 +1,30 @@
+package mcp
+
+import (
+	"charm.land/fantasy"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("rca.agent/test/internal/mcp")
+
+// endToolSpan records the outcome of a tool call on its span and ends it.
+func endToolSpan(span trace.Span, response fantasy.ToolResponse) {
+	defer span.End()
+
+	code, cache := responseMetadata(response)
+	span.SetAttributes(attribute.Int("mcp.result.bytes", len(response.Content)+len(response.Data)))
+	if cache != "" {
+		span.SetAttributes(attribute.String("mcp.cache", string(cache)))
+	}
+	if response.IsError {
+		span.SetAttributes(attribute.String("error.type", string(code)))
+		message := response.Content
+		if len(message) > 200 {
+			message = message[:200] + "..."
+		}
+		span.SetStatus(codes.Error, message)
+	}
+}
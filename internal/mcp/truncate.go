@@ -0,0 +1,257 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// bytesPerToken is the rough ratio used to convert token limits into byte limits.
+const bytesPerToken = 4
+
+// ResultLimit caps the size of a tool result. Zero values mean no limit.
+type ResultLimit struct {
+	MaxBytes  int
+	MaxTokens int
+}
+
+// bytes returns the effective limit in bytes, or 0 if unlimited.
+func (l ResultLimit) bytes() int {
+	tokenBytes := l.MaxTokens * bytesPerToken
+	switch {
+	case l.MaxBytes <= 0:
+		return tokenBytes
+	case tokenBytes <= 0:
+		return l.MaxBytes
+	default:
+		return min(l.MaxBytes, tokenBytes)
+	}
+}
+
+// refineHints suggests how the model can narrow a query for tools whose results get truncated.
+var refineHints = map[string]string{
+	"get_component_logs":             "a narrower time range, a log level filter or a search phrase",
+	"get_project_logs":               "a narrower time range, specific components, a log level filter or a search phrase",
+	"get_traces":                     "a narrower time range or a lower limit",
+	"get_component_resource_metrics": "a narrower time range",
+	ReadResourceToolName:             "a server, or a more specific resource",
+}
+
+const defaultRefineHint = "more specific filters or a narrower time range"
+
+// refineHint returns how the model can narrow a query to the given tool.
+func refineHint(toolName string) string {
+	if hint, ok := refineHints[toolName]; ok {
+		return hint
+	}
+	return defaultRefineHint
+}
+
+// truncateResult shrinks text to at most maxBytes, notice included. JSON is
+// truncated structurally by cutting its largest array in the original bytes, so
+// numbers, key order and escaping are left as the server sent them; other text
+// keeps head and tail lines, or is cut by bytes when no whole line fits. A notice
+// telling the model how much was dropped and how to refine the query is appended.
+// If even the notice does not fit, text is cut plainly.
+func truncateResult(toolName, text string, maxBytes int) string {
+	if maxBytes <= 0 || len(text) <= maxBytes {
+		return text
+	}
+
+	hint := refineHint(toolName)
+	notice := func(kept, total int, unit string) string {
+		return fmt.Sprintf("\n\n[truncated: %d of %d %s shown, refine your query with %s]", kept, total, unit, hint)
+	}
+
+	if span, ok := largestArray(text); ok {
+		total := len(span.items)
+		// kept never has more digits than total, so this bounds the real notice
+		if budget := maxBytes - len(notice(total, total, "items")); budget > 0 {
+			if truncated, kept, ok := truncateJSON(text, span, budget); ok {
+				return truncated + notice(kept, total, "items")
+			}
+		}
+	}
+
+	total := strings.Count(text, "\n") + 1
+	if budget := maxBytes - len(notice(total, total, "lines")); budget > 0 {
+		if truncated, kept, ok := truncateLines(text, budget); ok {
+			return truncated + notice(kept, total, "lines")
+		}
+	}
+	if budget := maxBytes - len(notice(len(text), len(text), "bytes")); budget > 0 {
+		truncated := cutBytes(text, budget)
+		return truncated + notice(len(truncated), len(text), "bytes")
+	}
+	return cutBytes(text, maxBytes)
+}
+
+// arraySpan locates a JSON array in a document: the offsets of its opening
+// bracket and just past its closing bracket, and the offsets of each item.
+type arraySpan struct {
+	start, end int
+	items      [][2]int
+}
+
+// truncateJSON cuts span in text to the most items that fit within budget,
+// keeping about two thirds of them from the head and the rest from the tail,
+// separated by a marker for the omitted items. It reports the number of items kept.
+func truncateJSON(text string, span arraySpan, budget int) (string, int, bool) {
+	render := func(keep int) string {
+		n := len(span.items)
+		tail := keep / 3
+		head := keep - tail
+
+		var parts []string
+		if head > 0 {
+			parts = append(parts, text[span.items[0][0]:span.items[head-1][1]])
+		}
+		parts = append(parts, fmt.Sprintf("%q", fmt.Sprintf("... %d items omitted ...", n-keep)))
+		if tail > 0 {
+			parts = append(parts, text[span.items[n-tail][0]:span.items[n-1][1]])
+		}
+		return text[:span.start+1] + strings.Join(parts, ",") + text[span.end-1:]
+	}
+
+	// Binary search for the largest number of items that fits
+	lo, hi := 0, len(span.items)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if len(render(mid)) <= budget {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	out := render(lo)
+	if len(out) > budget {
+		// Something other than the array is too large on its own
+		return "", 0, false
+	}
+	return out, lo, true
+}
+
+// largestArray finds the array with the most items in a JSON document: the
+// document itself, or an array among an object's fields or one level further
+// down (e.g. {"data": {"logs": [...]}}). It reports false for invalid JSON or
+// when there is no non-empty array.
+func largestArray(text string) (arraySpan, bool) {
+	if !json.Valid([]byte(text)) {
+		return arraySpan{}, false
+	}
+
+	var spans []arraySpan
+	dec := json.NewDecoder(strings.NewReader(text))
+	if err := scanArrays(dec, 0, &spans); err != nil {
+		return arraySpan{}, false
+	}
+
+	var best arraySpan
+	for _, span := range spans {
+		if len(span.items) > len(best.items) {
+			best = span
+		}
+	}
+	return best, len(best.items) > 0
+}
+
+// scanArrays reads the next value from dec, recording the spans of arrays found
+// at depth 0 to 2. Array items and deeper objects are skipped without scanning.
+func scanArrays(dec *json.Decoder, depth int, spans *[]arraySpan) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case json.Delim('['):
+		span := arraySpan{start: int(dec.InputOffset()) - 1}
+		for dec.More() {
+			var item json.RawMessage
+			if err := dec.Decode(&item); err != nil {
+				return err
+			}
+			end := int(dec.InputOffset())
+			span.items = append(span.items, [2]int{end - len(item), end})
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		span.end = int(dec.InputOffset())
+		*spans = append(*spans, span)
+
+	case json.Delim('{'):
+		for dec.More() {
+			if _, err := dec.Token(); err != nil {
+				return err
+			}
+			if depth < 2 {
+				err = scanArrays(dec, depth+1, spans)
+			} else {
+				var skip json.RawMessage
+				err = dec.Decode(&skip)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cutBytes cuts text to at most n bytes without splitting a UTF-8 sequence.
+func cutBytes(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n]
+}
+
+// truncateLines keeps the head and tail lines of text within budget bytes. It
+// reports the number of lines kept, and false if not even one line fits.
+func truncateLines(text string, budget int) (string, int, bool) {
+	lines := strings.Split(text, "\n")
+	total := len(lines)
+
+	// Leave room for the omission marker line
+	marker := func(omitted int) string { return fmt.Sprintf("... %d lines omitted ...", omitted) }
+	budget -= len(marker(total)) + 1
+	if budget <= 0 {
+		return "", 0, false
+	}
+
+	headBudget := budget * 2 / 3
+	var head []string
+	used := 0
+	for _, line := range lines {
+		if used+len(line)+1 > headBudget {
+			break
+		}
+		head = append(head, line)
+		used += len(line) + 1
+	}
+
+	var tail []string
+	for i := len(lines) - 1; i >= len(head); i-- {
+		if used+len(lines[i])+1 > budget {
+			break
+		}
+		tail = append([]string{lines[i]}, tail...)
+		used += len(lines[i]) + 1
+	}
+
+	if len(head) == 0 && len(tail) == 0 {
+		return "", 0, false
+	}
+
+	kept := len(head) + len(tail)
+	return strings.Join(append(append(head, marker(total-kept)), tail...), "\n"), kept, true
+}
@@ -0,0 +1,145 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateResultJSONArray(t *testing.T) {
+	items := make([]map[string]any, 1000)
+	for i := range items {
+		items[i] = map[string]any{"line": i, "message": strings.Repeat("x", 80)}
+	}
+	b, _ := json.Marshal(map[string]any{"total": 1000, "logs": items})
+
+	got := truncateResult("get_component_logs", string(b), 10000)
+	if len(got) > 10000 {
+		t.Errorf("len = %d, want <= 10000", len(got))
+	}
+
+	body, notice, ok := strings.Cut(got, "\n\n[truncated: ")
+	if !ok {
+		t.Fatalf("missing truncation notice: %q", got[len(got)-200:])
+	}
+	if !strings.Contains(notice, "of 1000 items shown") || !strings.Contains(notice, "narrower time range") {
+		t.Errorf("notice = %q", notice)
+	}
+
+	var out struct {
+		Total int   `json:"total"`
+		Logs  []any `json:"logs"`
+	}
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		t.Fatalf("truncated body is not valid JSON: %v", err)
+	}
+	if out.Total != 1000 {
+		t.Errorf("total = %d, want 1000 (non-array fields preserved)", out.Total)
+	}
+	first := out.Logs[0].(map[string]any)
+	last := out.Logs[len(out.Logs)-1].(map[string]any)
+	if first["line"] != float64(0) || last["line"] != float64(999) {
+		t.Errorf("head/tail not kept: first=%v last=%v", first["line"], last["line"])
+	}
+}
+
+func TestTruncateResultText(t *testing.T) {
+	var sb strings.Builder
+	for i := range 500 {
+		fmt.Fprintf(&sb, "| %d | ERROR | something failed |\n", i)
+	}
+
+	got := truncateResult("unknown_tool", sb.String(), 2000)
+	if len(got) > 2000 {
+		t.Errorf("len = %d, want <= 2000", len(got))
+	}
+	if !strings.HasPrefix(got, "| 0 |") || !strings.Contains(got, "| 499 |") {
+		t.Error("head/tail lines not kept")
+	}
+	if !strings.Contains(got, "lines omitted") || !strings.Contains(got, "of 501 lines shown") {
+		t.Errorf("missing omission notice: %q", got[len(got)-200:])
+	}
+}
+
+func TestTruncateResultSingleLongLine(t *testing.T) {
+	text := strings.Repeat("x", 5000)
+	got := truncateResult("unknown_tool", text, 1000)
+	if len(got) > 1000 {
+		t.Errorf("len = %d, want <= 1000", len(got))
+	}
+	body, notice, _ := strings.Cut(got, "\n\n[truncated: ")
+	if !strings.HasPrefix(notice, fmt.Sprintf("%d of 5000 bytes shown", len(body))) {
+		t.Errorf("notice = %q for %d bytes shown", notice, len(body))
+	}
+}
+
+func TestTruncateResultKeepsOriginalBytes(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString(`{"zeta": 9007199254740993, "items": [`)
+	for i := range 200 {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, `{"id": %d, "msg": "a < b && c > d"}`, 9007199254740993+i)
+	}
+	sb.WriteString(`], "alpha": "<tag>"}`)
+
+	got := truncateResult("get_traces", sb.String(), 2000)
+	if len(got) > 2000 {
+		t.Errorf("len = %d, want <= 2000", len(got))
+	}
+	body, _, ok := strings.Cut(got, "\n\n[truncated: ")
+	if !ok {
+		t.Fatalf("missing truncation notice: %q", got)
+	}
+	if !json.Valid([]byte(body)) {
+		t.Fatalf("truncated body is not valid JSON: %q", body)
+	}
+	for _, want := range []string{`{"zeta": 9007199254740993, "items": [`, `"a < b && c > d"`, `9007199254741192`, `], "alpha": "<tag>"}`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body missing %q", want)
+		}
+	}
+}
+
+func TestTruncateResultSmallLimit(t *testing.T) {
+	b, _ := json.Marshal(map[string]any{"logs": make([]int, 500)})
+	text := string(b) + "\n" + strings.Repeat("line\n", 100)
+
+	for _, limit := range []int{1, 50, 150, 300} {
+		for _, in := range []string{string(b), text, strings.Repeat("é", 500)} {
+			got := truncateResult("get_component_logs", in, limit)
+			if len(got) > limit {
+				t.Errorf("limit %d: len = %d", limit, len(got))
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("limit %d: invalid UTF-8 %q", limit, got)
+			}
+		}
+	}
+}
+
+func TestTruncateResultUnderLimit(t *testing.T) {
+	if got := truncateResult("get_traces", "[1,2,3]", 100); got != "[1,2,3]" {
+		t.Errorf("truncateResult() = %q, want unchanged", got)
+	}
+}
+
+func TestResultLimitBytes(t *testing.T) {
+	tests := []struct {
+		limit ResultLimit
+		want  int
+	}{
+		{ResultLimit{}, 0},
+		{ResultLimit{MaxBytes: 1000}, 1000},
+		{ResultLimit{MaxTokens: 100}, 400},
+		{ResultLimit{MaxBytes: 1000, MaxTokens: 100}, 400},
+	}
+	for _, tt := range tests {
+		if got := tt.limit.bytes(); got != tt.want {
+			t.Errorf("%+v.bytes() = %d, want %d", tt.limit, got, tt.want)
+		}
+	}
+}
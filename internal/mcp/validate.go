@@ -0,0 +1,290 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Formats checked locally; others are left to the server.
+var formatLayouts = map[string]string{
+	"date-time": time.RFC3339,
+	"date":      time.DateOnly,
+}
+
+// validateArgs checks tool-call arguments against a tool's input schema (with $refs
+// inlined) before they are sent. Safe coercions, such as "10" to 10 for an integer,
+// are applied and returned; problems are returned as one message per argument.
+func validateArgs(schema, args map[string]any) (map[string]any, []string) {
+	if args == nil {
+		args = make(map[string]any)
+	}
+	v := &argValidator{}
+	coerced := v.validate(schema, args, "")
+	obj, _ := coerced.(map[string]any)
+	return obj, v.problems
+}
+
+// rootAdditionalProperties returns false if an input schema forbids arguments it does
+// not declare, and nil otherwise.
+func rootAdditionalProperties(input any) any {
+	if root, err := normalizeSchema(input); err == nil && root["additionalProperties"] == false {
+		return false
+	}
+	return nil
+}
+
+type argValidator struct {
+	problems []string
+}
+
+func (v *argValidator) fail(path, format string, args ...any) {
+	if path == "" {
+		path = "arguments"
+	}
+	v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+}
+
+// validate checks a value against a schema node and returns it, coerced if needed.
+func (v *argValidator) validate(schema map[string]any, value any, path string) any {
+	for _, key := range []string{"anyOf", "oneOf"} {
+		if variants, ok := schema[key].([]any); ok && len(variants) > 0 {
+			value = v.validateVariants(variants, value, path)
+		}
+	}
+	if variants, ok := schema["allOf"].([]any); ok {
+		for _, variant := range variants {
+			if s, ok := variant.(map[string]any); ok {
+				value = v.validate(s, value, path)
+			}
+		}
+	}
+
+	if types := schemaTypes(schema); len(types) > 0 {
+		var ok bool
+		if value, ok = coerce(value, types); !ok {
+			v.fail(path, "expected %s, got %s", strings.Join(types, " or "), jsonType(value))
+			return value
+		}
+	}
+
+	if allowed, ok := schema["enum"].([]any); ok && !slices.ContainsFunc(allowed, func(a any) bool { return jsonEqual(a, value) }) {
+		v.fail(path, "must be one of %s, got %s", joinValues(allowed), joinValues([]any{value}))
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, value) {
+		v.fail(path, "must be %s", joinValues([]any{c}))
+	}
+
+	switch val := value.(type) {
+	case map[string]any:
+		return v.validateObject(schema, val, path)
+	case []any:
+		return v.validateArray(schema, val, path)
+	case string:
+		v.validateString(schema, val, path)
+	case float64:
+		if minimum, ok := schema["minimum"].(float64); ok && val < minimum {
+			v.fail(path, "must be at least %v, got %v", minimum, val)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && val > maximum {
+			v.fail(path, "must be at most %v, got %v", maximum, val)
+		}
+	}
+	return value
+}
+
+// validateVariants accepts a value that matches any of the variants, using the first
+// match's coercions. If none matches, the problems with the first variant are reported.
+func (v *argValidator) validateVariants(variants []any, value any, path string) any {
+	var first []string
+	for i, variant := range variants {
+		s, ok := variant.(map[string]any)
+		if !ok {
+			continue
+		}
+		sub := &argValidator{}
+		coerced := sub.validate(s, value, path)
+		if len(sub.problems) == 0 {
+			return coerced
+		}
+		if i == 0 {
+			first = sub.problems
+		}
+	}
+	v.problems = append(v.problems, first...)
+	return value
+}
+
+func (v *argValidator) validateObject(schema, obj map[string]any, path string) map[string]any {
+	props, _ := schema["properties"].(map[string]any)
+	required := stringList(schema["required"])
+	obj = maps.Clone(obj)
+
+	for _, name := range slices.Sorted(maps.Keys(obj)) {
+		prop, ok := props[name].(map[string]any)
+		switch {
+		// Models often send null for optional arguments they do not want to set
+		case obj[name] == nil && !slices.Contains(required, name) && !allowsNull(prop):
+			delete(obj, name)
+		case ok:
+			obj[name] = v.validate(prop, obj[name], joinPath(path, name))
+		case schema["additionalProperties"] == false:
+			v.fail(joinPath(path, name), "unknown argument; expected one of %s", strings.Join(slices.Sorted(maps.Keys(props)), ", "))
+		default:
+			if extra, ok := schema["additionalProperties"].(map[string]any); ok {
+				obj[name] = v.validate(extra, obj[name], joinPath(path, name))
+			}
+		}
+	}
+	for _, name := range required {
+		if _, ok := obj[name]; !ok {
+			v.fail(joinPath(path, name), "required argument is missing")
+		}
+	}
+	return obj
+}
+
+func (v *argValidator) validateArray(schema map[string]any, arr []any, path string) []any {
+	if minItems, ok := schema["minItems"].(float64); ok && float64(len(arr)) < minItems {
+		v.fail(path, "must have at least %v items, got %d", minItems, len(arr))
+	}
+	if maxItems, ok := schema["maxItems"].(float64); ok && float64(len(arr)) > maxItems {
+		v.fail(path, "must have at most %v items, got %d", maxItems, len(arr))
+	}
+
+	items, ok := schema["items"].(map[string]any)
+	if !ok {
+		return arr
+	}
+	arr = slices.Clone(arr)
+	for i := range arr {
+		arr[i] = v.validate(items, arr[i], fmt.Sprintf("%s[%d]", path, i))
+	}
+	return arr
+}
+
+func (v *argValidator) validateString(schema map[string]any, s, path string) {
+	length := float64(utf8.RuneCountInString(s))
+	if minLength, ok := schema["minLength"].(float64); ok && length < minLength {
+		v.fail(path, "must be at least %v characters", minLength)
+	}
+	if maxLength, ok := schema["maxLength"].(float64); ok && length > maxLength {
+		v.fail(path, "must be at most %v characters", maxLength)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(s) {
+			v.fail(path, "must match %s, got %q", pattern, s)
+		}
+	}
+	if format, ok := schema["format"].(string); ok {
+		if layout, ok := formatLayouts[format]; ok {
+			if _, err := time.Parse(layout, s); err != nil {
+				v.fail(path, "must be a %s like %s, got %q", format, time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC).Format(layout), s)
+			}
+		}
+	}
+}
+
+// coerce converts a value to one of the allowed JSON types where that is lossless,
+// reporting whether the result has an allowed type.
+func coerce(value any, types []string) (any, bool) {
+	if slices.Contains(types, jsonType(value)) || (jsonType(value) == "integer" && slices.Contains(types, "number")) {
+		return value, true
+	}
+
+	for _, typ := range types {
+		switch val := value.(type) {
+		case string:
+			s := strings.TrimSpace(val)
+			switch typ {
+			case "integer":
+				if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+					return float64(n), true
+				}
+			case "number":
+				if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+					return f, true
+				}
+			case "boolean":
+				if s == "true" || s == "false" {
+					return s == "true", true
+				}
+			}
+		case float64:
+			if typ == "string" {
+				return strconv.FormatFloat(val, 'f', -1, 64), true
+			}
+		case bool:
+			if typ == "string" {
+				return strconv.FormatBool(val), true
+			}
+		}
+		if typ == "array" && value != nil {
+			if _, isArray := value.([]any); !isArray {
+				return []any{value}, true
+			}
+		}
+	}
+	return value, false
+}
+
+// schemaTypes returns the types a schema node allows.
+func schemaTypes(schema map[string]any) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		return stringList(t)
+	}
+	return nil
+}
+
+func allowsNull(schema map[string]any) bool {
+	return slices.Contains(schemaTypes(schema), "null")
+}
+
+// jsonType returns the JSON Schema type of a decoded JSON value.
+func jsonType(value any) string {
+	switch val := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if val == math.Trunc(val) && !math.IsInf(val, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func jsonEqual(a, b any) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,71 @@
+package mcp
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestValidateArgs(t *testing.T) {
+	props, required, _ := convertInputSchema(json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"project": {"type": "string", "maxLength": 6},
+			"limit": {"type": "integer", "minimum": 1},
+			"level": {"type": "string", "enum": ["info", "error"]},
+			"start_time": {"type": "string", "format": "date-time"},
+			"components": {"type": "array", "items": {"type": "string"}},
+			"include_traces": {"type": "boolean"}
+		},
+		"required": ["project", "start_time"]
+	}`), SchemaDialectJSON)
+	schema := map[string]any{"type": "object", "properties": props, "required": required, "additionalProperties": false}
+
+	tests := []struct {
+		name     string
+		args     string
+		want     map[string]any
+		problems []string
+	}{
+		{
+			name: "coerced",
+			args: `{"project": 42, "start_time": "2025-01-02T15:04:05Z", "limit": "10", "components": "api", "include_traces": "true", "level": null}`,
+			want: map[string]any{"project": "42", "start_time": "2025-01-02T15:04:05Z", "limit": float64(10), "components": []any{"api"}, "include_traces": true},
+		},
+		{
+			name: "characters",
+			args: `{"project": "zürich", "start_time": "2025-01-02T15:04:05Z"}`,
+			want: map[string]any{"project": "zürich", "start_time": "2025-01-02T15:04:05Z"},
+		},
+		{
+			name:     "too long",
+			args:     `{"project": "zürichs", "start_time": "2025-01-02T15:04:05Z"}`,
+			problems: []string{"project: must be at most 6 characters"},
+		},
+		{
+			name: "invalid",
+			args: `{"start_time": "yesterday", "limit": 2.5, "level": "debug", "since": "1h"}`,
+			problems: []string{
+				"level: must be one of \"info\", \"error\", got \"debug\"",
+				"limit: expected integer, got number",
+				"since: unknown argument; expected one of components, include_traces, level, limit, project, start_time",
+				"start_time: must be a date-time like 2025-01-02T15:04:05Z, got \"yesterday\"",
+				"project: required argument is missing",
+			},
+		},
+	}
+	for _, tt := range tests {
+		var args map[string]any
+		if err := json.Unmarshal([]byte(tt.args), &args); err != nil {
+			t.Fatal(err)
+		}
+		got, problems := validateArgs(schema, args)
+		if !slices.Equal(problems, tt.problems) {
+			t.Errorf("%s: problems = %q, want %q", tt.name, problems, tt.problems)
+		}
+		if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: args = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
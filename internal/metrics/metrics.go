@@ -0,0 +1,112 @@
+// Package metrics defines the Prometheus metrics of the analysis server.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "rca"
+
+// Registry holds the server's metrics, along with the Go runtime and process metrics.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Analysis metrics.
+var (
+	Analyses = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "analyses_total",
+		Help:      "Analyses run, by outcome: completed, budget_exceeded, timeout, canceled or error.",
+	}, []string{"outcome"})
+
+	AnalysisDuration = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "analysis_duration_seconds",
+		Help:      "Duration of analyses.",
+		Buckets:   []float64{5, 15, 30, 60, 120, 180, 300, 600, 900},
+	})
+
+	AnalysisSteps = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "analysis_steps",
+		Help:      "Agent steps per analysis.",
+		Buckets:   []float64{1, 2, 4, 6, 8, 12, 16, 20, 25, 30},
+	})
+
+	ActiveAnalyses = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "analyses_active",
+		Help:      "Analyses in progress.",
+	})
+
+	MaxConcurrentAnalyses = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "analyses_max_concurrent",
+		Help:      "Configured maximum of concurrent analyses.",
+	})
+
+	ModelTokens = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "model_tokens_total",
+		Help:      "Tokens used by agent steps, by model and type: input, output, reasoning, cache_read or cache_write.",
+	}, []string{"model", "type"})
+
+	ModelCost = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "model_cost_usd_total",
+		Help:      "Estimated cost of agent steps in USD, by model.",
+	}, []string{"model"})
+)
+
+// MCP metrics.
+var (
+	ToolCalls = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mcp_tool_calls_total",
+		Help:      "MCP tool calls, by server, tool and status: ok, cached, or the error code.",
+	}, []string{"server", "tool", "status"})
+
+	ToolCallDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mcp_tool_call_duration_seconds",
+		Help:      "Duration of MCP tool calls, including time spent waiting for a call slot.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"server", "tool"})
+
+	ServerState = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mcp_server_state",
+		Help:      "Connection state of each MCP server: 1 for the current state (connected, degraded or down), 0 otherwise.",
+	}, []string{"server", "state"})
+
+	QueuedToolCalls = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mcp_queued_tool_calls",
+		Help:      "MCP tool calls waiting for a slot within the server's concurrency limit.",
+	}, []string{"server"})
+)
+
+// OAuthRefreshFailures counts failed OAuth token requests.
+var OAuthRefreshFailures = factory.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "oauth_token_refresh_failures_total",
+	Help:      "Failed OAuth token requests.",
+})
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -0,0 +1,92 @@
+// Package reports defines the reports of completed analyses and how they are searched.
+package reports
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Report is the record of a completed analysis.
+type Report struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Caller    string    `json:"caller,omitempty"`
+	Prompt    string    `json:"prompt"`
+	Profile   string    `json:"profile,omitempty"`
+	Models    []string  `json:"models,omitempty"` // Models that served the analysis' steps
+
+	Summary string `json:"summary,omitempty"` // Summary of the structured output, if it has one
+	Output  any    `json:"output,omitempty"`
+	Text    string `json:"text,omitempty"`
+
+	// Entities named in the analysis' tool calls
+	Organizations []string `json:"organizations,omitempty"`
+	Projects      []string `json:"projects,omitempty"`
+	Components    []string `json:"components,omitempty"`
+
+	Usage          Usage `json:"usage"`
+	DurationMS     int64 `json:"duration_ms"`
+	Steps          int   `json:"steps"`
+	ToolCalls      int   `json:"tool_calls"`
+	ToolFailures   int   `json:"tool_failures,omitempty"`
+	BudgetExceeded bool  `json:"budget_exceeded,omitempty"`
+}
+
+// Usage is the token usage and cost of an analysis.
+type Usage struct {
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	TotalTokens  int64   `json:"total_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+}
+
+// Query selects reports. Empty fields match any report.
+type Query struct {
+	Text         string // Full-text search over the prompt, summary and output; every word must appear
+	Organization string
+	Project      string
+	Component    string
+	Caller       string
+	From, To     time.Time // Bounds on the creation time
+	Limit        int       // Maximum number of reports; DefaultLimit if 0
+}
+
+// Search result limits.
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// MaxResults returns the number of reports a search returns at most.
+func (q Query) MaxResults() int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultLimit
+	case q.Limit > MaxLimit:
+		return MaxLimit
+	}
+	return q.Limit
+}
+
+// OutputText returns the strings of the report's structured output, for full-text search.
+func (r Report) OutputText() string {
+	return strings.Join(collectStrings(r.Output, nil), "\n")
+}
+
+func collectStrings(v any, texts []string) []string {
+	switch val := v.(type) {
+	case string:
+		return append(texts, val)
+	case map[string]any:
+		for _, key := range slices.Sorted(maps.Keys(val)) {
+			texts = collectStrings(val[key], texts)
+		}
+	case []any:
+		for _, item := range val {
+			texts = collectStrings(item, texts)
+		}
+	}
+	return texts
+}
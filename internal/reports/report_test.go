@@ -0,0 +1,40 @@
+package reports
+
+import "testing"
+
+func TestQueryMaxResults(t *testing.T) {
+	tests := []struct {
+		limit int
+		want  int
+	}{
+		{0, DefaultLimit},
+		{-1, DefaultLimit},
+		{5, 5},
+		{MaxLimit, MaxLimit},
+		{MaxLimit + 1, MaxLimit},
+	}
+	for _, tt := range tests {
+		if got := (Query{Limit: tt.limit}).MaxResults(); got != tt.want {
+			t.Errorf("MaxResults() with limit %d = %d, want %d", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestReportOutputText(t *testing.T) {
+	r := Report{Output: map[string]any{
+		"summary": "payments is out of memory",
+		"findings": []any{
+			map[string]any{"entity": "payments", "severity": "high"},
+			map[string]any{"entity": "checkout", "count": 3.0},
+		},
+		"suggestions": []any{"raise the memory limit"},
+	}}
+
+	want := "payments\nhigh\ncheckout\nraise the memory limit\npayments is out of memory"
+	if got := r.OutputText(); got != want {
+		t.Errorf("OutputText() = %q, want %q", got, want)
+	}
+	if got := (Report{Output: "plain"}).OutputText(); got != "plain" {
+		t.Errorf("OutputText() of a string output = %q", got)
+	}
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"rca.agent/test/internal/agent"
+)
+
+// anonymousCaller is the budget bucket shared by requests without a caller.
+const anonymousCaller = "anonymous"
+
+// callerLedger tracks token and cost spend per caller over a sliding window,
+// so each caller can be held to a shared budget across analyses. Analyses in
+// flight with a budget of their own hold it until they finish, so concurrent
+// analyses of a caller cannot together spend more than the caller has left.
+// Analyses without one only count what they used so far, so that a caller's
+// analyses can run concurrently when no per-analysis budget is configured.
+//
+// Callers identify themselves with the caller field or X-Caller-ID header, which
+// are not authenticated: the budget is a guard against runaway use by well-behaved
+// clients, not a quota that a client cannot get around.
+type callerLedger struct {
+	mu          sync.Mutex
+	limit       agent.Budget
+	perAnalysis agent.Budget // Most a single analysis may spend, held while it runs
+	window      time.Duration
+	spends      map[string][]spend
+	inFlight    map[string]map[*reservation]struct{}
+}
+
+// spend is the usage of a single finished analysis.
+type spend struct {
+	at      time.Time
+	tokens  int64
+	costUSD float64
+}
+
+// reservation is the budget held for an analysis in flight and what it has used.
+type reservation struct {
+	ledger *callerLedger
+	caller string
+	budget agent.Budget // Budget of the analysis
+	hold   agent.Budget // Part of the budget held against the caller's while in flight
+
+	tokens  int64
+	costUSD float64
+}
+
+func newCallerLedger(limit, perAnalysis agent.Budget, window time.Duration) *callerLedger {
+	return &callerLedger{
+		limit:       limit,
+		perAnalysis: perAnalysis,
+		window:      window,
+		spends:      make(map[string][]spend),
+		inFlight:    make(map[string]map[*reservation]struct{}),
+	}
+}
+
+// reserve returns the budget of an analysis, the requested budget tightened to what
+// the caller has left in the current window, and holds its per-analysis or requested
+// limits until the reservation is released.
+// Requests without a caller share the anonymous caller's budget. It returns
+// agent.ErrBudgetExceeded if the caller has nothing left.
+func (l *callerLedger) reserve(caller string, requested agent.Budget) (*reservation, error) {
+	if caller == "" {
+		caller = anonymousCaller
+	}
+	r := &reservation{ledger: l, caller: caller, budget: requested}
+	if l.limit.IsZero() {
+		return r, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var tokens int64
+	var costUSD float64
+	for _, s := range l.prune(caller) {
+		tokens += s.tokens
+		costUSD += s.costUSD
+	}
+	for held := range l.inFlight[caller] {
+		t, c := held.charge()
+		tokens += t
+		costUSD += c
+	}
+
+	var remaining agent.Budget
+	if l.limit.MaxTokens > 0 {
+		remaining.MaxTokens = l.limit.MaxTokens - tokens
+		if remaining.MaxTokens <= 0 {
+			return nil, fmt.Errorf("caller %q used or holds %d of %d tokens: %w", caller, tokens, l.limit.MaxTokens, agent.ErrBudgetExceeded)
+		}
+	}
+	if l.limit.MaxCostUSD > 0 {
+		remaining.MaxCostUSD = l.limit.MaxCostUSD - costUSD
+		if remaining.MaxCostUSD <= 0 {
+			return nil, fmt.Errorf("caller %q spent or holds $%.4f of $%.4f: %w", caller, costUSD, l.limit.MaxCostUSD, agent.ErrBudgetExceeded)
+		}
+	}
+
+	own := requested.Tighten(l.perAnalysis)
+	r.budget = own.Tighten(remaining)
+	if own.MaxTokens > 0 {
+		r.hold.MaxTokens = r.budget.MaxTokens
+	}
+	if own.MaxCostUSD > 0 {
+		r.hold.MaxCostUSD = r.budget.MaxCostUSD
+	}
+	if l.inFlight[caller] == nil {
+		l.inFlight[caller] = make(map[*reservation]struct{})
+	}
+	l.inFlight[caller][r] = struct{}{}
+	return r, nil
+}
+
+// add charges usage of the analysis to the reservation. It may be called
+// concurrently and until the reservation is released.
+func (r *reservation) add(usage agent.Usage) {
+	r.ledger.mu.Lock()
+	defer r.ledger.mu.Unlock()
+
+	r.tokens += usage.TotalTokens
+	r.costUSD += usage.CostUSD
+}
+
+// charge returns what the reservation counts against the caller's budget: what it
+// holds, or what it used if more. Must be called with the ledger's mu held.
+func (r *reservation) charge() (int64, float64) {
+	return max(r.hold.MaxTokens, r.tokens), max(r.hold.MaxCostUSD, r.costUSD)
+}
+
+// release records what the analysis used as the caller's spend and frees the rest
+// of its held budget. The analysis must be charged whether it succeeded or not.
+func (r *reservation) release() {
+	l := r.ledger
+	if l.limit.IsZero() {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.inFlight[r.caller], r)
+	if len(l.inFlight[r.caller]) == 0 {
+		delete(l.inFlight, r.caller)
+	}
+	l.spends[r.caller] = append(l.prune(r.caller), spend{
+		at:      time.Now(),
+		tokens:  r.tokens,
+		costUSD: r.costUSD,
+	})
+}
+
+// prune drops spends older than the window. Must be called with mu held.
+func (l *callerLedger) prune(caller string) []spend {
+	cutoff := time.Now().Add(-l.window)
+	spends := l.spends[caller]
+	i := 0
+	for i < len(spends) && spends[i].at.Before(cutoff) {
+		i++
+	}
+	spends = spends[i:]
+	if len(spends) == 0 {
+		delete(l.spends, caller)
+		return nil
+	}
+	l.spends[caller] = spends
+	return spends
+}
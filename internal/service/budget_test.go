@@ -0,0 +1,147 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"rca.agent/test/internal/agent"
+)
+
+func TestCallerLedgerAnonymousCaller(t *testing.T) {
+	ledger := newCallerLedger(agent.Budget{MaxTokens: 100}, agent.Budget{}, time.Hour)
+
+	r, err := ledger.reserve("", agent.Budget{})
+	if err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+	if r.budget.MaxTokens != 100 {
+		t.Errorf("budget = %d tokens, want 100", r.budget.MaxTokens)
+	}
+	r.add(agent.Usage{TotalTokens: 100})
+	r.release()
+
+	if _, err := ledger.reserve("", agent.Budget{}); !errors.Is(err, agent.ErrBudgetExceeded) {
+		t.Errorf("reserve() after anonymous spend error = %v, want ErrBudgetExceeded", err)
+	}
+	if _, err := ledger.reserve("team-a", agent.Budget{}); err != nil {
+		t.Errorf("reserve() for another caller error = %v", err)
+	}
+}
+
+func TestCallerLedgerConcurrentWithoutAnalysisBudget(t *testing.T) {
+	ledger := newCallerLedger(agent.Budget{MaxTokens: 100}, agent.Budget{}, time.Hour)
+
+	first, err := ledger.reserve("", agent.Budget{})
+	if err != nil {
+		t.Fatalf("first reserve() error = %v", err)
+	}
+	first.add(agent.Usage{TotalTokens: 30})
+
+	// Without a budget of its own, the first analysis only counts what it used
+	second, err := ledger.reserve("", agent.Budget{})
+	if err != nil {
+		t.Fatalf("second reserve() error = %v", err)
+	}
+	if second.budget.MaxTokens != 70 {
+		t.Errorf("second budget = %d tokens, want 70", second.budget.MaxTokens)
+	}
+
+	// A requested budget is held
+	third, err := ledger.reserve("", agent.Budget{MaxTokens: 50})
+	if err != nil {
+		t.Fatalf("third reserve() error = %v", err)
+	}
+	if third.budget.MaxTokens != 50 {
+		t.Errorf("third budget = %d tokens, want 50", third.budget.MaxTokens)
+	}
+	fourth, err := ledger.reserve("", agent.Budget{})
+	if err != nil {
+		t.Fatalf("fourth reserve() error = %v", err)
+	}
+	if fourth.budget.MaxTokens != 20 {
+		t.Errorf("fourth budget = %d tokens, want 20", fourth.budget.MaxTokens)
+	}
+}
+
+func TestCallerLedgerHoldsInFlightBudget(t *testing.T) {
+	ledger := newCallerLedger(agent.Budget{MaxTokens: 100}, agent.Budget{MaxTokens: 60}, time.Hour)
+
+	first, err := ledger.reserve("team-a", agent.Budget{})
+	if err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+	if first.budget.MaxTokens != 60 {
+		t.Errorf("first budget = %d tokens, want 60", first.budget.MaxTokens)
+	}
+
+	// The second analysis only gets what the first does not hold
+	second, err := ledger.reserve("team-a", agent.Budget{})
+	if err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+	if second.budget.MaxTokens != 40 {
+		t.Errorf("second budget = %d tokens, want 40", second.budget.MaxTokens)
+	}
+	if _, err := ledger.reserve("team-a", agent.Budget{}); !errors.Is(err, agent.ErrBudgetExceeded) {
+		t.Errorf("third reserve() error = %v, want ErrBudgetExceeded", err)
+	}
+
+	// Releasing frees what the first analysis held but did not use
+	first.add(agent.Usage{TotalTokens: 10})
+	first.release()
+	third, err := ledger.reserve("team-a", agent.Budget{})
+	if err != nil {
+		t.Fatalf("reserve() after release error = %v", err)
+	}
+	if third.budget.MaxTokens != 50 {
+		t.Errorf("third budget = %d tokens, want 50", third.budget.MaxTokens)
+	}
+}
+
+func TestCallerLedgerChargesUsageOverHold(t *testing.T) {
+	ledger := newCallerLedger(agent.Budget{MaxCostUSD: 1}, agent.Budget{}, time.Hour)
+
+	r, err := ledger.reserve("team-a", agent.Budget{MaxCostUSD: 0.5})
+	if err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+
+	// An analysis that fails after going over its budget is still charged in full
+	r.add(agent.Usage{CostUSD: 0.7})
+	r.add(agent.Usage{CostUSD: 0.3})
+	if _, err := ledger.reserve("team-a", agent.Budget{}); !errors.Is(err, agent.ErrBudgetExceeded) {
+		t.Errorf("reserve() while over budget error = %v, want ErrBudgetExceeded", err)
+	}
+	r.release()
+	if _, err := ledger.reserve("team-a", agent.Budget{}); !errors.Is(err, agent.ErrBudgetExceeded) {
+		t.Errorf("reserve() after release error = %v, want ErrBudgetExceeded", err)
+	}
+}
+
+func TestCallerLedgerWindow(t *testing.T) {
+	ledger := newCallerLedger(agent.Budget{MaxTokens: 100}, agent.Budget{}, time.Hour)
+	ledger.spends["team-a"] = []spend{{at: time.Now().Add(-2 * time.Hour), tokens: 100}}
+
+	r, err := ledger.reserve("team-a", agent.Budget{})
+	if err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+	if r.budget.MaxTokens != 100 {
+		t.Errorf("budget = %d tokens, want 100", r.budget.MaxTokens)
+	}
+}
+
+func TestCallerLedgerUnlimited(t *testing.T) {
+	ledger := newCallerLedger(agent.Budget{}, agent.Budget{}, time.Hour)
+
+	r, err := ledger.reserve("team-a", agent.Budget{MaxTokens: 10})
+	if err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+	r.add(agent.Usage{TotalTokens: 1000})
+	r.release()
+	if _, err := ledger.reserve("team-a", agent.Budget{}); err != nil {
+		t.Errorf("reserve() error = %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"rca.agent/test/internal/agent"
+	"rca.agent/test/internal/mcp"
+)
+
+type pendingElicitation struct {
+	agent.PendingElicitation
+	answer chan mcp.ElicitationResponse
+}
+
+// elicitationBoard holds the pending questions of in-flight analyses, so that a human
+// can list and answer them while the analysis request is still running.
+type elicitationBoard struct {
+	mu      sync.Mutex
+	pending map[string]*pendingElicitation
+}
+
+func newElicitationBoard() *elicitationBoard {
+	return &elicitationBoard{pending: make(map[string]*pendingElicitation)}
+}
+
+// ask returns an ElicitFunc that posts questions to the board on behalf of a caller,
+// telling posted, if not nil, of each question posted.
+func (b *elicitationBoard) ask(caller string, posted func(agent.PendingElicitation)) mcp.ElicitFunc {
+	return func(ctx context.Context, e mcp.Elicitation) (mcp.ElicitationResponse, error) {
+		p := &pendingElicitation{
+			PendingElicitation: agent.PendingElicitation{Elicitation: e, Caller: caller, AskedAt: time.Now()},
+			answer:             make(chan mcp.ElicitationResponse, 1),
+		}
+
+		b.mu.Lock()
+		b.pending[e.ID] = p
+		b.mu.Unlock()
+		defer func() {
+			b.mu.Lock()
+			delete(b.pending, e.ID)
+			b.mu.Unlock()
+		}()
+		if posted != nil {
+			posted(p.PendingElicitation)
+		}
+
+		select {
+		case resp := <-p.answer:
+			return resp, nil
+		case <-ctx.Done():
+			return mcp.ElicitationResponse{}, ctx.Err()
+		}
+	}
+}
+
+// list returns the pending questions of a caller, oldest first.
+func (b *elicitationBoard) list(caller string) []agent.PendingElicitation {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pending := make([]agent.PendingElicitation, 0, len(b.pending))
+	for _, p := range b.pending {
+		if p.Caller == caller {
+			pending = append(pending, p.PendingElicitation)
+		}
+	}
+	slices.SortFunc(pending, func(a, b agent.PendingElicitation) int { return a.AskedAt.Compare(b.AskedAt) })
+	return pending
+}
+
+// answer delivers a human's answer to a pending question of the caller. Other
+// callers' questions are unknown to it.
+func (b *elicitationBoard) answer(caller, id string, resp mcp.ElicitationResponse) error {
+	switch resp.Action {
+	case "accept", "decline", "cancel":
+	default:
+		return fmt.Errorf("action must be accept, decline or cancel")
+	}
+
+	b.mu.Lock()
+	p, ok := b.pending[id]
+	ok = ok && p.Caller == caller
+	if ok {
+		delete(b.pending, id)
+	}
+	b.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", mcp.ErrUnknownElicitation, id)
+	}
+
+	p.answer <- resp
+	return nil
+}
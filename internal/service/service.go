@@ -2,9 +2,15 @@ package service
 
 import (
 	"context"
+	"log/slog"
+	"time"
 
 	"rca.agent/test/internal/agent"
 	"rca.agent/test/internal/config"
+	"rca.agent/test/internal/embeddings"
+	"rca.agent/test/internal/mcp"
+	"rca.agent/test/internal/reports"
+	"rca.agent/test/internal/storage"
 )
 
 // DefaultMaxSteps is the maximum number of agent steps.
@@ -17,6 +23,8 @@ Organization -> Project -> Component
 
 Use your tools as needed. CRITICAL: Always use the todos tool to keep track of your task, and always update it as you make progress.
 
+Use the search_past_analyses tool to check whether a similar incident was analyzed before. If one matches, say so, citing its date and ID, and reuse its remediation where it applies.
+
 When you are ready to respond, you MUST call the structured_output tool to submit your response.
 `
 
@@ -34,31 +42,148 @@ type Finding struct {
 	Severity    string `json:"severity,omitempty" description:"Severity level" enum:"info,low,medium,high,critical"`
 }
 
+// Analyzer runs analyses on the configured models and MCP servers, as *agent.Agent does.
+type Analyzer interface {
+	Analyze(ctx context.Context, req agent.Request) (*agent.AnalysisResult, error)
+	MCPHealth() []mcp.ServerHealth
+	Profiles(ctx context.Context) []mcp.Prompt
+	Close() error
+}
+
 // AnalysisService provides analysis capabilities.
 type AnalysisService struct {
-	agent *agent.Agent
+	agent        Analyzer
+	callers      *callerLedger
+	elicitations *elicitationBoard
+	store        storage.Store
+	writer       *recordWriter
+	stop         context.CancelFunc // Stops retention enforcement
 }
 
 // NewAnalysisService creates a new analysis service.
 func NewAnalysisService(ctx context.Context, cfg *config.Config) (*AnalysisService, error) {
-	a, err := agent.New(ctx, cfg, agent.Options{
+	store, err := storage.Open(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Storage opened", "backend", cfg.StorageBackend, "retention", cfg.StorageRetention)
+	if cfg.StorageBackend == storage.BackendMemory {
+		slog.Warn("Analysis reports and trajectories are kept in memory and lost on restart; set STORAGE_BACKEND to keep them",
+			"max_entries", cfg.StorageMemoryMaxEntries)
+	}
+
+	opts := agent.Options{
 		SystemPrompt: DefaultSystemPrompt,
 		OutputSchema: AnalysisOutput{},
 		MaxSteps:     DefaultMaxSteps,
-	})
+		PastAnalyses: store,
+	}
+	if cfg.EmbeddingsBaseURL != "" {
+		opts.Embedder = embeddings.New(cfg.EmbeddingsBaseURL, cfg.EmbeddingsModel, cfg.EmbeddingsAPIKey)
+	}
+	a, err := agent.New(ctx, cfg, opts)
 	if err != nil {
+		store.Close()
 		return nil, err
 	}
 
-	return &AnalysisService{agent: a}, nil
+	return New(a, store, cfg), nil
 }
 
-// Analyze runs an analysis with the given prompt.
-func (s *AnalysisService) Analyze(ctx context.Context, prompt string) (*agent.AnalysisResult, error) {
-	return s.agent.Analyze(ctx, prompt)
+// New creates an analysis service that runs analyses with the analyzer and records
+// them in the store. The service takes ownership of both.
+func New(a Analyzer, store storage.Store, cfg *config.Config) *AnalysisService {
+	callers := newCallerLedger(agent.Budget{
+		MaxTokens:  cfg.CallerTokenBudget,
+		MaxCostUSD: cfg.CallerCostBudgetUSD,
+	}, agent.Budget{
+		MaxTokens:  cfg.AnalysisTokenBudget,
+		MaxCostUSD: cfg.AnalysisCostBudgetUSD,
+	}, cfg.CallerBudgetWindow)
+
+	retentionCtx, stop := context.WithCancel(context.Background())
+	if cfg.StorageRetention > 0 {
+		go enforceRetention(retentionCtx, store, cfg.StorageRetention, cfg.StorageCleanupInterval)
+	}
+
+	return &AnalysisService{
+		agent:        a,
+		callers:      callers,
+		elicitations: newElicitationBoard(),
+		store:        store,
+		writer:       &recordWriter{store: store},
+		stop:         stop,
+	}
 }
 
-// Close cleans up resources.
+// Analyze runs an analysis for the given request, within the caller's remaining budget.
+func (s *AnalysisService) Analyze(ctx context.Context, req agent.Request) (*agent.AnalysisResult, error) {
+	reservation, err := s.callers.reserve(req.Caller, req.Budget)
+	if err != nil {
+		return nil, err
+	}
+	defer reservation.release()
+	req.Budget = reservation.budget
+	onUsage := req.OnUsage
+	req.OnUsage = func(usage agent.Usage) {
+		reservation.add(usage)
+		if onUsage != nil {
+			onUsage(usage)
+		}
+	}
+	if req.OnElicit == nil {
+		req.OnElicit = s.elicitations.ask(req.Caller, req.OnPendingElicitation)
+	}
+	req.OnTrajectory = s.writer.saveTrajectory
+
+	start := time.Now()
+	result, err := s.agent.Analyze(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.writer.saveReport(newReport(req, result, time.Since(start)))
+	return result, nil
+}
+
+// MCPHealth returns the connection health of the MCP servers.
+func (s *AnalysisService) MCPHealth() []mcp.ServerHealth {
+	return s.agent.MCPHealth()
+}
+
+// Profiles returns the analysis profiles published by the MCP servers.
+func (s *AnalysisService) Profiles(ctx context.Context) []mcp.Prompt {
+	return s.agent.Profiles(ctx)
+}
+
+// Elicitations returns the questions MCP servers asked during a caller's in-flight
+// analyses that await an answer.
+func (s *AnalysisService) Elicitations(caller string) []agent.PendingElicitation {
+	return s.elicitations.list(caller)
+}
+
+// AnswerElicitation answers a pending question of the caller, resuming the tool call
+// that asked it.
+func (s *AnalysisService) AnswerElicitation(caller, id string, resp mcp.ElicitationResponse) error {
+	return s.elicitations.answer(caller, id, resp)
+}
+
+// Trajectory returns the recorded trajectory of an analysis.
+func (s *AnalysisService) Trajectory(ctx context.Context, id string) (*agent.Trajectory, error) {
+	return s.store.Trajectory(ctx, id)
+}
+
+// SearchAnalyses returns the reports of past analyses that match a query.
+func (s *AnalysisService) SearchAnalyses(ctx context.Context, q reports.Query) ([]reports.Report, error) {
+	return s.store.SearchReports(ctx, q)
+}
+
+// Close cleans up resources, waiting for records being stored.
 func (s *AnalysisService) Close() error {
+	s.stop()
+	s.writer.close()
+	if err := s.store.Close(); err != nil {
+		slog.Error("Failed to close storage", "error", err)
+	}
 	return s.agent.Close()
 }
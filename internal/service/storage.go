@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"rca.agent/test/internal/agent"
+	"rca.agent/test/internal/reports"
+	"rca.agent/test/internal/storage"
+)
+
+// recordWriteTimeout bounds how long storing a record may take, retries included.
+const recordWriteTimeout = 2 * time.Minute
+
+// recordWriter stores records in the background, so that analyses do not wait for
+// the store, and waits for pending writes on close.
+type recordWriter struct {
+	store   storage.Store
+	pending sync.WaitGroup
+}
+
+// save runs a write in the background, logging its failure.
+func (w *recordWriter) save(kind, id string, write func(ctx context.Context) error) {
+	w.pending.Go(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), recordWriteTimeout)
+		defer cancel()
+		if err := write(ctx); err != nil {
+			slog.Error("Failed to store "+kind, "id", id, "error", err)
+		}
+	})
+}
+
+func (w *recordWriter) saveReport(r reports.Report) {
+	w.save("analysis report", r.ID, func(ctx context.Context) error { return w.store.SaveReport(ctx, r) })
+}
+
+func (w *recordWriter) saveTrajectory(t *agent.Trajectory) {
+	w.save("analysis trajectory", t.ID, func(ctx context.Context) error { return w.store.SaveTrajectory(ctx, t) })
+}
+
+func (w *recordWriter) close() {
+	w.pending.Wait()
+}
+
+// enforceRetention deletes records older than the retention every interval until
+// the context is done.
+func enforceRetention(ctx context.Context, store storage.Store, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cutoff := time.Now().Add(-retention)
+		if err := store.DeleteBefore(ctx, cutoff); err != nil {
+			slog.Warn("Failed to delete expired records", "before", cutoff, "error", err)
+			continue
+		}
+		slog.Debug("Deleted expired records", "before", cutoff)
+	}
+}
+
+// newReport builds the report of a completed analysis.
+func newReport(req agent.Request, result *agent.AnalysisResult, duration time.Duration) reports.Report {
+	r := reports.Report{
+		ID:            result.ID,
+		CreatedAt:     time.Now().UTC(),
+		Caller:        req.Caller,
+		Prompt:        req.Prompt,
+		Profile:       req.Profile,
+		Output:        result.Output,
+		Text:          result.Text,
+		Organizations: result.Entities.Organizations,
+		Projects:      result.Entities.Projects,
+		Components:    result.Entities.Components,
+		Usage: reports.Usage{
+			InputTokens:  result.Usage.InputTokens,
+			OutputTokens: result.Usage.OutputTokens,
+			TotalTokens:  result.Usage.TotalTokens,
+			CostUSD:      result.Usage.CostUSD,
+		},
+		DurationMS:     duration.Milliseconds(),
+		Steps:          result.TotalSteps,
+		ToolCalls:      result.ToolCalls,
+		BudgetExceeded: result.BudgetExceeded,
+	}
+	for _, step := range result.Steps {
+		if step.Model != "" && !slices.Contains(r.Models, step.Model) {
+			r.Models = append(r.Models, step.Model)
+		}
+	}
+	for _, n := range result.ToolFailures {
+		r.ToolFailures += n
+	}
+	if output, ok := result.Output.(map[string]any); ok {
+		r.Summary, _ = output["summary"].(string)
+	}
+	return r
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"rca.agent/test/internal/agent"
+	"rca.agent/test/internal/reports"
+)
+
+// MemoryStore keeps records in memory, up to a number of each kind, evicting the
+// oldest. It is meant for tests and deployments that need no history across restarts.
+type MemoryStore struct {
+	mu           sync.Mutex
+	reports      *records[reports.Report]
+	trajectories *records[*agent.Trajectory]
+}
+
+// NewMemoryStore creates a store that keeps at most maxEntries records of each kind.
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	return &MemoryStore{
+		reports:      newRecords[reports.Report](maxEntries),
+		trajectories: newRecords[*agent.Trajectory](maxEntries),
+	}
+}
+
+// records holds records by ID in insertion order.
+type records[T any] struct {
+	maxEntries int
+	byID       map[string]T
+	order      []string // IDs, oldest first
+}
+
+func newRecords[T any](maxEntries int) *records[T] {
+	return &records[T]{maxEntries: maxEntries, byID: make(map[string]T)}
+}
+
+func (r *records[T]) put(id string, v T) {
+	if _, ok := r.byID[id]; !ok {
+		r.order = append(r.order, id)
+	}
+	r.byID[id] = v
+	for len(r.order) > r.maxEntries {
+		delete(r.byID, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+// deleteIf deletes the records for which expired returns true.
+func (r *records[T]) deleteIf(expired func(T) bool) {
+	r.order = slices.DeleteFunc(r.order, func(id string) bool {
+		if expired(r.byID[id]) {
+			delete(r.byID, id)
+			return true
+		}
+		return false
+	})
+}
+
+func (s *MemoryStore) SaveReport(_ context.Context, r reports.Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reports.put(r.ID, r)
+	return nil
+}
+
+func (s *MemoryStore) SearchReports(_ context.Context, q reports.Query) ([]reports.Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found []reports.Report
+	for _, id := range s.reports.order {
+		if r := s.reports.byID[id]; matchesReport(r, q) {
+			found = append(found, r)
+		}
+	}
+	slices.SortStableFunc(found, func(a, b reports.Report) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return found[:min(len(found), q.MaxResults())], nil
+}
+
+func (s *MemoryStore) SaveTrajectory(_ context.Context, t *agent.Trajectory) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trajectories.put(t.ID, t)
+	return nil
+}
+
+func (s *MemoryStore) Trajectory(_ context.Context, analysisID string) (*agent.Trajectory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.trajectories.byID[analysisID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return t, nil
+}
+
+func (s *MemoryStore) DeleteBefore(_ context.Context, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reports.deleteIf(func(r reports.Report) bool { return r.CreatedAt.Before(t) })
+	s.trajectories.deleteIf(func(tr *agent.Trajectory) bool { return tr.StartedAt.Before(t) })
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
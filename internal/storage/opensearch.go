@@ -0,0 +1,368 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"rca.agent/test/internal/agent"
+	"rca.agent/test/internal/httputil"
+	"rca.agent/test/internal/reports"
+)
+
+// templateVersion is recorded on the index templates. Bump it when changing the
+// mappings; the templates apply to indices created afterwards, i.e. from the next month.
+const templateVersion = 1
+
+// Retry backoff bounds for OpenSearch requests.
+const (
+	retryInitialDelay = 500 * time.Millisecond
+	retryMaxDelay     = 10 * time.Second
+)
+
+// OpenSearchConfig configures an OpenSearchStore.
+type OpenSearchConfig struct {
+	Address       string
+	Username      string
+	Password      string
+	IndexPrefix   string // Indices are named <prefix>-<kind>-YYYY.MM
+	TLSSkipVerify bool
+	MaxRetries    int // Retries of requests that failed with 429, 5xx or a network error
+}
+
+// OpenSearchStore keeps records in OpenSearch, in monthly indices of each kind. The
+// index templates are installed before the first write.
+type OpenSearchStore struct {
+	cfg    OpenSearchConfig
+	client *http.Client
+
+	mu             sync.Mutex
+	templatesReady bool
+}
+
+// NewOpenSearchStore creates a store for the OpenSearch cluster at cfg.Address.
+func NewOpenSearchStore(cfg OpenSearchConfig) *OpenSearchStore {
+	return &OpenSearchStore{
+		cfg:    cfg,
+		client: httputil.NewHTTPClient(30*time.Second, cfg.TLSSkipVerify),
+	}
+}
+
+// reportDocument is a report as indexed: its output is stored but not indexed, and
+// its text is indexed for full-text search instead.
+type reportDocument struct {
+	reports.Report
+	OutputText string `json:"output_text,omitempty"`
+}
+
+// Record kinds, as named in index names.
+const (
+	kindReports      = "reports"
+	kindTrajectories = "trajectories"
+)
+
+func (s *OpenSearchStore) index(kind string, t time.Time) string {
+	return s.cfg.IndexPrefix + "-" + kind + "-" + t.UTC().Format("2006.01")
+}
+
+func (s *OpenSearchStore) indices(kind string) string {
+	return s.cfg.IndexPrefix + "-" + kind + "-*"
+}
+
+// indexTemplates returns the index templates by name. Dynamic mapping is off, so
+// only the mapped fields are searchable and records of any shape are stored as is.
+func (s *OpenSearchStore) indexTemplates() map[string]map[string]any {
+	keyword := map[string]any{"type": "keyword"}
+	text := map[string]any{"type": "text"}
+	long := map[string]any{"type": "long"}
+	integer := map[string]any{"type": "integer"}
+	date := map[string]any{"type": "date"}
+	unindexed := map[string]any{"type": "object", "enabled": false}
+
+	template := func(pattern string, properties map[string]any) map[string]any {
+		return map[string]any{
+			"index_patterns": []string{pattern},
+			"version":        templateVersion,
+			"template": map[string]any{
+				"settings": map[string]any{"number_of_shards": 1},
+				"mappings": map[string]any{"dynamic": false, "properties": properties},
+			},
+		}
+	}
+
+	return map[string]map[string]any{
+		s.cfg.IndexPrefix + "-" + kindReports: template(s.indices(kindReports), map[string]any{
+			"id":            keyword,
+			"created_at":    date,
+			"caller":        keyword,
+			"prompt":        text,
+			"profile":       keyword,
+			"models":        keyword,
+			"summary":       text,
+			"output":        unindexed,
+			"output_text":   text,
+			"text":          text,
+			"organizations": keyword,
+			"projects":      keyword,
+			"components":    keyword,
+			"usage": map[string]any{"properties": map[string]any{
+				"input_tokens":  long,
+				"output_tokens": long,
+				"total_tokens":  long,
+				"cost_usd":      map[string]any{"type": "double"},
+			}},
+			"duration_ms":     long,
+			"steps":           integer,
+			"tool_calls":      integer,
+			"tool_failures":   integer,
+			"budget_exceeded": map[string]any{"type": "boolean"},
+		}),
+		s.cfg.IndexPrefix + "-" + kindTrajectories: template(s.indices(kindTrajectories), map[string]any{
+			"id":          keyword,
+			"caller":      keyword,
+			"started_at":  date,
+			"finished_at": date,
+			"steps":       unindexed,
+			"output":      unindexed,
+		}),
+	}
+}
+
+// ensureTemplates installs the index templates unless they already were.
+func (s *OpenSearchStore) ensureTemplates(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.templatesReady {
+		return nil
+	}
+	for name, template := range s.indexTemplates() {
+		if err := s.do(ctx, http.MethodPut, "/_index_template/"+url.PathEscape(name), template, nil); err != nil {
+			return fmt.Errorf("install index template %s: %w", name, err)
+		}
+	}
+	s.templatesReady = true
+	return nil
+}
+
+// put stores a document under its ID.
+func (s *OpenSearchStore) put(ctx context.Context, index, id string, doc any) error {
+	if err := s.ensureTemplates(ctx); err != nil {
+		return err
+	}
+	return s.do(ctx, http.MethodPut, "/"+index+"/_doc/"+url.PathEscape(id), doc, nil)
+}
+
+// search runs a search request and decodes the sources of the hits into out, a
+// pointer to a slice.
+func (s *OpenSearchStore) search(ctx context.Context, indices string, body map[string]any, out any) error {
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				Source json.RawMessage `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	path := "/" + indices + "/_search?ignore_unavailable=true&allow_no_indices=true"
+	if err := s.do(ctx, http.MethodPost, path, body, &resp); err != nil {
+		return err
+	}
+
+	sources := make([]json.RawMessage, len(resp.Hits.Hits))
+	for i, hit := range resp.Hits.Hits {
+		sources[i] = hit.Source
+	}
+	raw, err := json.Marshal(sources)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+func (s *OpenSearchStore) SaveReport(ctx context.Context, r reports.Report) error {
+	doc := reportDocument{Report: r, OutputText: r.OutputText()}
+	if err := s.put(ctx, s.index(kindReports, r.CreatedAt), r.ID, doc); err != nil {
+		return fmt.Errorf("index report %s: %w", r.ID, err)
+	}
+	return nil
+}
+
+// SearchReports returns the most relevant reports first when the query has text,
+// and the most recent first otherwise.
+func (s *OpenSearchStore) SearchReports(ctx context.Context, q reports.Query) ([]reports.Report, error) {
+	filters := []any{}
+	for _, term := range [][2]string{
+		{"organizations", q.Organization},
+		{"projects", q.Project},
+		{"components", q.Component},
+		{"caller", q.Caller},
+	} {
+		if term[1] != "" {
+			filters = append(filters, map[string]any{"term": map[string]any{term[0]: term[1]}})
+		}
+	}
+	if !q.From.IsZero() || !q.To.IsZero() {
+		bounds := make(map[string]any)
+		if !q.From.IsZero() {
+			bounds["gte"] = q.From.UTC().Format(time.RFC3339)
+		}
+		if !q.To.IsZero() {
+			bounds["lte"] = q.To.UTC().Format(time.RFC3339)
+		}
+		filters = append(filters, map[string]any{"range": map[string]any{"created_at": bounds}})
+	}
+
+	boolQuery := map[string]any{"filter": filters}
+	sort := []any{map[string]any{"created_at": "desc"}}
+	if q.Text != "" {
+		// Every word must appear, as with the other backends, in any of the fields
+		boolQuery["must"] = map[string]any{"multi_match": map[string]any{
+			"query":    q.Text,
+			"type":     "cross_fields",
+			"operator": "and",
+			"fields":   []string{"summary^3", "prompt^2", "output_text", "text"},
+		}}
+		sort = append([]any{"_score"}, sort...)
+	}
+
+	var found []reports.Report
+	err := s.search(ctx, s.indices(kindReports), map[string]any{
+		"size":    q.MaxResults(),
+		"query":   map[string]any{"bool": boolQuery},
+		"sort":    sort,
+		"_source": map[string]any{"excludes": []string{"output_text"}},
+	}, &found)
+	if err != nil {
+		return nil, fmt.Errorf("search reports: %w", err)
+	}
+	return found, nil
+}
+
+func (s *OpenSearchStore) SaveTrajectory(ctx context.Context, t *agent.Trajectory) error {
+	if err := s.put(ctx, s.index(kindTrajectories, t.StartedAt), t.ID, t); err != nil {
+		return fmt.Errorf("index trajectory %s: %w", t.ID, err)
+	}
+	return nil
+}
+
+func (s *OpenSearchStore) Trajectory(ctx context.Context, analysisID string) (*agent.Trajectory, error) {
+	var found []*agent.Trajectory
+	err := s.search(ctx, s.indices(kindTrajectories), map[string]any{
+		"size":  1,
+		"query": map[string]any{"ids": map[string]any{"values": []string{analysisID}}},
+	}, &found)
+	if err != nil {
+		return nil, fmt.Errorf("get trajectory %s: %w", analysisID, err)
+	}
+	if len(found) == 0 {
+		return nil, ErrNotFound
+	}
+	return found[0], nil
+}
+
+func (s *OpenSearchStore) DeleteBefore(ctx context.Context, t time.Time) error {
+	before := map[string]any{"lt": t.UTC().Format(time.RFC3339)}
+	query := map[string]any{"bool": map[string]any{
+		"should": []any{
+			map[string]any{"range": map[string]any{"created_at": before}},
+			map[string]any{"range": map[string]any{"started_at": before}},
+		},
+		"minimum_should_match": 1,
+	}}
+
+	indices := s.indices(kindReports) + "," + s.indices(kindTrajectories)
+	path := "/" + indices + "/_delete_by_query?ignore_unavailable=true&allow_no_indices=true&conflicts=proceed"
+	if err := s.do(ctx, http.MethodPost, path, map[string]any{"query": query}, nil); err != nil {
+		return fmt.Errorf("delete expired records: %w", err)
+	}
+	return nil
+}
+
+func (s *OpenSearchStore) Close() error {
+	return nil
+}
+
+// statusError is an error response from OpenSearch.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.code, e.body)
+}
+
+func (e *statusError) Is(target error) bool {
+	return target == ErrUpstream
+}
+
+// do sends a JSON request, retrying on throttling, server errors and network errors,
+// and decodes the response into out if it is non-nil.
+func (s *OpenSearchStore) do(ctx context.Context, method, path string, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	delay := retryInitialDelay
+	for attempt := 0; ; attempt++ {
+		retryable, err := s.send(ctx, method, path, payload, out)
+		if err == nil || !retryable || attempt >= s.cfg.MaxRetries {
+			return err
+		}
+
+		slog.Warn("OpenSearch request failed, retrying", "method", method, "path", path, "attempt", attempt+1, "delay", delay, "error", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay = min(delay*2, retryMaxDelay)
+	}
+}
+
+// send sends a request once, reporting whether a failure is worth retrying.
+func (s *OpenSearchStore) send(ctx context.Context, method, path string, payload []byte, out any) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.cfg.Address, "/")+path, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.cfg.Username != "" {
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, err
+		}
+		return true, fmt.Errorf("%w: %w", ErrUpstream, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retryable, &statusError{code: resp.StatusCode, body: strings.TrimSpace(string(msg))}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return false, fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return false, nil
+}
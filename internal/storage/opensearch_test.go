@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rca.agent/test/internal/agent"
+	"rca.agent/test/internal/reports"
+)
+
+// fakeOpenSearch implements the index template, document and search APIs the store
+// uses. Searches apply term filters, ids queries and multi_match queries with the
+// and operator, which require every word in any of the fields.
+type fakeOpenSearch struct {
+	mu        sync.Mutex
+	templates map[string]map[string]any
+	docs      map[string]map[string]any // By index/id
+	failNext  int                       // Requests to fail with 503
+	lastQuery map[string]any
+}
+
+func newFakeOpenSearch() *fakeOpenSearch {
+	return &fakeOpenSearch{templates: make(map[string]map[string]any), docs: make(map[string]map[string]any)}
+}
+
+func (f *fakeOpenSearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failNext > 0 {
+		f.failNext--
+		http.Error(w, `{"error":"unavailable"}`, http.StatusServiceUnavailable)
+		return
+	}
+	var body map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodPut && parts[0] == "_index_template":
+		f.templates[parts[1]] = body
+	case r.Method == http.MethodPut && len(parts) == 3 && parts[1] == "_doc":
+		if len(f.templates) != 2 {
+			http.Error(w, "no index template", http.StatusBadRequest)
+			return
+		}
+		f.docs[parts[0]+"/"+parts[2]] = body
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "_search":
+		f.lastQuery = body
+		prefix := strings.TrimSuffix(parts[0], "*")
+		var hits []any
+		for key, doc := range f.docs {
+			if strings.HasPrefix(key, prefix) && matchesQuery(key, doc, body["query"].(map[string]any)) {
+				hits = append(hits, map[string]any{"_source": doc})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"hits": map[string]any{"hits": hits}})
+	default:
+		http.Error(w, "unsupported", http.StatusBadRequest)
+	}
+}
+
+func matchesQuery(key string, doc map[string]any, query map[string]any) bool {
+	if ids, ok := query["ids"].(map[string]any); ok {
+		_, id, _ := strings.Cut(key, "/")
+		return slices.Contains(ids["values"].([]any), any(id))
+	}
+	boolQuery := query["bool"].(map[string]any)
+	if must, ok := boolQuery["must"].(map[string]any); ok {
+		match := must["multi_match"].(map[string]any)
+		if match["operator"] != "and" {
+			return false
+		}
+		var text string
+		for _, field := range match["fields"].([]any) {
+			name, _, _ := strings.Cut(field.(string), "^")
+			value, _ := doc[name].(string)
+			text += strings.ToLower(value) + "\n"
+		}
+		for _, word := range strings.Fields(strings.ToLower(match["query"].(string))) {
+			if !strings.Contains(text, word) {
+				return false
+			}
+		}
+	}
+	for _, f := range boolQuery["filter"].([]any) {
+		term, ok := f.(map[string]any)["term"].(map[string]any)
+		if !ok {
+			continue
+		}
+		for field, want := range term {
+			switch got := doc[field].(type) {
+			case []any:
+				if !slices.Contains(got, want) {
+					return false
+				}
+			default:
+				if got != want {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func TestOpenSearchStore(t *testing.T) {
+	fake := newFakeOpenSearch()
+	fake.failNext = 1
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store := NewOpenSearchStore(OpenSearchConfig{Address: srv.URL, IndexPrefix: "rca-analyses", MaxRetries: 2})
+	ctx := context.Background()
+	created := time.Date(2026, 8, 3, 10, 0, 0, 0, time.UTC)
+
+	// The first request fails and is retried
+	err := store.SaveReport(ctx, reports.Report{
+		ID:         "a1",
+		CreatedAt:  created,
+		Prompt:     "Payments latency spiked",
+		Summary:    "Connection pool exhaustion",
+		Output:     map[string]any{"findings": []any{map[string]any{"description": "pool size 10 reached"}}},
+		Components: []string{"payments"},
+	})
+	if err != nil {
+		t.Fatalf("SaveReport: %v", err)
+	}
+	if err := store.SaveReport(ctx, reports.Report{ID: "a2", CreatedAt: created, Components: []string{"checkout"}}); err != nil {
+		t.Fatalf("SaveReport: %v", err)
+	}
+
+	doc, ok := fake.docs["rca-analyses-reports-2026.08/a1"]
+	if !ok {
+		t.Fatalf("documents = %v", fake.docs)
+	}
+	if doc["output_text"] != "pool size 10 reached" {
+		t.Errorf("output_text = %v", doc["output_text"])
+	}
+
+	found, err := store.SearchReports(ctx, reports.Query{Component: "payments", Text: "pool"})
+	if err != nil {
+		t.Fatalf("SearchReports: %v", err)
+	}
+	if len(found) != 1 || found[0].ID != "a1" || found[0].Summary != "Connection pool exhaustion" {
+		t.Errorf("found = %+v", found)
+	}
+	query := fake.lastQuery["query"].(map[string]any)["bool"].(map[string]any)
+	if _, ok := query["must"]; !ok {
+		t.Errorf("full-text query missing: %v", query)
+	}
+	if fake.lastQuery["size"] != float64(reports.DefaultLimit) {
+		t.Errorf("size = %v", fake.lastQuery["size"])
+	}
+	// Every word must appear, in any field
+	for text, want := range map[string]int{"pool latency": 1, "pool checkout": 0} {
+		found, err := store.SearchReports(ctx, reports.Query{Text: text})
+		if err != nil || len(found) != want {
+			t.Errorf("SearchReports(%q) = %+v, %v, want %d reports", text, found, err, want)
+		}
+	}
+
+	if err := store.SaveTrajectory(ctx, &agent.Trajectory{ID: "a1", Prompt: "Payments latency spiked", StartedAt: created}); err != nil {
+		t.Fatalf("SaveTrajectory: %v", err)
+	}
+	if _, ok := fake.docs["rca-analyses-trajectories-2026.08/a1"]; !ok {
+		t.Fatalf("documents = %v", fake.docs)
+	}
+	trajectory, err := store.Trajectory(ctx, "a1")
+	if err != nil || trajectory.Prompt != "Payments latency spiked" {
+		t.Errorf("Trajectory = %+v, %v", trajectory, err)
+	}
+	if _, err := store.Trajectory(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Trajectory(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestOpenSearchStoreDoesNotRetryClientErrors(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "mapper_parsing_exception", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	store := NewOpenSearchStore(OpenSearchConfig{Address: srv.URL, IndexPrefix: "rca-analyses", MaxRetries: 3})
+	if err := store.SaveReport(context.Background(), reports.Report{ID: "a1"}); !errors.Is(err, ErrUpstream) {
+		t.Fatalf("SaveReport error = %v, want ErrUpstream", err)
+	}
+	if requests != 1 {
+		t.Errorf("requests = %d, want 1", requests)
+	}
+}
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"rca.agent/test/internal/agent"
+	"rca.agent/test/internal/reports"
+)
+
+// sqliteMigrations are applied in order; the database's user_version is the number
+// applied. Append new migrations, never edit applied ones.
+var sqliteMigrations = []string{
+	`CREATE TABLE reports (
+		id            TEXT PRIMARY KEY,
+		created_at    INTEGER NOT NULL,
+		caller        TEXT NOT NULL,
+		organizations TEXT NOT NULL,
+		projects      TEXT NOT NULL,
+		components    TEXT NOT NULL,
+		search_text   TEXT NOT NULL,
+		body          TEXT NOT NULL
+	);
+	CREATE INDEX reports_created_at ON reports (created_at);
+
+	CREATE TABLE trajectories (
+		id         TEXT PRIMARY KEY,
+		created_at INTEGER NOT NULL,
+		body       TEXT NOT NULL
+	);
+	CREATE INDEX trajectories_created_at ON trajectories (created_at);`,
+}
+
+// SQLiteStore keeps records in an embedded SQLite database, for single-replica
+// deployments. Records are stored as JSON, with the columns searches filter on.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens the database at path, creating it if needed, and migrates it.
+func OpenSQLite(ctx context.Context, path string) (*SQLiteStore, error) {
+	if !sqliteAvailable {
+		return nil, errors.New("the sqlite storage backend requires a build with cgo (CGO_ENABLED=1)")
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite database: %w", err)
+	}
+	// SQLite allows one writer at a time
+	db.SetMaxOpenConns(1)
+
+	s := &SQLiteStore{db: db}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate applies the migrations the database does not have yet.
+func (s *SQLiteStore) migrate(ctx context.Context) error {
+	var version int
+	if err := s.db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf("database schema version %d is newer than this build supports (%d)", version, len(sqliteMigrations))
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("apply migration %d: %w", i+1, err)
+		}
+		// PRAGMA does not take parameters
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("apply migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("apply migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) SaveReport(ctx context.Context, r reports.Report) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO reports (id, created_at, caller, organizations, projects, components, search_text, body)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, r.CreatedAt.UnixMilli(), r.Caller, jsonList(r.Organizations), jsonList(r.Projects), jsonList(r.Components), searchText(r), body)
+	return err
+}
+
+func (s *SQLiteStore) SearchReports(ctx context.Context, q reports.Query) ([]reports.Report, error) {
+	var where []string
+	var args []any
+	for _, filter := range [][2]string{
+		{"organizations", q.Organization},
+		{"projects", q.Project},
+		{"components", q.Component},
+	} {
+		if filter[1] != "" {
+			where = append(where, "EXISTS (SELECT 1 FROM json_each(reports."+filter[0]+") WHERE value = ?)")
+			args = append(args, filter[1])
+		}
+	}
+	if q.Caller != "" {
+		where = append(where, "caller = ?")
+		args = append(args, q.Caller)
+	}
+	if !q.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, q.From.UnixMilli())
+	}
+	if !q.To.IsZero() {
+		where = append(where, "created_at <= ?")
+		args = append(args, q.To.UnixMilli())
+	}
+	for _, word := range strings.Fields(strings.ToLower(q.Text)) {
+		where = append(where, `search_text LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(word)+"%")
+	}
+
+	query := "SELECT body FROM reports"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at DESC LIMIT ?"
+	args = append(args, q.MaxResults())
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var found []reports.Report
+	for rows.Next() {
+		var body []byte
+		if err := rows.Scan(&body); err != nil {
+			return nil, err
+		}
+		var r reports.Report
+		if err := json.Unmarshal(body, &r); err != nil {
+			return nil, err
+		}
+		found = append(found, r)
+	}
+	return found, rows.Err()
+}
+
+func (s *SQLiteStore) SaveTrajectory(ctx context.Context, t *agent.Trajectory) error {
+	body, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, "INSERT OR REPLACE INTO trajectories (id, created_at, body) VALUES (?, ?, ?)",
+		t.ID, t.StartedAt.UnixMilli(), body)
+	return err
+}
+
+func (s *SQLiteStore) Trajectory(ctx context.Context, analysisID string) (*agent.Trajectory, error) {
+	var t agent.Trajectory
+	if err := s.get(ctx, "SELECT body FROM trajectories WHERE id = ?", analysisID, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *SQLiteStore) DeleteBefore(ctx context.Context, t time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		"DELETE FROM reports WHERE created_at < ?",
+		"DELETE FROM trajectories WHERE created_at < ?",
+	} {
+		if _, err := tx.ExecContext(ctx, stmt, t.UnixMilli()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// get decodes the JSON body of the single row a query returns.
+func (s *SQLiteStore) get(ctx context.Context, query, id string, v any) error {
+	var body []byte
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func jsonList(list []string) string {
+	if list == nil {
+		list = []string{}
+	}
+	b, _ := json.Marshal(list)
+	return string(b)
+}
@@ -0,0 +1,8 @@
+//go:build cgo
+
+package storage
+
+import _ "github.com/mattn/go-sqlite3"
+
+// sqliteAvailable reports whether the SQLite driver, which needs cgo, is built in.
+const sqliteAvailable = true
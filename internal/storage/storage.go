@@ -0,0 +1,92 @@
+// Package storage persists analysis reports and trajectories, in memory, in an
+// embedded SQLite database or in OpenSearch.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"rca.agent/test/internal/agent"
+	"rca.agent/test/internal/config"
+	"rca.agent/test/internal/reports"
+)
+
+// ErrNotFound is returned for records that do not exist or are no longer kept.
+var ErrNotFound = errors.New("not found")
+
+// ErrUpstream marks failures of a remote storage backend, such as an error
+// response from OpenSearch, as opposed to failures of the server itself.
+var ErrUpstream = errors.New("storage backend failed")
+
+// Store persists the state of the analysis server. Saving a record again replaces it.
+type Store interface {
+	SaveReport(ctx context.Context, r reports.Report) error
+	// SearchReports returns the reports matching a query, the most recent first
+	// unless the backend ranks full-text matches by relevance.
+	SearchReports(ctx context.Context, q reports.Query) ([]reports.Report, error)
+
+	SaveTrajectory(ctx context.Context, t *agent.Trajectory) error
+	Trajectory(ctx context.Context, analysisID string) (*agent.Trajectory, error)
+
+	// DeleteBefore deletes reports and trajectories created before a time.
+	DeleteBefore(ctx context.Context, t time.Time) error
+
+	Close() error
+}
+
+// Storage backends.
+const (
+	BackendMemory     = "memory"
+	BackendSQLite     = "sqlite"
+	BackendOpenSearch = "opensearch"
+)
+
+// Open opens the store of the configured backend, applying migrations as needed.
+func Open(ctx context.Context, cfg *config.Config) (Store, error) {
+	switch cfg.StorageBackend {
+	case BackendMemory:
+		return NewMemoryStore(cfg.StorageMemoryMaxEntries), nil
+	case BackendSQLite:
+		return OpenSQLite(ctx, cfg.StorageSQLitePath)
+	case BackendOpenSearch:
+		return NewOpenSearchStore(OpenSearchConfig{
+			Address:       cfg.OpenSearchAddress,
+			Username:      cfg.OpenSearchUsername,
+			Password:      cfg.OpenSearchPassword,
+			IndexPrefix:   cfg.OpenSearchIndexPrefix,
+			TLSSkipVerify: cfg.TLSInsecureSkipVerify,
+			MaxRetries:    cfg.OpenSearchMaxRetries,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
+}
+
+// matchesReport reports whether a report matches a query, for backends that filter
+// in process. Full-text search requires every word of the query to appear.
+func matchesReport(r reports.Report, q reports.Query) bool {
+	switch {
+	case q.Organization != "" && !slices.Contains(r.Organizations, q.Organization),
+		q.Project != "" && !slices.Contains(r.Projects, q.Project),
+		q.Component != "" && !slices.Contains(r.Components, q.Component),
+		q.Caller != "" && r.Caller != q.Caller,
+		!q.From.IsZero() && r.CreatedAt.Before(q.From),
+		!q.To.IsZero() && r.CreatedAt.After(q.To):
+		return false
+	}
+	text := searchText(r)
+	for _, word := range strings.Fields(strings.ToLower(q.Text)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// searchText returns the lowercased text of a report that full-text search covers.
+func searchText(r reports.Report) string {
+	return strings.ToLower(strings.Join([]string{r.Prompt, r.Summary, r.OutputText(), r.Text}, "\n"))
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"rca.agent/test/internal/agent"
+	"rca.agent/test/internal/reports"
+)
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store { return NewMemoryStore(100) },
+		"sqlite": func(t *testing.T) Store {
+			skipWithoutSQLite(t)
+			s, err := OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "rca.db"))
+			if err != nil {
+				t.Fatalf("OpenSQLite: %v", err)
+			}
+			return s
+		},
+	}
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			defer store.Close()
+			testStore(t, store)
+		})
+	}
+}
+
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	day := time.Date(2026, 8, 3, 0, 0, 0, 0, time.UTC)
+
+	for _, r := range []reports.Report{
+		{ID: "a1", CreatedAt: day, Caller: "oncall", Summary: "Connection pool exhaustion", Components: []string{"payments"}},
+		{ID: "a2", CreatedAt: day.Add(time.Hour), Summary: "Bad deploy", Output: map[string]any{"cause": "100% of pods crash looping"}, Components: []string{"checkout"}},
+		{ID: "a3", CreatedAt: day.Add(2 * time.Hour), Summary: "Pool size too small", Components: []string{"payments"}},
+	} {
+		if err := store.SaveReport(ctx, r); err != nil {
+			t.Fatalf("SaveReport: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query reports.Query
+		want  []string
+	}{
+		{"all, most recent first", reports.Query{}, []string{"a3", "a2", "a1"}},
+		{"component", reports.Query{Component: "payments"}, []string{"a3", "a1"}},
+		{"text", reports.Query{Text: "POOL exhaustion"}, []string{"a1"}},
+		{"output text", reports.Query{Text: "100%"}, []string{"a2"}},
+		{"caller", reports.Query{Caller: "oncall"}, []string{"a1"}},
+		{"time range", reports.Query{From: day.Add(30 * time.Minute), To: day.Add(90 * time.Minute)}, []string{"a2"}},
+		{"limit", reports.Query{Limit: 1}, []string{"a3"}},
+	}
+	for _, tt := range tests {
+		found, err := store.SearchReports(ctx, tt.query)
+		if err != nil {
+			t.Fatalf("%s: SearchReports: %v", tt.name, err)
+		}
+		var ids []string
+		for _, r := range found {
+			ids = append(ids, r.ID)
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("%s: found %v, want %v", tt.name, ids, tt.want)
+		}
+	}
+
+	if err := store.SaveTrajectory(ctx, &agent.Trajectory{ID: "a1", Prompt: "Why?", StartedAt: day}); err != nil {
+		t.Fatalf("SaveTrajectory: %v", err)
+	}
+	if tr, err := store.Trajectory(ctx, "a1"); err != nil || tr.Prompt != "Why?" {
+		t.Errorf("Trajectory = %+v, %v", tr, err)
+	}
+	if _, err := store.Trajectory(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Trajectory(missing) error = %v, want ErrNotFound", err)
+	}
+
+	if err := store.DeleteBefore(ctx, day.Add(90*time.Minute)); err != nil {
+		t.Fatalf("DeleteBefore: %v", err)
+	}
+	if found, _ := store.SearchReports(ctx, reports.Query{}); len(found) != 1 || found[0].ID != "a3" {
+		t.Errorf("reports after DeleteBefore = %+v", found)
+	}
+	if _, err := store.Trajectory(ctx, "a1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Trajectory after DeleteBefore error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStoreEvictsOldest(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(2)
+	for _, id := range []string{"a1", "a2", "a3"} {
+		store.SaveTrajectory(ctx, &agent.Trajectory{ID: id})
+	}
+	if _, err := store.Trajectory(ctx, "a1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("oldest trajectory kept: %v", err)
+	}
+	if _, err := store.Trajectory(ctx, "a3"); err != nil {
+		t.Errorf("Trajectory(a3): %v", err)
+	}
+}
+
+func TestSQLiteMigrationsAreIdempotent(t *testing.T) {
+	skipWithoutSQLite(t)
+	path := filepath.Join(t.TempDir(), "rca.db")
+	for range 2 {
+		s, err := OpenSQLite(context.Background(), path)
+		if err != nil {
+			t.Fatalf("OpenSQLite: %v", err)
+		}
+		s.Close()
+	}
+}
+
+// skipWithoutSQLite skips tests of the SQLite backend in builds without cgo, unless
+// RCA_REQUIRE_SQLITE is set, as in the CI job that tests the image's build stage.
+func skipWithoutSQLite(t *testing.T) {
+	if sqliteAvailable {
+		return
+	}
+	if os.Getenv("RCA_REQUIRE_SQLITE") != "" {
+		t.Fatal("SQLite is required but this build has no cgo")
+	}
+	t.Skip("built without cgo")
+}
@@ -0,0 +1,339 @@
+package tools
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"charm.land/fantasy"
+
+	"rca.agent/test/internal/reports"
+)
+
+const SearchPastAnalysesToolName = "search_past_analyses"
+
+const searchPastAnalysesDescription = `Search the reports of previous root cause analyses for incidents similar to the one you are investigating.
+Filter by component, project, organization and time range, and pass the error message, exception or symptom you observed as error_signature to rank reports by similarity.
+Use it early to check whether the issue happened before; when a past analysis matches, cite it by date and ID and consider its findings and suggested remediation.`
+
+// Search limits of the tool.
+const (
+	defaultPastAnalyses = 5
+	maxPastAnalyses     = 20
+
+	// candidatePool is the number of reports ranked against the error signature.
+	candidatePool = 50
+
+	// minSimilarity is the semantic similarity at which a report without keyword
+	// matches is still considered similar.
+	minSimilarity = 0.6
+
+	// maxReportOutputChars caps the structured output shown per report.
+	maxReportOutputChars = 2000
+
+	// maxCachedEmbeddings bounds the embeddings of reports kept between searches.
+	maxCachedEmbeddings = 2000
+)
+
+type SearchPastAnalysesParams struct {
+	ErrorSignature string `json:"error_signature,omitempty" description:"Error message, exception or symptom to find similar incidents for"`
+	Component      string `json:"component,omitempty" description:"Only analyses that looked at this component"`
+	Project        string `json:"project,omitempty" description:"Only analyses that looked at this project"`
+	Organization   string `json:"organization,omitempty" description:"Only analyses that looked at this organization"`
+	From           string `json:"from,omitempty" description:"Only analyses from this time on (RFC 3339, e.g. 2026-08-01T00:00:00Z)"`
+	To             string `json:"to,omitempty" description:"Only analyses up to this time (RFC 3339)"`
+	Limit          int    `json:"limit,omitempty" description:"Maximum number of analyses to return (default 5, at most 20)"`
+}
+
+// ReportSearcher searches the reports of past analyses.
+type ReportSearcher interface {
+	SearchReports(ctx context.Context, q reports.Query) ([]reports.Report, error)
+}
+
+// Embedder computes text embeddings, for ranking past analyses by meaning rather
+// than shared words.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// NewSearchPastAnalysesTool creates the search_past_analyses tool. Reports are ranked
+// by the share of the error signature's words they contain and, with an embedder,
+// also by semantic similarity; embedder may be nil.
+func NewSearchPastAnalysesTool(searcher ReportSearcher, embedder Embedder) fantasy.AgentTool {
+	s := &pastAnalysesSearch{searcher: searcher, embedder: embedder, embeddings: make(map[string][]float64)}
+	return fantasy.NewAgentTool(
+		SearchPastAnalysesToolName,
+		searchPastAnalysesDescription,
+		func(ctx context.Context, params SearchPastAnalysesParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			q := reports.Query{
+				Organization: params.Organization,
+				Project:      params.Project,
+				Component:    params.Component,
+			}
+			for _, bound := range []struct {
+				name, value string
+				t           *time.Time
+			}{{"from", params.From, &q.From}, {"to", params.To, &q.To}} {
+				if bound.value == "" {
+					continue
+				}
+				parsed, err := time.Parse(time.RFC3339, bound.value)
+				if err != nil {
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("invalid %s %q: expected an RFC 3339 time", bound.name, bound.value)), nil
+				}
+				*bound.t = parsed
+			}
+			limit := params.Limit
+			if limit <= 0 {
+				limit = defaultPastAnalyses
+			}
+			limit = min(limit, maxPastAnalyses)
+
+			matches, err := s.search(ctx, q, params.ErrorSignature, limit)
+			if err != nil {
+				return fantasy.NewTextErrorResponse("search past analyses: " + err.Error()), nil
+			}
+			return fantasy.NewTextResponse(formatPastAnalyses(matches)), nil
+		})
+}
+
+// pastAnalysesSearch ranks stored reports against an error signature.
+type pastAnalysesSearch struct {
+	searcher ReportSearcher
+	embedder Embedder
+
+	mu         sync.Mutex
+	embeddings map[string][]float64 // Report embeddings by ID
+}
+
+// pastAnalysis is a report and how well it matches the error signature.
+type pastAnalysis struct {
+	reports.Report
+	Score float64
+}
+
+func (s *pastAnalysesSearch) search(ctx context.Context, q reports.Query, signature string, limit int) ([]pastAnalysis, error) {
+	if strings.TrimSpace(signature) == "" {
+		q.Limit = limit
+		found, err := s.searcher.SearchReports(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		matches := make([]pastAnalysis, len(found))
+		for i, r := range found {
+			matches[i] = pastAnalysis{Report: r}
+		}
+		return matches, nil
+	}
+
+	// Reports containing every word, and the most recent ones matching the filters,
+	// which may match only some words or only in meaning
+	q.Limit = candidatePool
+	var candidates []reports.Report
+	for _, text := range []string{signature, ""} {
+		q.Text = text
+		found, err := s.searcher.SearchReports(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range found {
+			if !slices.ContainsFunc(candidates, func(c reports.Report) bool { return c.ID == r.ID }) {
+				candidates = append(candidates, r)
+			}
+		}
+	}
+
+	similarities := s.similarities(ctx, signature, candidates)
+	terms := keywordTerms(signature)
+	var matches []pastAnalysis
+	for i, r := range candidates {
+		keyword := keywordScore(terms, r)
+		switch {
+		case similarities == nil && keyword > 0:
+			matches = append(matches, pastAnalysis{Report: r, Score: keyword})
+		case similarities != nil && (keyword > 0 || similarities[i] >= minSimilarity):
+			matches = append(matches, pastAnalysis{Report: r, Score: (keyword + similarities[i]) / 2})
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b pastAnalysis) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return matches[:min(len(matches), limit)], nil
+}
+
+// similarities returns the cosine similarity of each report to the signature, or nil
+// without an embedder or if embedding fails, in which case only keywords rank.
+func (s *pastAnalysesSearch) similarities(ctx context.Context, signature string, candidates []reports.Report) []float64 {
+	if s.embedder == nil || len(candidates) == 0 {
+		return nil
+	}
+
+	// The signature and the reports whose embeddings are not cached are embedded
+	vectors := make([][]float64, len(candidates))
+	texts := []string{signature}
+	var missing []int
+	s.mu.Lock()
+	for i, r := range candidates {
+		if v, ok := s.embeddings[r.ID]; ok {
+			vectors[i] = v
+		} else {
+			missing = append(missing, i)
+			texts = append(texts, embeddingText(r))
+		}
+	}
+	s.mu.Unlock()
+
+	embedded, err := s.embedder.Embed(ctx, texts)
+	if err == nil && len(embedded) != len(texts) {
+		err = fmt.Errorf("got %d embeddings for %d texts", len(embedded), len(texts))
+	}
+	if err != nil {
+		slog.Warn("Failed to embed past analyses, ranking by keywords only", "error", err)
+		return nil
+	}
+
+	s.mu.Lock()
+	if len(s.embeddings)+len(missing) > maxCachedEmbeddings {
+		clear(s.embeddings)
+	}
+	for j, i := range missing {
+		vectors[i] = embedded[j+1]
+		s.embeddings[candidates[i].ID] = vectors[i]
+	}
+	s.mu.Unlock()
+
+	similarities := make([]float64, len(candidates))
+	for i, v := range vectors {
+		similarities[i] = cosine(embedded[0], v)
+	}
+	return similarities
+}
+
+// minTermLength is the length in characters below which words of a signature are
+// too common to rank reports by.
+const minTermLength = 3
+
+// keywordTerms returns the distinct words of a signature that reports are ranked by.
+func keywordTerms(signature string) []string {
+	var terms []string
+	for _, word := range words(signature) {
+		if utf8.RuneCountInString(word) >= minTermLength && !slices.Contains(terms, word) {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// keywordScore returns the share of terms that appear in a report as whole words.
+func keywordScore(terms []string, r reports.Report) float64 {
+	if len(terms) == 0 {
+		return 0
+	}
+	text := make(map[string]bool)
+	for _, word := range words(r.Prompt, r.Summary, r.OutputText(), r.Text) {
+		text[word] = true
+	}
+	var matched int
+	for _, term := range terms {
+		if text[term] {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(terms))
+}
+
+// words splits texts into lowercase words, separated by anything but letters and digits.
+func words(texts ...string) []string {
+	var all []string
+	for _, text := range texts {
+		all = append(all, strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})...)
+	}
+	return all
+}
+
+// embeddingText returns the text of a report that is embedded.
+func embeddingText(r reports.Report) string {
+	text := strings.Join([]string{r.Summary, r.Prompt, r.OutputText()}, "\n")
+	return truncateRunes(text, 8000)
+}
+
+// truncateRunes returns the first n characters of s.
+func truncateRunes(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// formatPastAnalyses renders matching reports for the model.
+func formatPastAnalyses(matches []pastAnalysis) string {
+	if len(matches) == 0 {
+		return "No past analyses match."
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d past analyses found:\n", len(matches))
+	for _, m := range matches {
+		fmt.Fprintf(&sb, "\n## %s (analysis %s)", m.CreatedAt.UTC().Format("2006-01-02 15:04 UTC"), m.ID)
+		if m.Score > 0 {
+			fmt.Fprintf(&sb, ", similarity %.2f", m.Score)
+		}
+		sb.WriteString("\n")
+		for _, entities := range []struct {
+			label string
+			names []string
+		}{{"Organizations", m.Organizations}, {"Projects", m.Projects}, {"Components", m.Components}} {
+			if len(entities.names) > 0 {
+				fmt.Fprintf(&sb, "%s: %s\n", entities.label, strings.Join(entities.names, ", "))
+			}
+		}
+		fmt.Fprintf(&sb, "Prompt: %s\n", m.Prompt)
+		if m.Summary != "" {
+			fmt.Fprintf(&sb, "Summary: %s\n", m.Summary)
+		}
+		if m.Output != nil {
+			output, _ := json.Marshal(m.Output)
+			text := truncateRunes(string(output), maxReportOutputChars)
+			if len(text) < len(output) {
+				text += "..."
+			}
+			fmt.Fprintf(&sb, "Output: %s\n", text)
+		} else if m.Text != "" {
+			fmt.Fprintf(&sb, "Response: %s\n", truncateRunes(m.Text, maxReportOutputChars))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,139 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"rca.agent/test/internal/reports"
+)
+
+// fakeSearcher filters by component and requires every word of the text to appear.
+type fakeSearcher []reports.Report
+
+func (f fakeSearcher) SearchReports(_ context.Context, q reports.Query) ([]reports.Report, error) {
+	var found []reports.Report
+	for _, r := range f {
+		if q.Component != "" && !slices.Contains(r.Components, q.Component) {
+			continue
+		}
+		text := strings.ToLower(r.Summary)
+		if !slices.ContainsFunc(strings.Fields(strings.ToLower(q.Text)), func(w string) bool { return !strings.Contains(text, w) }) {
+			found = append(found, r)
+		}
+	}
+	return found[:min(len(found), q.MaxResults())], nil
+}
+
+// fakeEmbedder embeds texts about database connections near each other, and apart
+// from texts about deploys.
+type fakeEmbedder struct{ err error }
+
+func (f fakeEmbedder) Embed(_ context.Context, texts []string) ([][]float64, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		text = strings.ToLower(text)
+		vectors[i] = []float64{0, 0, 0.1}
+		if strings.Contains(text, "database") || strings.Contains(text, "postgres") || strings.Contains(text, "connection") {
+			vectors[i][0] = 1
+		}
+		if strings.Contains(text, "deploy") {
+			vectors[i][1] = 1
+		}
+	}
+	return vectors, nil
+}
+
+func TestSearchPastAnalyses(t *testing.T) {
+	day := time.Date(2026, 8, 3, 0, 0, 0, 0, time.UTC)
+	searcher := fakeSearcher{
+		{ID: "a1", CreatedAt: day, Summary: "Connection pool exhaustion: too many clients", Components: []string{"payments"}},
+		{ID: "a2", CreatedAt: day.Add(time.Hour), Summary: "Pool of postgres connections too small", Components: []string{"payments"}},
+		{ID: "a3", CreatedAt: day.Add(2 * time.Hour), Summary: "Bad deploy", Components: []string{"payments"}},
+		{ID: "a4", CreatedAt: day.Add(3 * time.Hour), Summary: "Connection pool exhaustion", Components: []string{"checkout"}},
+	}
+	ctx := context.Background()
+	q := reports.Query{Component: "payments"}
+
+	tests := []struct {
+		name     string
+		embedder Embedder
+		want     []string
+	}{
+		{"keywords", nil, []string{"a1", "a2"}},
+		{"embeddings", fakeEmbedder{}, []string{"a1", "a2"}},
+		{"embedding failure", fakeEmbedder{err: errors.New("unavailable")}, []string{"a1", "a2"}},
+	}
+	for _, tt := range tests {
+		s := &pastAnalysesSearch{searcher: searcher, embedder: tt.embedder, embeddings: make(map[string][]float64)}
+		matches, err := s.search(ctx, q, "connection pool exhaustion", 5)
+		if err != nil {
+			t.Fatalf("%s: search: %v", tt.name, err)
+		}
+		var ids []string
+		for _, m := range matches {
+			ids = append(ids, m.ID)
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("%s: matches = %v, want %v", tt.name, ids, tt.want)
+		}
+	}
+
+	// Reports similar in meaning match without sharing words
+	s := &pastAnalysesSearch{searcher: searcher, embedder: fakeEmbedder{}, embeddings: make(map[string][]float64)}
+	matches, err := s.search(ctx, q, "database refused clients", 5)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(matches) != 2 || matches[0].ID != "a1" || matches[1].ID != "a2" {
+		t.Errorf("matches = %+v", matches)
+	}
+	if len(s.embeddings) != 3 {
+		t.Errorf("cached embeddings = %d, want 3", len(s.embeddings))
+	}
+}
+
+func TestKeywordScoreMatchesWholeWords(t *testing.T) {
+	terms := keywordTerms("ERROR: io timeout (timeout) on db-proxy")
+	if !slices.Equal(terms, []string{"error", "timeout", "proxy"}) {
+		t.Errorf("keywordTerms() = %v", terms)
+	}
+
+	tests := []struct {
+		summary string
+		want    float64
+	}{
+		{"Proxy timeout, error rate up", 1},
+		{"Errors and timeouts in the proxypass", 0},
+		{"db-proxy: timeout", 2.0 / 3},
+	}
+	for _, tt := range tests {
+		if got := keywordScore(terms, reports.Report{Summary: tt.summary}); got != tt.want {
+			t.Errorf("keywordScore(%q) = %v, want %v", tt.summary, got, tt.want)
+		}
+	}
+}
+
+func TestFormatPastAnalysesTruncatesOnCharacters(t *testing.T) {
+	text := strings.Repeat("é", maxReportOutputChars+10)
+	out := formatPastAnalyses([]pastAnalysis{
+		{Report: reports.Report{ID: "a1", Text: text}},
+		{Report: reports.Report{ID: "a2", Output: map[string]any{"summary": text}}},
+	})
+	if !utf8.ValidString(out) {
+		t.Fatal("formatPastAnalyses() produced invalid UTF-8")
+	}
+	if !strings.Contains(out, "Response: "+text[:2*maxReportOutputChars]+"\n") {
+		t.Error("response not cut to maxReportOutputChars characters")
+	}
+	if got := embeddingText(reports.Report{Summary: text + text + text + text}); utf8.RuneCountInString(got) != 8000 {
+		t.Errorf("embeddingText() has %d characters, want 8000", utf8.RuneCountInString(got))
+	}
+}
@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"charm.land/fantasy"
+)
+
+const RecallToolResultToolName = "recall_tool_result"
+
+const recallToolResultDescription = `Retrieve the full original output of an earlier tool call whose result was compacted into a summary to save context.
+Use the tool_call_id shown in the compacted result. Large outputs are returned in pages; when the result header says more is available, call again with the offset it gives to continue reading.`
+
+// defaultRecallLimit is the default and maximum number of characters returned per
+// page, so that recalling a result cannot undo its compaction.
+const defaultRecallLimit = 20000
+
+type RecallToolResultParams struct {
+	ToolCallID string `json:"tool_call_id" description:"ID of the tool call whose original result to retrieve"`
+	Offset     int    `json:"offset,omitempty" description:"Character offset to start reading from (default 0)"`
+	Limit      int    `json:"limit,omitempty" description:"Maximum number of characters to return (default and maximum 20000)"`
+}
+
+// StoredToolResult is the original output of a tool call.
+type StoredToolResult struct {
+	ToolName string
+	Text     string
+}
+
+// ToolResultStore keeps the original tool results of a single analysis.
+type ToolResultStore struct {
+	mu      sync.RWMutex
+	results map[string]StoredToolResult
+}
+
+// NewToolResultStore creates an empty store.
+func NewToolResultStore() *ToolResultStore {
+	return &ToolResultStore{results: make(map[string]StoredToolResult)}
+}
+
+// Put stores the original result of a tool call.
+func (s *ToolResultStore) Put(toolCallID string, result StoredToolResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[toolCallID] = result
+}
+
+// Get returns the original result of a tool call.
+func (s *ToolResultStore) Get(toolCallID string) (StoredToolResult, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result, ok := s.results[toolCallID]
+	return result, ok
+}
+
+type toolResultStoreKey struct{}
+
+// WithToolResultStore returns a context carrying the analysis' tool result store.
+func WithToolResultStore(ctx context.Context, store *ToolResultStore) context.Context {
+	return context.WithValue(ctx, toolResultStoreKey{}, store)
+}
+
+// ToolResultStoreFrom returns the tool result store carried by ctx, if any.
+func ToolResultStoreFrom(ctx context.Context) (*ToolResultStore, bool) {
+	store, ok := ctx.Value(toolResultStoreKey{}).(*ToolResultStore)
+	return store, ok
+}
+
+// NewRecallToolResultTool creates the recall_tool_result tool, which reads from
+// the tool result store of the analysis it runs in.
+func NewRecallToolResultTool() fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		RecallToolResultToolName,
+		recallToolResultDescription,
+		func(ctx context.Context, params RecallToolResultParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			store, ok := ToolResultStoreFrom(ctx)
+			if !ok {
+				return fantasy.NewTextErrorResponse("no compacted tool results are available"), nil
+			}
+
+			result, ok := store.Get(params.ToolCallID)
+			if !ok {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("no stored result for tool call %q", params.ToolCallID)), nil
+			}
+
+			limit := params.Limit
+			if limit <= 0 || limit > defaultRecallLimit {
+				limit = defaultRecallLimit
+			}
+			// Offsets count characters, so that pages never split one
+			text := []rune(result.Text)
+			if params.Offset < 0 || params.Offset > len(text) {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("offset %d out of range (result has %d characters)", params.Offset, len(text))), nil
+			}
+
+			end := min(params.Offset+limit, len(text))
+			header := fmt.Sprintf("Original result of %s (characters %d-%d of %d)", result.ToolName, params.Offset, end, len(text))
+			if end < len(text) {
+				header += fmt.Sprintf(", more available: call again with offset %d", end)
+			}
+
+			return fantasy.NewTextResponse(header + "\n\n" + string(text[params.Offset:end])), nil
+		})
+}
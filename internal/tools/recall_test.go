@@ -0,0 +1,56 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"charm.land/fantasy"
+)
+
+func TestRecallToolResultPagesByCharacter(t *testing.T) {
+	store := NewToolResultStore()
+	store.Put("call-1", StoredToolResult{ToolName: "get_logs", Text: "échec de connexion à la base"})
+	ctx := WithToolResultStore(context.Background(), store)
+	tool := NewRecallToolResultTool()
+
+	recall := func(input string) fantasy.ToolResponse {
+		t.Helper()
+		resp, err := tool.Run(ctx, fantasy.ToolCall{ID: "recall", Name: RecallToolResultToolName, Input: input})
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return resp
+	}
+
+	resp := recall(`{"tool_call_id": "call-1", "offset": 0, "limit": 5}`)
+	page := resp.Content[strings.Index(resp.Content, "\n\n")+2:]
+	if page != "échec" || !strings.Contains(resp.Content, "characters 0-5 of 28") {
+		t.Errorf("first page = %q", resp.Content)
+	}
+
+	resp = recall(`{"tool_call_id": "call-1", "offset": 23, "limit": 5}`)
+	page = resp.Content[strings.Index(resp.Content, "\n\n")+2:]
+	if page != " base" || !utf8.ValidString(resp.Content) {
+		t.Errorf("last page = %q", resp.Content)
+	}
+
+	if resp := recall(`{"tool_call_id": "call-1", "offset": 29}`); !resp.IsError {
+		t.Errorf("offset past the end = %q, want an error", resp.Content)
+	}
+}
+
+func TestRecallToolResultCapsLimit(t *testing.T) {
+	store := NewToolResultStore()
+	store.Put("call-1", StoredToolResult{ToolName: "get_logs", Text: strings.Repeat("x", 3*defaultRecallLimit)})
+	ctx := WithToolResultStore(context.Background(), store)
+
+	resp, err := NewRecallToolResultTool().Run(ctx, fantasy.ToolCall{ID: "recall", Name: RecallToolResultToolName, Input: `{"tool_call_id": "call-1", "limit": 10000000}`})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !strings.Contains(resp.Content, "characters 0-20000 of 60000") {
+		t.Errorf("page header = %q", resp.Content[:strings.Index(resp.Content, "\n\n")])
+	}
+}